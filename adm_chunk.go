@@ -0,0 +1,414 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-audio/riff"
+)
+
+// The chna and axml chunks are documented in ITU-R BS.2088 and the Audio
+// Definition Model in ITU-R BS.2076:
+// https://www.itu.int/rec/R-REC-BS.2088
+// https://www.itu.int/rec/R-REC-BS.2076
+
+// nsEBUCore is the namespace of the ADM documents.
+const nsEBUCore = "urn:ebu:metadata-schema:ebuCore_2014"
+
+// chnaEntrySize is the size of an audio ID entry of the chna chunk.
+const chnaEntrySize = 40
+
+// ChannelAllocation is the content of the chna chunk, it maps the tracks of
+// the file to the audio track UIDs of the ADM document.
+type ChannelAllocation struct {
+	// NumTracks is the number of tracks of the file. When encoding, the
+	// number of channels is used if it is 0.
+	NumTracks uint16
+	// AudioIDs contains the track mappings, a track can be referenced by
+	// several entries.
+	AudioIDs []*AudioID
+}
+
+// AudioID is an entry of the chna chunk.
+type AudioID struct {
+	// TrackIndex is the index of the track, starting at 1.
+	TrackIndex uint16
+	// UID is the audioTrackUID of the track such as ATU_00000001.
+	UID string
+	// TrackFormatRef is the audioTrackFormatID (AT_00010001_01) or the
+	// audioChannelFormatID (AC_00010001) of the track.
+	TrackFormatRef string
+	// PackFormatRef is the audioPackFormatID of the track such as
+	// AP_00010002.
+	PackFormatRef string
+}
+
+// ADM represents the Audio Definition Model document stored in the axml
+// chunk.
+type ADM struct {
+	// Raw is the ADM document as found in the file. When Raw is set, the
+	// encoder writes the typed values below into it: the elements are matched
+	// by ID, keeping the attributes and elements the typed values don't
+	// cover. The elements parsed from Raw and removed from the typed values
+	// are removed, the other ones are kept. Set it to nil to only write the
+	// typed values.
+	Raw []byte
+	// Objects contains the audioObject elements.
+	Objects []*ADMObject
+	// PackFormats contains the audioPackFormat elements.
+	PackFormats []*ADMPackFormat
+
+	// parsedObjects and parsedPacks are the IDs of the elements found by
+	// ParseADM, the ones missing from the typed values were deleted.
+	parsedObjects map[string]bool
+	parsedPacks   map[string]bool
+}
+
+// ADMObject is an audioObject, a group of tracks rendered together.
+type ADMObject struct {
+	ID   string
+	Name string
+	// Start and Duration use the ADM time format hh:mm:ss.fffff, they are
+	// empty when not set.
+	Start    string
+	Duration string
+	// PackFormatRefs and TrackUIDRefs are the IDs of the audioPackFormats and
+	// audioTrackUIDs of the object.
+	PackFormatRefs []string
+	TrackUIDRefs   []string
+}
+
+// ADMPackFormat is an audioPackFormat, a group of channels such as a stereo
+// or 5.1 bed.
+type ADMPackFormat struct {
+	ID   string
+	Name string
+	// TypeLabel and TypeDefinition describe the type of the channels, for
+	// instance 0001 and DirectSpeakers or 0003 and Objects.
+	TypeLabel      string
+	TypeDefinition string
+	// ChannelFormatRefs are the IDs of the audioChannelFormats of the pack.
+	ChannelFormatRefs []string
+}
+
+// DecodeChnaChunk decodes a chna chunk and puts the data in
+// Decoder.Metadata.ChannelAllocation.
+func DecodeChnaChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDChna {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		if _, err := io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the chna chunk - %w", err)
+		}
+		if len(buf) < 4 {
+			return fmt.Errorf("chna chunk too short: %d bytes", len(buf))
+		}
+		a := &ChannelAllocation{NumTracks: binary.LittleEndian.Uint16(buf)}
+		numUIDs := int(binary.LittleEndian.Uint16(buf[2:]))
+		// the chunk can contain unused entries, reserved for later use
+		for pos := 4; pos+chnaEntrySize <= len(buf) && len(a.AudioIDs) < numUIDs; pos += chnaEntrySize {
+			entry := buf[pos : pos+chnaEntrySize]
+			id := &AudioID{
+				TrackIndex:     binary.LittleEndian.Uint16(entry),
+				UID:            string(entry[2:14][:clen(entry[2:14])]),
+				TrackFormatRef: string(entry[14:28][:clen(entry[14:28])]),
+				PackFormatRef:  string(entry[28:39][:clen(entry[28:39])]),
+			}
+			if id.TrackIndex == 0 {
+				continue
+			}
+			a.AudioIDs = append(a.AudioIDs, id)
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.ChannelAllocation = a
+	}
+	ch.Drain()
+	return nil
+}
+
+// encodeChnaChunk returns the content of the chna chunk, nil if no chunk
+// should be written.
+func encodeChnaChunk(e *Encoder) []byte {
+	if e == nil || e.Metadata == nil || e.Metadata.ChannelAllocation == nil {
+		return nil
+	}
+	a := e.Metadata.ChannelAllocation
+	numTracks := a.NumTracks
+	if numTracks == 0 {
+		numTracks = uint16(e.NumChans)
+	}
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, []uint16{numTracks, uint16(len(a.AudioIDs))})
+	field := func(s string, size int) []byte {
+		b := make([]byte, size)
+		copy(b, s)
+		return b
+	}
+	for _, id := range a.AudioIDs {
+		binary.Write(buf, binary.LittleEndian, id.TrackIndex)
+		buf.Write(field(id.UID, 12))
+		buf.Write(field(id.TrackFormatRef, 14))
+		buf.Write(field(id.PackFormatRef, 11))
+		// padding
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// DecodeAxmlChunk decodes an axml chunk and puts the data in
+// Decoder.Metadata.ADM.
+func DecodeAxmlChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDAxml {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		if _, err := io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the axml chunk - %w", err)
+		}
+		adm, err := ParseADM(bytes.TrimRight(buf, "\x00"))
+		if err != nil {
+			return err
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.ADM = adm
+	}
+	ch.Drain()
+	return nil
+}
+
+// ParseADM parses the passed ADM document.
+func ParseADM(doc []byte) (*ADM, error) {
+	root, err := parseXMLTree(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the ADM document - %w", err)
+	}
+	refs := func(n *xmlNode, local string) []string {
+		var ids []string
+		for _, c := range n.children {
+			if c.name.Local == local {
+				ids = append(ids, strings.TrimSpace(c.text))
+			}
+		}
+		return ids
+	}
+	adm := &ADM{Raw: doc, parsedObjects: map[string]bool{}, parsedPacks: map[string]bool{}}
+	// documents don't always use the ebuCore namespace
+	for _, n := range root.findAllLocal("audioObject") {
+		o := &ADMObject{
+			ID:             n.attrLocal("audioObjectID"),
+			Name:           n.attrLocal("audioObjectName"),
+			Start:          n.attrLocal("start"),
+			Duration:       n.attrLocal("duration"),
+			PackFormatRefs: refs(n, "audioPackFormatIDRef"),
+			TrackUIDRefs:   refs(n, "audioTrackUIDRef"),
+		}
+		adm.Objects = append(adm.Objects, o)
+		adm.parsedObjects[o.ID] = true
+	}
+	for _, n := range root.findAllLocal("audioPackFormat") {
+		p := &ADMPackFormat{
+			ID:                n.attrLocal("audioPackFormatID"),
+			Name:              n.attrLocal("audioPackFormatName"),
+			TypeLabel:         n.attrLocal("typeLabel"),
+			TypeDefinition:    n.attrLocal("typeDefinition"),
+			ChannelFormatRefs: refs(n, "audioChannelFormatIDRef"),
+		}
+		adm.PackFormats = append(adm.PackFormats, p)
+		adm.parsedPacks[p.ID] = true
+	}
+	return adm, nil
+}
+
+// Marshal returns a new ADM document containing the typed values.
+func (adm *ADM) Marshal() []byte {
+	buf := bytes.NewBuffer(nil)
+	esc := func(s string) string {
+		b := bytes.NewBuffer(nil)
+		xml.EscapeText(b, []byte(s))
+		return b.String()
+	}
+	attr := func(name, val string) {
+		if val != "" {
+			buf.WriteString(" " + name + "=\"" + esc(val) + "\"")
+		}
+	}
+	writeRefs := func(name string, ids []string) {
+		for _, id := range ids {
+			buf.WriteString("     <" + name + ">" + esc(id) + "</" + name + ">\n")
+		}
+	}
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	buf.WriteString("<ebuCoreMain xmlns=\"" + nsEBUCore + "\" xml:lang=\"en\">\n")
+	buf.WriteString(" <coreMetadata>\n")
+	buf.WriteString("  <format>\n")
+	buf.WriteString("   <audioFormatExtended>\n")
+	for _, o := range adm.Objects {
+		buf.WriteString("    <audioObject")
+		attr("audioObjectID", o.ID)
+		attr("audioObjectName", o.Name)
+		attr("start", o.Start)
+		attr("duration", o.Duration)
+		buf.WriteString(">\n")
+		writeRefs("audioPackFormatIDRef", o.PackFormatRefs)
+		writeRefs("audioTrackUIDRef", o.TrackUIDRefs)
+		buf.WriteString("    </audioObject>\n")
+	}
+	for _, p := range adm.PackFormats {
+		buf.WriteString("    <audioPackFormat")
+		attr("audioPackFormatID", p.ID)
+		attr("audioPackFormatName", p.Name)
+		attr("typeLabel", p.TypeLabel)
+		attr("typeDefinition", p.TypeDefinition)
+		buf.WriteString(">\n")
+		writeRefs("audioChannelFormatIDRef", p.ChannelFormatRefs)
+		buf.WriteString("    </audioPackFormat>\n")
+	}
+	buf.WriteString("   </audioFormatExtended>\n")
+	buf.WriteString("  </format>\n")
+	buf.WriteString(" </coreMetadata>\n")
+	buf.WriteString("</ebuCoreMain>\n")
+	return buf.Bytes()
+}
+
+// encodeAxmlChunk returns the content of the axml chunk, nil if no document
+// should be written.
+func encodeAxmlChunk(e *Encoder) []byte {
+	if e == nil || e.Metadata == nil || e.Metadata.ADM == nil {
+		return nil
+	}
+	if len(e.Metadata.ADM.Raw) > 0 {
+		return e.Metadata.ADM.merge()
+	}
+	return e.Metadata.ADM.Marshal()
+}
+
+// merge returns the raw document updated with the typed values. The raw
+// document is returned as is if it can't be parsed and the typed values are
+// marshaled if it doesn't have an audioFormatExtended element.
+func (adm *ADM) merge() []byte {
+	root, err := parseXMLTree(adm.Raw)
+	if err != nil {
+		return adm.Raw
+	}
+	formats := root.findAllLocal("audioFormatExtended")
+	if len(formats) == 0 {
+		return adm.Marshal()
+	}
+	format := formats[0]
+
+	objects := admElements(root, format, "audioObject", "audioObjectID", adm.parsedObjects, len(adm.Objects), func(i int) string {
+		return adm.Objects[i].ID
+	}, "audioContent", "audioProgramme")
+	for i, o := range adm.Objects {
+		n := objects[i]
+		n.setAttr("audioObjectID", o.ID)
+		n.setAttr("audioObjectName", o.Name)
+		n.setAttr("start", o.Start)
+		n.setAttr("duration", o.Duration)
+		n.setRefs("audioPackFormatIDRef", o.PackFormatRefs, 0)
+		n.setRefs("audioTrackUIDRef", o.TrackUIDRefs, len(n.children))
+	}
+	packs := admElements(root, format, "audioPackFormat", "audioPackFormatID", adm.parsedPacks, len(adm.PackFormats), func(i int) string {
+		return adm.PackFormats[i].ID
+	}, "audioObject", "audioContent", "audioProgramme")
+	for i, p := range adm.PackFormats {
+		n := packs[i]
+		n.setAttr("audioPackFormatID", p.ID)
+		n.setAttr("audioPackFormatName", p.Name)
+		n.setAttr("typeLabel", p.TypeLabel)
+		n.setAttr("typeDefinition", p.TypeDefinition)
+		n.setRefs("audioChannelFormatIDRef", p.ChannelFormatRefs, len(n.children))
+	}
+	return root.marshal()
+}
+
+// admElements returns the elements of the document matching the count typed
+// values, whose IDs are returned by id. The existing elements are matched by
+// ID in document order and the missing ones are added after the last element
+// of the same kind or of one of the preceding kinds. The unmatched elements
+// are removed only if their ID is in parsed, as the user deleted them from
+// the typed values.
+func admElements(root, format *xmlNode, local, idAttr string, parsed map[string]bool, count int, id func(i int) string, preceding ...string) []*xmlNode {
+	existing := map[string][]*xmlNode{}
+	all := root.findAllLocal(local)
+	for _, n := range all {
+		key := n.attrLocal(idAttr)
+		existing[key] = append(existing[key], n)
+	}
+	used := map[*xmlNode]bool{}
+	nodes := make([]*xmlNode, count)
+	for i := range nodes {
+		var n *xmlNode
+		if key := id(i); len(existing[key]) > 0 {
+			n, existing[key] = existing[key][0], existing[key][1:]
+		} else {
+			n = &xmlNode{name: xml.Name{Space: format.name.Space, Local: local}}
+			format.insert(format.lastIndex(append([]string{local}, preceding...))+1, n)
+		}
+		used[n] = true
+		nodes[i] = n
+	}
+	for _, n := range all {
+		if !used[n] && parsed[n.attrLocal(idAttr)] && n.parent != nil {
+			n.parent.remove(n)
+		}
+	}
+	return nodes
+}
+
+// lastIndex returns the index of the last child with the first of the passed
+// local names found, -1 if none is found.
+func (n *xmlNode) lastIndex(locals []string) int {
+	for _, local := range locals {
+		for i := len(n.children) - 1; i >= 0; i-- {
+			if n.children[i].name.Local == local {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// setRefs replaces the children with the passed local name by elements
+// containing the passed IDs. When the node doesn't have such children, the
+// new ones are inserted at the passed index.
+func (n *xmlNode) setRefs(local string, ids []string, at int) {
+	first := -1
+	for i := 0; i < len(n.children); i++ {
+		if n.children[i].name.Local == local {
+			if first < 0 {
+				first = i
+			}
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			i--
+		}
+	}
+	if first < 0 {
+		first = at
+	}
+	if first > len(n.children) {
+		first = len(n.children)
+	}
+	for i, id := range ids {
+		n.insert(first+i, &xmlNode{name: xml.Name{Space: n.name.Space, Local: local}, text: id})
+	}
+}
@@ -0,0 +1,153 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// adtl list is documented here:
+// https://www.recordingblogs.com/wiki/associated-data-list-chunk-of-a-wave-file
+
+var (
+	markerLabl = [4]byte{'l', 'a', 'b', 'l'}
+	markerNote = [4]byte{'n', 'o', 't', 'e'}
+	markerLtxt = [4]byte{'l', 't', 'x', 't'}
+
+	// purposeRegion is the purpose of the ltxt entries written for regions.
+	purposeRegion = [4]byte{'r', 'g', 'n', ' '}
+)
+
+// CueLabel is a labl or note entry of the associated data list, it attaches
+// a text to a cue point.
+type CueLabel struct {
+	// CueID is the ID of the cue point the text refers to.
+	CueID [4]byte
+	Text  string
+}
+
+// LabeledText is a ltxt entry of the associated data list, it defines a
+// section of the audio content starting at a cue point.
+type LabeledText struct {
+	// CueID is the ID of the cue point starting the section.
+	CueID [4]byte
+	// Length is the number of frames of the section.
+	Length uint32
+	// Purpose describes the purpose of the text, for instance "rgn " for a
+	// region.
+	Purpose  [4]byte
+	Country  uint16
+	Language uint16
+	Dialect  uint16
+	CodePage uint16
+	Text     string
+}
+
+// decodeAssociatedData decodes the entries of an adtl list, the list type
+// being already consumed.
+func decodeAssociatedData(d *Decoder, buf []byte) error {
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	d.Metadata.Labels = nil
+	d.Metadata.Notes = nil
+	d.Metadata.LabeledTexts = nil
+	r := bytes.NewReader(buf)
+	var (
+		id   [4]byte
+		size uint32
+	)
+	for r.Len() >= 8 {
+		if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+			return err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+		if int(size) > r.Len() {
+			return fmt.Errorf("adtl %s entry of %d bytes goes past the list", id[:], size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("failed to read the adtl %s entry - %w", id[:], err)
+		}
+		// entries are word aligned
+		if size%2 == 1 && r.Len() > 0 {
+			r.ReadByte()
+		}
+		switch id {
+		case markerLabl, markerNote:
+			if len(data) < 4 {
+				return fmt.Errorf("adtl %s entry too short: %d bytes", id[:], len(data))
+			}
+			l := &CueLabel{}
+			copy(l.CueID[:], data)
+			raw := data[4:]
+			raw = raw[:clen(raw)]
+			l.Text = d.infoCharset(raw).decode(raw)
+			if id == markerLabl {
+				d.Metadata.Labels = append(d.Metadata.Labels, l)
+			} else {
+				d.Metadata.Notes = append(d.Metadata.Notes, l)
+			}
+		case markerLtxt:
+			if len(data) < 20 {
+				return fmt.Errorf("adtl ltxt entry too short: %d bytes", len(data))
+			}
+			lt := &LabeledText{}
+			copy(lt.CueID[:], data)
+			lt.Length = binary.LittleEndian.Uint32(data[4:])
+			copy(lt.Purpose[:], data[8:])
+			lt.Country = binary.LittleEndian.Uint16(data[12:])
+			lt.Language = binary.LittleEndian.Uint16(data[14:])
+			lt.Dialect = binary.LittleEndian.Uint16(data[16:])
+			lt.CodePage = binary.LittleEndian.Uint16(data[18:])
+			raw := data[20:]
+			raw = raw[:clen(raw)]
+			lt.Text = d.infoCharset(raw).decode(raw)
+			d.Metadata.LabeledTexts = append(d.Metadata.LabeledTexts, lt)
+		}
+	}
+	return nil
+}
+
+// encodeAssociatedData returns the content of the adtl list containing the
+// passed entries, nil if there are none.
+func encodeAssociatedData(e *Encoder, labels, notes []*CueLabel, texts []*LabeledText) []byte {
+	if len(labels)+len(notes)+len(texts) == 0 {
+		return nil
+	}
+	cs := e.infoCharset()
+	buf := bytes.NewBuffer(nil)
+	buf.Write(CIDAdtl[:])
+	writeEntry := func(id [4]byte, data []byte) {
+		buf.Write(id[:])
+		binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+	writeLabels := func(id [4]byte, labels []*CueLabel) {
+		for _, l := range labels {
+			data := append(append([]byte{}, l.CueID[:]...), cs.encode(l.Text)...)
+			writeEntry(id, append(data, 0))
+		}
+	}
+	writeLabels(markerLabl, labels)
+	writeLabels(markerNote, notes)
+	for _, lt := range texts {
+		data := bytes.NewBuffer(nil)
+		data.Write(lt.CueID[:])
+		binary.Write(data, binary.LittleEndian, lt.Length)
+		data.Write(lt.Purpose[:])
+		binary.Write(data, binary.LittleEndian, []uint16{lt.Country, lt.Language, lt.Dialect, lt.CodePage})
+		if lt.Text != "" {
+			data.Write(cs.encode(lt.Text))
+			data.WriteByte(0)
+		}
+		writeEntry(markerLtxt, data.Bytes())
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,126 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-audio/riff"
+)
+
+// bext chunk is documented here:
+// https://tech.ebu.ch/docs/tech/tech3285.pdf
+
+// bextFixedSize is the size of the bext chunk without the coding history.
+const bextFixedSize = 602
+
+// BroadcastExtension is the content of the bext chunk of Broadcast Wave
+// Format files.
+type BroadcastExtension struct {
+	// Description is a free text description of the sound sequence (256
+	// characters max).
+	Description string
+	// Originator is the name of the originator of the file (32 characters
+	// max).
+	Originator string
+	// OriginatorReference is an unambiguous reference allocated by the
+	// originating organisation (32 characters max).
+	OriginatorReference string
+	// OriginationDate is the creation date formatted as yyyy-mm-dd.
+	OriginationDate string
+	// OriginationTime is the creation time formatted as hh:mm:ss.
+	OriginationTime string
+	// TimeReference is the position of the first sample of the file, in
+	// samples since midnight. See Decoder.StartTimecode.
+	TimeReference uint64
+	// Version is the version of the BWF specification the chunk follows.
+	Version uint16
+	// UMID is the SMPTE 330M unique material identifier, available since
+	// version 1. See ParseUMID and SetUMID.
+	UMID [64]byte
+	// The loudness values, available since version 2, are expressed in
+	// hundredths of LUFS, LU or dBTP.
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+	// CodingHistory describes the coding processes applied to the audio
+	// data, one line per process.
+	CodingHistory string
+}
+
+// DecodeBextChunk decodes a bext chunk and puts the data in
+// Decoder.Metadata.BroadcastExtension.
+func DecodeBextChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDBext {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		if _, err := io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the bext chunk - %w", err)
+		}
+		if len(buf) < bextFixedSize {
+			return fmt.Errorf("bext chunk too short: %d bytes", len(buf))
+		}
+		b := &BroadcastExtension{
+			Description:          bextString(buf[0:256]),
+			Originator:           bextString(buf[256:288]),
+			OriginatorReference:  bextString(buf[288:320]),
+			OriginationDate:      bextString(buf[320:330]),
+			OriginationTime:      bextString(buf[330:338]),
+			TimeReference:        binary.LittleEndian.Uint64(buf[338:]),
+			Version:              binary.LittleEndian.Uint16(buf[346:]),
+			LoudnessValue:        int16(binary.LittleEndian.Uint16(buf[412:])),
+			LoudnessRange:        int16(binary.LittleEndian.Uint16(buf[414:])),
+			MaxTruePeakLevel:     int16(binary.LittleEndian.Uint16(buf[416:])),
+			MaxMomentaryLoudness: int16(binary.LittleEndian.Uint16(buf[418:])),
+			MaxShortTermLoudness: int16(binary.LittleEndian.Uint16(buf[420:])),
+			CodingHistory:        bextString(buf[bextFixedSize:]),
+		}
+		copy(b.UMID[:], buf[348:412])
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.BroadcastExtension = b
+	}
+	ch.Drain()
+	return nil
+}
+
+// bextString returns the ASCII text stored in a fixed size field, which is
+// NUL terminated when shorter than the field.
+func bextString(b []byte) string {
+	return strings.TrimRight(string(b[:clen(b)]), " ")
+}
+
+// encodeBextChunk returns the content of the bext chunk, nil if no chunk
+// should be written.
+func encodeBextChunk(e *Encoder) []byte {
+	if e == nil || e.Metadata == nil || e.Metadata.BroadcastExtension == nil {
+		return nil
+	}
+	b := e.Metadata.BroadcastExtension
+	buf := make([]byte, bextFixedSize, bextFixedSize+len(b.CodingHistory))
+	// the text fields are truncated to their size
+	copy(buf[0:256], b.Description)
+	copy(buf[256:288], b.Originator)
+	copy(buf[288:320], b.OriginatorReference)
+	copy(buf[320:330], b.OriginationDate)
+	copy(buf[330:338], b.OriginationTime)
+	binary.LittleEndian.PutUint64(buf[338:], b.TimeReference)
+	binary.LittleEndian.PutUint16(buf[346:], b.Version)
+	copy(buf[348:412], b.UMID[:])
+	binary.LittleEndian.PutUint16(buf[412:], uint16(b.LoudnessValue))
+	binary.LittleEndian.PutUint16(buf[414:], uint16(b.LoudnessRange))
+	binary.LittleEndian.PutUint16(buf[416:], uint16(b.MaxTruePeakLevel))
+	binary.LittleEndian.PutUint16(buf[418:], uint16(b.MaxMomentaryLoudness))
+	binary.LittleEndian.PutUint16(buf[420:], uint16(b.MaxShortTermLoudness))
+	return append(buf, b.CodingHistory...)
+}
@@ -0,0 +1,173 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ChannelMatrix maps the channels of a file to output channels: each row is
+// an output channel made of the sum of the input channels weighted by its
+// coefficients. Rows can be shorter than the number of input channels, the
+// missing coefficients being 0.
+type ChannelMatrix [][]float64
+
+// SelectChannels returns a matrix selecting the passed input channels, in
+// the passed order. Channels are numbered from 0.
+func SelectChannels(channels ...int) ChannelMatrix {
+	m := make(ChannelMatrix, len(channels))
+	for i, ch := range channels {
+		if ch < 0 {
+			// the empty row is reported by validate
+			continue
+		}
+		m[i] = make([]float64, ch+1)
+		m[i][ch] = 1
+	}
+	return m
+}
+
+// DownmixStereoToMono returns a matrix averaging the 2 channels of a stereo
+// file.
+func DownmixStereoToMono() ChannelMatrix {
+	return ChannelMatrix{{0.5, 0.5}}
+}
+
+// Downmix51ToStereo returns the ITU-R BS.775 matrix downmixing a 5.1 file,
+// using the WAVE channel order L, R, C, LFE, Ls, Rs, to stereo. The center
+// and surround channels are attenuated by 3 dB and the LFE channel is
+// dropped. Integer samples are clipped if the sum is out of range.
+func Downmix51ToStereo() ChannelMatrix {
+	const k = math.Sqrt2 / 2
+	return ChannelMatrix{
+		{1, 0, k, 0, k, 0},
+		{0, 1, k, 0, 0, k},
+	}
+}
+
+// validate returns an error if the matrix can't be applied to the passed
+// number of input channels.
+func (m ChannelMatrix) validate(numChans int) error {
+	if len(m) == 0 {
+		return errors.New("empty channel matrix")
+	}
+	for i, row := range m {
+		if len(row) == 0 {
+			return fmt.Errorf("channel %d of the channel matrix has no input", i)
+		}
+		if len(row) > numChans {
+			return fmt.Errorf("channel %d of the channel matrix uses %d channels, the file has %d", i, len(row), numChans)
+		}
+	}
+	return nil
+}
+
+// mixInts applies the matrix to the interleaved frames of src, which has
+// numChans channels, and stores the result in dst. The samples are clipped
+// to the passed bit depth.
+func (m ChannelMatrix) mixInts(dst, src []int, numChans, bitDepth int) {
+	for f := 0; f*numChans < len(src); f++ {
+		frame := src[f*numChans : (f+1)*numChans]
+		for i, row := range m {
+			var sum float64
+			for ch, c := range row {
+				if c == 0 {
+					continue
+				}
+				v := frame[ch]
+				// 8 bit samples are unsigned
+				if bitDepth == 8 {
+					v -= 128
+				}
+				sum += c * float64(v)
+			}
+			s, _ := clipInt(int(math.Round(sum)), bitDepth)
+			if bitDepth == 8 {
+				s += 128
+			}
+			dst[f*len(m)+i] = s
+		}
+	}
+}
+
+// mixFloat32s is the float version of mixInts, samples aren't clipped.
+func (m ChannelMatrix) mixFloat32s(dst, src []float32, numChans int) {
+	for f := 0; f*numChans < len(src); f++ {
+		frame := src[f*numChans : (f+1)*numChans]
+		for i, row := range m {
+			var sum float64
+			for ch, c := range row {
+				if c != 0 {
+					sum += c * float64(frame[ch])
+				}
+			}
+			dst[f*len(m)+i] = float32(sum)
+		}
+	}
+}
+
+// outChans returns the number of channels returned by the decoder, see
+// ChannelMatrix.
+func (d *Decoder) outChans() int {
+	if d.ChannelMatrix != nil {
+		return len(d.ChannelMatrix)
+	}
+	return int(d.NumChans)
+}
+
+// checkMappedBuffer returns an error if the channel matrix can't be applied
+// to the file or if a buffer of the passed length can't hold a mapped frame,
+// which would be mistaken for the end of the data.
+func (d *Decoder) checkMappedBuffer(length int) error {
+	if err := d.ChannelMatrix.validate(int(d.NumChans)); err != nil {
+		return err
+	}
+	if length < len(d.ChannelMatrix) {
+		return fmt.Errorf("a buffer of %d samples can't hold a frame of %d mapped channels", length, len(d.ChannelMatrix))
+	}
+	return nil
+}
+
+// decodeMappedInts decodes the next frames of the file into dst, mapping
+// their channels using the channel matrix.
+func (d *Decoder) decodeMappedInts(dst []int) (int, error) {
+	if d.WavAudioFormat == wavFormatIEEEFloat {
+		// the samples are the bits of the floats
+		return 0, errors.New("can't apply a channel matrix to the IEEE float samples of PCMBuffer, use PCMFloat32Buffer")
+	}
+	numChans := int(d.NumChans)
+	if err := d.checkMappedBuffer(len(dst)); err != nil {
+		return 0, err
+	}
+	size := len(dst) / len(d.ChannelMatrix) * numChans
+	if cap(d.chanInts) < size {
+		d.chanInts = make([]int, size)
+	}
+	n, err := d.decodePCMInts(d.chanInts[:size])
+	if err != nil {
+		return 0, err
+	}
+	// a trailing partial frame is ignored
+	frames := n / numChans
+	d.ChannelMatrix.mixInts(dst, d.chanInts[:frames*numChans], numChans, int(d.BitDepth))
+	return frames * len(d.ChannelMatrix), nil
+}
+
+// decodeMappedFloat32s is the float version of decodeMappedInts.
+func (d *Decoder) decodeMappedFloat32s(dst []float32) (int, error) {
+	numChans := int(d.NumChans)
+	if err := d.checkMappedBuffer(len(dst)); err != nil {
+		return 0, err
+	}
+	size := len(dst) / len(d.ChannelMatrix) * numChans
+	if cap(d.chanFloats) < size {
+		d.chanFloats = make([]float32, size)
+	}
+	n, err := d.decodePCMFloat32s(d.chanFloats[:size])
+	if err != nil {
+		return 0, err
+	}
+	frames := n / numChans
+	d.ChannelMatrix.mixFloat32s(dst, d.chanFloats[:frames*numChans], numChans)
+	return frames * len(d.ChannelMatrix), nil
+}
@@ -0,0 +1,240 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-audio/riff"
+)
+
+// Charset identifies the character encoding of the INFO strings.
+type Charset int
+
+const (
+	// CharsetUnknown is the default value. When decoding, INFO strings are
+	// kept as is if they are valid UTF-8 and converted using the decoder's
+	// CharsetFallback otherwise. When encoding, INFO strings are written as
+	// UTF-8 without CSET chunk.
+	CharsetUnknown Charset = iota
+	// CharsetUTF8 is the UTF-8 encoding (code page 65001).
+	CharsetUTF8
+	// CharsetASCII is the 7 bit US-ASCII encoding (code page 20127), the
+	// bytes outside of its range are decoded as U+FFFD.
+	CharsetASCII
+	// CharsetLatin1 is the ISO-8859-1 encoding (code page 28591).
+	CharsetLatin1
+	// CharsetWindows1252 is the Windows Western European encoding (code page
+	// 1252) used by most legacy Windows tools.
+	CharsetWindows1252
+)
+
+var charsetCodePages = map[Charset]uint16{
+	CharsetUTF8:        65001,
+	CharsetASCII:       20127,
+	CharsetLatin1:      28591,
+	CharsetWindows1252: 1252,
+}
+
+// CharsetFromCodePage returns the charset matching the passed Windows code
+// page, CharsetUnknown if the code page isn't supported.
+func CharsetFromCodePage(codePage uint16) Charset {
+	for cs, cp := range charsetCodePages {
+		if cp == codePage {
+			return cs
+		}
+	}
+	return CharsetUnknown
+}
+
+// CodePage returns the Windows code page of the charset, 0 if unknown.
+func (cs Charset) CodePage() uint16 {
+	return charsetCodePages[cs]
+}
+
+// String implements the Stringer interface.
+func (cs Charset) String() string {
+	switch cs {
+	case CharsetUTF8:
+		return "UTF-8"
+	case CharsetASCII:
+		return "US-ASCII"
+	case CharsetLatin1:
+		return "ISO-8859-1"
+	case CharsetWindows1252:
+		return "Windows-1252"
+	default:
+		return "unknown"
+	}
+}
+
+// windows1252 maps the 0x80-0x9F range of Windows-1252, the rest of the code
+// page matches ISO-8859-1. Undefined values are mapped to the C1 controls.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// decode converts text encoded using the charset into a Go (UTF-8) string.
+func (cs Charset) decode(b []byte) string {
+	switch cs {
+	case CharsetLatin1, CharsetWindows1252, CharsetASCII:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+			switch {
+			case c < 0x80:
+			case cs == CharsetASCII:
+				r[i] = utf8.RuneError
+			case cs == CharsetWindows1252 && c < 0xA0:
+				r[i] = windows1252[c-0x80]
+			}
+		}
+		return string(r)
+	default:
+		// invalid sequences are replaced by U+FFFD
+		return strings.ToValidUTF8(string(b), string(utf8.RuneError))
+	}
+}
+
+// encode converts a Go string using the charset, characters that can't be
+// represented are replaced by a question mark.
+func (cs Charset) encode(s string) []byte {
+	switch cs {
+	case CharsetLatin1, CharsetWindows1252, CharsetASCII:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, cs.encodeRune(r))
+		}
+		return b
+	default:
+		return []byte(s)
+	}
+}
+
+func (cs Charset) encodeRune(r rune) byte {
+	switch {
+	case r < 0x80:
+		return byte(r)
+	case cs == CharsetASCII:
+	case cs == CharsetLatin1 && r <= 0xFF:
+		return byte(r)
+	case cs == CharsetWindows1252:
+		if r >= 0xA0 && r <= 0xFF {
+			return byte(r)
+		}
+		for i, c := range windows1252 {
+			if c == r {
+				return byte(0x80 + i)
+			}
+		}
+	}
+	return '?'
+}
+
+// CharacterSet is the content of the CSET chunk which defines the code page
+// and language used by the text chunks. The INFO entries are decoded using
+// its code page even when the CSET chunk follows them.
+type CharacterSet struct {
+	CodePage    uint16
+	CountryCode uint16
+	Language    uint16
+	Dialect     uint16
+}
+
+// DecodeCSETChunk decodes a CSET chunk and puts the data in
+// Decoder.Metadata.CharacterSet.
+func DecodeCSETChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDCSET {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the CSET chunk - %w", err)
+		}
+		cset := &CharacterSet{}
+		if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, cset); err != nil {
+			return fmt.Errorf("failed to decode the CSET chunk - %w", err)
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.CharacterSet = cset
+		if len(d.infoLists) > 0 {
+			// the INFO entries read before were decoded without the code page
+			d.decodeInfo()
+		}
+		for _, disp := range d.Metadata.Displays {
+			disp.setCharset(d)
+		}
+	}
+	ch.Drain()
+	return nil
+}
+
+// infoCharset returns the charset to use to decode the passed INFO string.
+func (d *Decoder) infoCharset(b []byte) Charset {
+	if d.Metadata != nil && d.Metadata.CharacterSet != nil {
+		if cs := CharsetFromCodePage(d.Metadata.CharacterSet.CodePage); cs != CharsetUnknown {
+			return cs
+		}
+	}
+	if utf8.Valid(b) {
+		return CharsetUTF8
+	}
+	if d.CharsetFallback == CharsetUnknown {
+		return CharsetWindows1252
+	}
+	return d.CharsetFallback
+}
+
+// infoCharset returns the charset used to encode the INFO strings.
+func (e *Encoder) infoCharset() Charset {
+	if e.InfoCharset == CharsetUnknown && e.Metadata != nil && e.Metadata.CharacterSet != nil {
+		return CharsetFromCodePage(e.Metadata.CharacterSet.CodePage)
+	}
+	return e.InfoCharset
+}
+
+// checkInfoCharset returns an error if the INFO strings should be written
+// using the code page of Metadata.CharacterSet but it isn't supported.
+func (e *Encoder) checkInfoCharset() error {
+	if e.InfoCharset != CharsetUnknown || e.Metadata == nil || e.Metadata.CharacterSet == nil {
+		return nil
+	}
+	if cp := e.Metadata.CharacterSet.CodePage; cp != 0 && CharsetFromCodePage(cp) == CharsetUnknown {
+		return fmt.Errorf("can't write the INFO strings using the unsupported code page %d of the CSET chunk, set InfoCharset or remove Metadata.CharacterSet", cp)
+	}
+	return nil
+}
+
+// encodeCSETChunk returns the content of the CSET chunk, nil if the INFO
+// strings don't need one.
+func encodeCSETChunk(e *Encoder) []byte {
+	if e == nil || (e.Metadata == nil && !e.hasCues()) {
+		return nil
+	}
+	cs := e.infoCharset()
+	if cs == CharsetUnknown || cs == CharsetASCII {
+		return nil
+	}
+	cset := CharacterSet{}
+	if e.Metadata != nil && e.Metadata.CharacterSet != nil {
+		cset = *e.Metadata.CharacterSet
+	}
+	cset.CodePage = cs.CodePage()
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, cset)
+	return buf.Bytes()
+}
@@ -0,0 +1,121 @@
+package wav
+
+import (
+	"fmt"
+	"math"
+)
+
+// ClipStats reports the samples clipped by an encoder because they were out
+// of the range of its format.
+type ClipStats struct {
+	// Channels contains the number of clipped samples of each channel.
+	Channels []int
+	// Overs contains the positions of the first clipped samples, up to
+	// Encoder.MaxOvers.
+	Overs []Over
+}
+
+// Over is the position of a clipped sample.
+type Over struct {
+	Frame   int
+	Channel int
+}
+
+// Clipped returns the total number of clipped samples.
+func (s ClipStats) Clipped() int {
+	var n int
+	for _, c := range s.Channels {
+		n += c
+	}
+	return n
+}
+
+// ClipStats returns the samples clipped so far. The counts are final once the
+// encoder is closed.
+func (e *Encoder) ClipStats() ClipStats {
+	return e.clips
+}
+
+// clipped records a clipped sample, returning an error wrapping ErrClipped
+// when FailOnClip is set.
+func (e *Encoder) clipped(frame, ch int) error {
+	if e.clips.Channels == nil {
+		e.clips.Channels = make([]int, e.NumChans)
+	}
+	if ch < len(e.clips.Channels) {
+		e.clips.Channels[ch]++
+	}
+	if len(e.clips.Overs) < e.MaxOvers {
+		e.clips.Overs = append(e.clips.Overs, Over{Frame: frame, Channel: ch})
+	}
+	if e.FailOnClip {
+		return fmt.Errorf("sample of frame %d, channel %d - %w", frame, ch, ErrClipped)
+	}
+	return nil
+}
+
+// clipInts clips the samples of src, starting at the passed frame, to the
+// range of the bit depth of the encoder. src is returned as is when no sample
+// is out of range, a slice reused across calls otherwise.
+func (e *Encoder) clipInts(src []int, numChans, frame int) ([]int, error) {
+	if e.WavAudioFormat == wavFormatIEEEFloat || e.BitDepth < 8 || e.BitDepth > 32 {
+		return src, nil
+	}
+	if numChans < 1 {
+		numChans = 1
+	}
+	// 8 bit samples are unsigned
+	min, max := -(1 << uint(e.BitDepth-1)), 1<<uint(e.BitDepth-1)-1
+	if e.BitDepth == 8 {
+		min, max = 0, 255
+	}
+	dst, copied := src, false
+	for i, v := range src {
+		if v >= min && v <= max {
+			if copied {
+				dst[i] = v
+			}
+			continue
+		}
+		if !copied {
+			// the samples of the caller aren't modified
+			if cap(e.convBuf) < len(src) {
+				e.convBuf = make([]int, len(src))
+			}
+			dst, copied = e.convBuf[:len(src)], true
+			copy(dst, src[:i])
+		}
+		if v < min {
+			dst[i] = min
+		} else {
+			dst[i] = max
+		}
+		if err := e.clipped(frame+i/numChans, i%numChans); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// clipFloats records the samples of src, starting at the passed frame, that
+// are clipped when written. For IEEE float files, the samples beyond full
+// scale are reported although they aren't clipped.
+func (e *Encoder) clipFloats(src []float64, numChans, frame int) error {
+	if numChans < 1 {
+		numChans = 1
+	}
+	// the samples are clipped once rounded out of range
+	max := float64(int64(1) << uint(e.BitDepth-1))
+	hi, lo := (max-0.5)/max, (-max-0.5)/max
+	if e.WavAudioFormat == wavFormatIEEEFloat {
+		hi, lo = math.Nextafter(1, 2), math.Nextafter(-1, -2)
+	}
+	for i, v := range src {
+		if v >= hi || v <= lo {
+			if err := e.clipped(frame+i/numChans, i%numChans); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
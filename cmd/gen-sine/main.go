@@ -25,11 +25,15 @@ func main() {
 	const sampleRate = 48000
 	wavOut := wav.NewEncoder(f, sampleRate, 16, 1, 1)
 	numSamples := int(sampleRate * *length)
-	defer wavOut.Close()
 
+	frame := make([]float64, 1)
 	for i := 0; i < numSamples; i++ {
-		fv := math.Sin(float64(i) / sampleRate * *frequency * 2 * math.Pi)
-		v := uint16(fv * 32767)
-		wavOut.WriteFrame(v)
+		frame[0] = math.Sin(float64(i) / sampleRate * *frequency * 2 * math.Pi)
+		if err := wavOut.WriteFloatFrame(frame); err != nil {
+			log.Fatalf("error writing frame %d: %s", i, err)
+		}
+	}
+	if err := wavOut.Close(); err != nil {
+		log.Fatalf("error closing %s: %s", *output, err)
 	}
 }
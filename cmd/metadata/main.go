@@ -2,6 +2,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -9,17 +10,28 @@ import (
 	"github.com/go-audio/wav"
 )
 
+var flagJSON = flag.Bool("json", false, "print the metadata as JSON")
+
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		fmt.Println("You must pass the pass the path of the file to decode")
 		os.Exit(1)
 	}
-	f, err := os.Open(os.Args[1])
+	f, err := os.Open(flag.Arg(0))
 	if err != nil {
 		panic(err)
 	}
 	defer f.Close()
 	dec := wav.NewDecoder(f)
+	if *flagJSON {
+		b, err := dec.MetadataJSON()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
 	dec.ReadMetadata()
 	if err := dec.Err(); err != nil {
 		log.Fatal(err)
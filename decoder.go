@@ -1,7 +1,6 @@
 package wav
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -21,6 +20,40 @@ var (
 	CIDInfo = []byte{'I', 'N', 'F', 'O'}
 	// CIDCue is the chunk ID for the cue chunk
 	CIDCue = [4]byte{'c', 'u', 'e', 0x20}
+	// CIDID3 is the chunk ID for an ID3v2 tag chunk
+	CIDID3 = [4]byte{'i', 'd', '3', 0x20}
+	// CIDID3Upper is the upper case variant of the ID3v2 tag chunk ID
+	CIDID3Upper = [4]byte{'I', 'D', '3', 0x20}
+	// CIDXMP is the chunk ID for the XMP packet chunk
+	CIDXMP = [4]byte{'_', 'P', 'M', 'X'}
+	// CIDCSET is the chunk ID for the character set chunk
+	CIDCSET = [4]byte{'C', 'S', 'E', 'T'}
+	// CIDLevl is the chunk ID for the peak envelope chunk
+	CIDLevl = [4]byte{'l', 'e', 'v', 'l'}
+	// CIDPeak is the chunk ID for the PEAK chunk
+	CIDPeak = [4]byte{'P', 'E', 'A', 'K'}
+	// CIDMD5 is the chunk ID for the PCM data checksum chunk
+	CIDMD5 = [4]byte{'M', 'D', '5', 0x20}
+	// CIDFact is the chunk ID for the fact chunk
+	CIDFact = [4]byte{'f', 'a', 'c', 't'}
+	// CIDPlst is the chunk ID for the play list chunk
+	CIDPlst = [4]byte{'p', 'l', 's', 't'}
+	// CIDSlnt is the chunk ID for the silence chunk
+	CIDSlnt = [4]byte{'s', 'l', 'n', 't'}
+	// CIDWavl is the list type of a wave list made of data and slnt chunks
+	CIDWavl = [4]byte{'w', 'a', 'v', 'l'}
+	// CIDAdtl is the list type of the associated data list
+	CIDAdtl = [4]byte{'a', 'd', 't', 'l'}
+	// CIDBext is the chunk ID for the broadcast extension chunk
+	CIDBext = [4]byte{'b', 'e', 'x', 't'}
+	// CIDIXML is the chunk ID for the iXML chunk
+	CIDIXML = [4]byte{'i', 'X', 'M', 'L'}
+	// CIDChna is the chunk ID for the ADM track allocation chunk
+	CIDChna = [4]byte{'c', 'h', 'n', 'a'}
+	// CIDAxml is the chunk ID for the ADM XML chunk
+	CIDAxml = [4]byte{'a', 'x', 'm', 'l'}
+	// CIDDisp is the chunk ID for the display chunk
+	CIDDisp = [4]byte{'D', 'I', 'S', 'P'}
 )
 
 // Decoder handles the decoding of wav files.
@@ -42,6 +75,36 @@ type Decoder struct {
 	PCMChunk *riff.Chunk
 	// Metadata for the current file
 	Metadata *Metadata
+	// CharsetFallback is the charset used to decode the INFO strings that
+	// aren't valid UTF-8 when the file doesn't have a CSET chunk.
+	// Windows-1252 is used when not set.
+	CharsetFallback Charset
+
+	// factSampleLength is the number of frames found in the fact chunk.
+	factSampleLength uint32
+	hasFact          bool
+	// pcmStart is the position of the PCM data in the reader.
+	pcmStart int64
+	// waveList is set when the PCM data is stored in a wave list.
+	waveList *waveList
+	// infoLists contains the entries of the LIST INFO chunks read so far.
+	infoLists []infoList
+	// metadataRead is true once ReadMetadata was called.
+	metadataRead bool
+	// pcmBuf is reused across calls to read the PCM data.
+	pcmBuf []byte
+
+	// ChannelMatrix, when set, selects, reorders or mixes the channels of the
+	// file into the channels returned by PCMBuffer, PCMFloat32Buffer and
+	// FullPCMBuffer, see SelectChannels and Downmix51ToStereo. Format then
+	// reports the number of output channels while NumChans is still the
+	// number of channels of the file. The channels of IEEE float files are
+	// only mixed by PCMFloat32Buffer.
+	ChannelMatrix ChannelMatrix
+	// chanInts and chanFloats are reused across calls to read the frames
+	// mixed by the channel matrix.
+	chanInts   []int
+	chanFloats []float32
 }
 
 // NewDecoder creates a decoder for the passed wav reader.
@@ -61,21 +124,28 @@ func (d *Decoder) Seek(offset int64, whence int) (int64, error) {
 // Rewind allows the decoder to be rewound to the beginning of the PCM data.
 // This is useful if you want to keep on decoding the same file in a loop.
 func (d *Decoder) Rewind() error {
+	if err := d.restart(); err != nil {
+		return err
+	}
+	if err := d.FwdToPCM(); err != nil {
+		return fmt.Errorf("failed to seek to the PCM data: %w", err)
+	}
+	return nil
+}
 
-	_, err := d.r.Seek(0, io.SeekStart)
-	if err != nil {
+// restart moves the decoder back to the start of the file so the headers are
+// read again.
+func (d *Decoder) restart() error {
+	if _, err := d.r.Seek(0, io.SeekStart); err != nil {
 		return fmt.Errorf("failed to seek back to the start %w", err)
 	}
 	// we have to user a new parser since it's read only and can't be seeked
 	d.parser = riff.New(d.r)
 	d.pcmDataAccessed = false
 	d.PCMChunk = nil
+	d.waveList = nil
 	d.err = nil
 	d.NumChans = 0
-	err = d.FwdToPCM()
-	if err != nil {
-		return fmt.Errorf("failed to seek to the PCM data: %w", err)
-	}
 	return nil
 }
 
@@ -139,12 +209,30 @@ func (d *Decoder) ReadInfo() {
 // ReadMetadata parses the file for extra metadata such as the INFO list chunk.
 // The entire file will be read and should be rewinded if more data must be
 // accessed.
+//
+// Markers, Regions, TimeReference, MetadataJSON and the methods built on them
+// call ReadMetadata if needed and then move the decoder back to where it was
+// in the PCM data, at its start if it wasn't being read.
 func (d *Decoder) ReadMetadata() {
-	if d.Metadata != nil {
+	if d.metadataRead {
 		return
 	}
+	d.metadataRead = true
+	if d.NumChans > 0 {
+		if d.stream() != nil {
+			// streams can't go back, the chunks following the PCM data are
+			// read.
+			if d.PCMChunk != nil {
+				io.Copy(io.Discard, d.PCMChunk.R)
+			}
+		} else if d.err = d.restart(); d.err != nil {
+			// the headers were already read, start over to not miss the
+			// chunks preceding the current position.
+			return
+		}
+	}
 	d.ReadInfo()
-	if d.Err() != nil || d.Metadata != nil {
+	if d.Err() != nil {
 		return
 	}
 	var (
@@ -156,6 +244,11 @@ func (d *Decoder) ReadMetadata() {
 		if err != nil {
 			break
 		}
+		if chunk.ID == riff.DataFormatID && d.isUnknownSize(uint32(chunk.Size)) {
+			// the PCM data goes until the end of the stream
+			io.Copy(io.Discard, d.r)
+			break
+		}
 
 		switch chunk.ID {
 		case CIDList:
@@ -180,6 +273,84 @@ func (d *Decoder) ReadMetadata() {
 					d.err = err
 				}
 			}
+		case CIDID3, CIDID3Upper:
+			if err = DecodeID3Chunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDXMP:
+			if err = DecodeXMPChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDCSET:
+			if err = DecodeCSETChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDLevl:
+			if err = DecodeLevlChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDPeak:
+			if err = DecodePeakChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDFact:
+			if err = DecodeFactChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDPlst:
+			if err = DecodePlayListChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDMD5:
+			if err = DecodeMD5Chunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDBext:
+			if err = DecodeBextChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDIXML:
+			if err = DecodeIXMLChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDChna:
+			if err = DecodeChnaChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDAxml:
+			if err = DecodeAxmlChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDDisp:
+			if err = DecodeDISPChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
 		default:
 			// fmt.Println(string(chunk.ID[:]))
 			chunk.Drain()
@@ -188,6 +359,33 @@ func (d *Decoder) ReadMetadata() {
 
 }
 
+// loadMetadata reads the metadata for the methods listed by ReadMetadata.
+func (d *Decoder) loadMetadata() error {
+	// ReadMetadata starts over from the headers, losing the position in the
+	// PCM data
+	offset := 0
+	if !d.metadataRead && d.WasPCMAccessed() && d.stream() == nil {
+		var err error
+		if offset, err = d.pcmOffset(); err != nil {
+			return err
+		}
+	}
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		return err
+	}
+	if d.WasPCMAccessed() {
+		return nil
+	}
+	if err := d.Rewind(); err != nil {
+		return err
+	}
+	if offset > 0 {
+		return d.seekOffset(offset)
+	}
+	return nil
+}
+
 // FwdToPCM forwards the underlying reader until the start of the PCM chunk.
 // If the PCM chunk was already read, no data will be found (you need to rewind).
 func (d *Decoder) FwdToPCM() error {
@@ -199,19 +397,46 @@ func (d *Decoder) FwdToPCM() error {
 		return nil
 	}
 
-	var chunk *riff.Chunk
+	var (
+		chunk *riff.Chunk
+		size  int64
+	)
 	for d.err == nil {
-		chunk, d.err = d.NextChunk()
+		chunk, size, d.err = d.nextChunk()
 		if d.err != nil {
 			return d.err
 		}
 		if chunk.ID == riff.DataFormatID {
-			d.PCMSize = chunk.Size
+			d.PCMSize = int(size)
+			if int64(chunk.Size) != size {
+				// the padding byte of odd sizes isn't part of the PCM data
+				chunk.R = io.LimitReader(d.r, size)
+			}
 			d.PCMChunk = chunk
+			d.pcmStart, d.err = d.r.Seek(0, io.SeekCurrent)
 			break
 		}
 		if chunk.ID == CIDList {
+			// the PCM data might be split into the segments of a wave list
+			isWaveList, err := d.isWaveList()
+			if err != nil {
+				d.err = err
+				return err
+			}
+			if isWaveList {
+				if d.err = d.decodeWaveList(chunk); d.err != nil {
+					return d.err
+				}
+				break
+			}
+		}
+		switch chunk.ID {
+		case CIDList:
 			DecodeListChunk(d, chunk)
+		case CIDCSET:
+			DecodeCSETChunk(d, chunk)
+		case CIDFact:
+			DecodeFactChunk(d, chunk)
 		}
 		chunk.Drain()
 	}
@@ -223,6 +448,53 @@ func (d *Decoder) FwdToPCM() error {
 	return nil
 }
 
+// seekFrame moves the PCM reader to the passed frame.
+func (d *Decoder) seekFrame(frame int) error {
+	return d.seekOffset(frame * d.blockAlign())
+}
+
+// pcmOffset returns the position of the PCM reader in bytes.
+func (d *Decoder) pcmOffset() (int, error) {
+	if d.waveList != nil {
+		return d.waveList.offset(), nil
+	}
+	pos, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	return int(pos - d.pcmStart), nil
+}
+
+// seekOffset moves the PCM reader to the passed position in bytes.
+func (d *Decoder) seekOffset(offset int) error {
+	if !d.WasPCMAccessed() {
+		if err := d.FwdToPCM(); err != nil {
+			return err
+		}
+	}
+	if d.PCMChunk == nil {
+		return ErrPCMChunkNotFound
+	}
+	if offset > d.PCMSize {
+		offset = d.PCMSize
+	}
+	d.PCMChunk.Pos = offset
+	if d.waveList != nil {
+		d.waveList.seek(offset)
+		return nil
+	}
+	if _, err := d.r.Seek(d.pcmStart+int64(offset), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to offset %d - %w", offset, err)
+	}
+	d.PCMChunk.R = io.LimitReader(d.r, int64(d.PCMSize-offset))
+	return nil
+}
+
+// blockAlign returns the size of a frame in bytes.
+func (d *Decoder) blockAlign() int {
+	return int(d.NumChans) * ((int(d.BitDepth) + 7) / 8)
+}
+
 // WasPCMAccessed returns positively if the PCM data was previously accessed.
 func (d *Decoder) WasPCMAccessed() bool {
 	if d == nil {
@@ -245,37 +517,26 @@ func (d *Decoder) FullPCMBuffer() (*audio.IntBuffer, error) {
 		return nil, errors.New("PCM chunk not found")
 	}
 	format := &audio.Format{
-		NumChannels: int(d.NumChans),
+		NumChannels: d.outChans(),
 		SampleRate:  int(d.SampleRate),
 	}
 
-	buf := &audio.IntBuffer{Data: make([]int, 4096), Format: format, SourceBitDepth: int(d.BitDepth)}
-	bytesPerSample := (d.BitDepth-1)/8 + 1
-	sampleBufData := make([]byte, bytesPerSample)
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return nil, fmt.Errorf("could not get sample decode func %w", err)
-	}
-
-	i := 0
-	for err == nil {
-		buf.Data[i], err = decodeF(d.PCMChunk, sampleBufData)
-		if err != nil {
-			break
+	buf := &audio.IntBuffer{Format: format, SourceBitDepth: int(d.BitDepth)}
+	data := make([]int, 4096)
+	if d.ChannelMatrix != nil {
+		if err := d.ChannelMatrix.validate(int(d.NumChans)); err != nil {
+			return nil, err
 		}
-		i++
-		// grow the underlying slice if needed
-		if i == len(buf.Data) {
-			buf.Data = append(buf.Data, make([]int, 4096)...)
+		// whole frames are read
+		data = data[:len(data)/len(d.ChannelMatrix)*len(d.ChannelMatrix)]
+	}
+	for {
+		n, err := d.nextInts(data)
+		buf.Data = append(buf.Data, data[:n]...)
+		if err != nil || n == 0 {
+			return buf, err
 		}
 	}
-	buf.Data = buf.Data[:i]
-
-	if errors.Is(err, io.EOF) {
-		err = nil
-	}
-
-	return buf, err
 }
 
 // PCMBuffer populates the passed PCM buffer
@@ -294,58 +555,89 @@ func (d *Decoder) PCMBuffer(buf *audio.IntBuffer) (n int, err error) {
 		return 0, ErrPCMChunkNotFound
 	}
 
-	format := &audio.Format{
-		NumChannels: int(d.NumChans),
-		SampleRate:  int(d.SampleRate),
+	// the format is only replaced when it changes to not allocate on every
+	// call
+	if f := buf.Format; f == nil || f.NumChannels != d.outChans() || f.SampleRate != int(d.SampleRate) {
+		buf.Format = &audio.Format{
+			NumChannels: d.outChans(),
+			SampleRate:  int(d.SampleRate),
+		}
 	}
-
 	buf.SourceBitDepth = int(d.BitDepth)
-	decodeF, err := sampleDecodeFunc(int(d.BitDepth))
-	if err != nil {
-		return 0, fmt.Errorf("could not get sample decode func %w", err)
+
+	// Note that we populate the buffer even if the
+	// size of the buffer doesn't fit an even number of frames.
+	return d.nextInts(buf.Data)
+}
+
+// nextInts decodes the next samples into dst, mapping their channels when a
+// channel matrix is set.
+func (d *Decoder) nextInts(dst []int) (int, error) {
+	if d.ChannelMatrix != nil {
+		return d.decodeMappedInts(dst)
 	}
+	return d.decodePCMInts(dst)
+}
 
-	bPerSample := bytesPerSample(int(d.BitDepth))
-	// populate a file buffer to avoid multiple very small reads
-	// we need to cap the buffer size to not be bigger than the pcm chunk.
-	size := len(buf.Data) * bPerSample
-	tmpBuf := make([]byte, size)
-	var m int
-	m, err = d.PCMChunk.R.Read(tmpBuf)
+// decodePCMInts reads and decodes the next PCM samples into dst, returning
+// the number of decoded samples, 0 once all the data was read.
+func (d *Decoder) decodePCMInts(dst []int) (int, error) {
+	src, err := d.readPCM(len(dst) * bytesPerSample(int(d.BitDepth)))
 	if err != nil {
-		if errors.Is(err, io.EOF) {
-			return m, nil
-		}
-		return m, err
+		return 0, err
 	}
-	if m == 0 {
-		return m, nil
+	// a trailing partial sample is just padding
+	n, err := decodeInts(dst, src, int(d.BitDepth))
+	if err != nil {
+		return 0, fmt.Errorf("could not get sample decode func %w", err)
 	}
-	bufR := bytes.NewReader(tmpBuf[:m])
-	sampleBuf := make([]byte, bPerSample, bPerSample)
-	var misaligned bool
-	if m%bPerSample > 0 {
-		misaligned = true
+	return n, nil
+}
+
+// PCMFloat32Buffer populates the passed buffer with the next samples of the
+// PCM data and returns the number of samples read. Integer samples are
+// normalized to the [-1, 1) range while the samples of IEEE float files are
+// kept as is.
+func (d *Decoder) PCMFloat32Buffer(buf *audio.Float32Buffer) (n int, err error) {
+	if buf == nil {
+		return 0, nil
 	}
 
-	// Note that we populate the buffer even if the
-	// size of the buffer doesn't fit an even number of frames.
-	for n = 0; n < len(buf.Data); n++ {
-		buf.Data[n], err = decodeF(bufR, sampleBuf)
+	if !d.pcmDataAccessed {
+		err := d.FwdToPCM()
 		if err != nil {
-			// the last sample isn't a full sample but just padding.
-			if misaligned {
-				n--
-			}
-			break
+			return 0, d.err
 		}
 	}
-	buf.Format = format
-	if errors.Is(err, io.EOF) {
-		err = nil
+	if d.PCMChunk == nil {
+		return 0, ErrPCMChunkNotFound
 	}
 
-	return n, err
+	if f := buf.Format; f == nil || f.NumChannels != d.outChans() || f.SampleRate != int(d.SampleRate) {
+		buf.Format = &audio.Format{
+			NumChannels: d.outChans(),
+			SampleRate:  int(d.SampleRate),
+		}
+	}
+	buf.SourceBitDepth = int(d.BitDepth)
+
+	if d.ChannelMatrix != nil {
+		return d.decodeMappedFloat32s(buf.Data)
+	}
+	return d.decodePCMFloat32s(buf.Data)
+}
+
+// decodePCMFloat32s is the float version of decodePCMInts.
+func (d *Decoder) decodePCMFloat32s(dst []float32) (int, error) {
+	src, err := d.readPCM(len(dst) * bytesPerSample(int(d.BitDepth)))
+	if err != nil {
+		return 0, err
+	}
+	n, err := decodeFloat32s(dst, src, int(d.BitDepth), d.WavAudioFormat == wavFormatIEEEFloat)
+	if err != nil {
+		return 0, fmt.Errorf("could not get sample decode func %w", err)
+	}
+	return n, nil
 }
 
 // Format returns the audio format of the decoded content.
@@ -354,16 +646,23 @@ func (d *Decoder) Format() *audio.Format {
 		return nil
 	}
 	return &audio.Format{
-		NumChannels: int(d.NumChans),
+		NumChannels: d.outChans(),
 		SampleRate:  int(d.SampleRate),
 	}
 }
 
 // NextChunk returns the next available chunk
 func (d *Decoder) NextChunk() (*riff.Chunk, error) {
+	c, _, err := d.nextChunk()
+	return c, err
+}
+
+// nextChunk returns the next available chunk and its size without the
+// padding byte of the chunks of odd size.
+func (d *Decoder) nextChunk() (*riff.Chunk, int64, error) {
 	if d.err = d.readHeaders(); d.err != nil {
 		d.err = fmt.Errorf("failed to read header - %v", d.err)
-		return nil, d.err
+		return nil, 0, d.err
 	}
 
 	var (
@@ -374,9 +673,18 @@ func (d *Decoder) NextChunk() (*riff.Chunk, error) {
 	id, size, d.err = d.parser.IDnSize()
 	if d.err != nil {
 		d.err = fmt.Errorf("error reading chunk header - %v", d.err)
-		return nil, d.err
+		return nil, 0, d.err
 	}
 
+	if id == riff.DataFormatID && d.isUnknownSize(size) {
+		c, err := d.unknownSizeDataChunk()
+		if err != nil {
+			return nil, 0, err
+		}
+		return c, int64(c.Size), nil
+	}
+	unpadded := int64(size)
+
 	// TODO: any reason we don't use d.parser.NextChunk (riff.NextChunk) here?
 	// It correctly handles the misaligned chunk.
 
@@ -393,14 +701,23 @@ func (d *Decoder) NextChunk() (*riff.Chunk, error) {
 		Size: int(size),
 		R:    io.LimitReader(d.r, int64(size)),
 	}
-	return c, d.err
+	return c, unpadded, d.err
 }
 
-// Duration returns the time duration for the current audio container
+// Duration returns the time duration for the current audio container.
+// The duration of non PCM files is based on the sample length found in the
+// fact chunk, which is read without moving the decoder. Streaming decoders
+// are forwarded to the PCM data instead.
 func (d *Decoder) Duration() (time.Duration, error) {
 	if d == nil || d.parser == nil {
 		return 0, errors.New("can't calculate the duration of a nil pointer")
 	}
+	if d.err = d.readHeaders(); d.err != nil {
+		return 0, d.err
+	}
+	if dur, ok := d.factDuration(); ok {
+		return dur, nil
+	}
 	return d.parser.Duration()
 }
 
@@ -415,6 +732,13 @@ func (d *Decoder) readHeaders() error {
 		return nil
 	}
 
+	if s := d.stream(); s != nil {
+		// the chunks preceding the fmt chunk are kept in memory to be read
+		// again
+		s.keep = true
+		defer func() { s.keep = false }()
+	}
+
 	id, size, err := d.parser.IDnSize()
 	if err != nil {
 		return err
@@ -423,6 +747,10 @@ func (d *Decoder) readHeaders() error {
 	if d.parser.ID != riff.RiffID {
 		return fmt.Errorf("%s - %s", d.parser.ID, riff.ErrFmtNotSupported)
 	}
+	if d.isUnknownSize(size) {
+		// streaming writer placeholder
+		size = 0
+	}
 	d.parser.Size = size
 	if err := binary.Read(d.r, binary.BigEndian, &d.parser.Format); err != nil {
 		return err
@@ -459,6 +787,9 @@ func (d *Decoder) readHeaders() error {
 		} else if chunk.ID == CIDSmpl {
 			DecodeSamplerChunk(d, chunk)
 			rewindBytes += int64(chunk.Size) + 8
+		} else if chunk.ID == CIDCSET {
+			DecodeCSETChunk(d, chunk)
+			rewindBytes += int64(chunk.Size) + 8
 		} else {
 			// unexpected chunk order, might be a bext chunk
 			rewindBytes += int64(chunk.Size) + 8
@@ -473,71 +804,3 @@ func (d *Decoder) readHeaders() error {
 func bytesPerSample(bitDepth int) int {
 	return bitDepth / 8
 }
-
-// sampleDecodeFunc returns a function that can be used to convert
-// a byte range into an int value based on the amount of bits used per sample.
-// Note that 8bit samples are unsigned, all other values are signed.
-func sampleDecodeFunc(bitsPerSample int) (func(io.Reader, []byte) (int, error), error) {
-	// NOTE: WAV PCM data is stored using little-endian
-	switch bitsPerSample {
-	case 8:
-		// 8bit values are unsigned
-		return func(r io.Reader, buf []byte) (int, error) {
-			_, err := r.Read(buf[:1])
-			return int(buf[0]), err
-		}, nil
-	case 16:
-		return func(r io.Reader, buf []byte) (int, error) {
-			_, err := r.Read(buf[:2])
-			return int(int16(binary.LittleEndian.Uint16(buf[:2]))), err
-		}, nil
-	case 24:
-		// -34,359,738,367 (0x7FFFFF) to 34,359,738,368	(0x800000)
-		return func(r io.Reader, buf []byte) (int, error) {
-			_, err := r.Read(buf[:3])
-			if err != nil {
-				return 0, err
-			}
-			return int(audio.Int24LETo32(buf[:3])), nil
-		}, nil
-	case 32:
-		return func(r io.Reader, buf []byte) (int, error) {
-			_, err := r.Read(buf[:4])
-			return int(int32(binary.LittleEndian.Uint32(buf[:4]))), err
-		}, nil
-	default:
-		return nil, fmt.Errorf("unhandled byte depth:%d", bitsPerSample)
-	}
-}
-
-// sampleDecodeFloat64Func returns a function that can be used to convert
-// a byte range into a float64 value based on the amount of bits used per sample.
-func sampleFloat64DecodeFunc(bitsPerSample int) (func([]byte) float64, error) {
-	bytesPerSample := bitsPerSample / 8
-	switch bytesPerSample {
-	case 1:
-		// 8bit values are unsigned
-		return func(s []byte) float64 {
-			return float64(uint8(s[0]))
-		}, nil
-	case 2:
-		return func(s []byte) float64 {
-			return float64(int(s[0]) + int(s[1])<<8)
-		}, nil
-	case 3:
-		return func(s []byte) float64 {
-			var output int32
-			output |= int32(s[2]) << 0
-			output |= int32(s[1]) << 8
-			output |= int32(s[0]) << 16
-			return float64(output)
-		}, nil
-	case 4:
-		// TODO: fix the float64 conversion (current int implementation)
-		return func(s []byte) float64 {
-			return float64(int(s[0]) + int(s[1])<<8 + int(s[2])<<16 + int(s[3])<<24)
-		}, nil
-	default:
-		return nil, fmt.Errorf("unhandled byte depth:%d", bitsPerSample)
-	}
-}
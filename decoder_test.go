@@ -1,10 +1,18 @@
 package wav
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/go-audio/audio"
@@ -398,3 +406,804 @@ func totaledDecoder(d *Decoder) (total int64, err error) {
 
 	return total, err
 }
+
+func TestPlayListReader(t *testing.T) {
+	cuePoint := func(id string, dataChunkID string, frame uint32) []byte {
+		b := append([]byte(id), le32(0)...)
+		b = append(b, dataChunkID...)
+		// chunk start, block start, sample offset
+		return append(b, le32(0, 0, frame)...)
+	}
+	// 16 bit mono PCM data: 0, 1, 2 ... 9
+	pcm := make([]byte, 20)
+	for i := 0; i < 10; i++ {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(i))
+	}
+	cue := append(le32(2), cuePoint("cue1", "data", 2)...)
+	cue = append(cue, cuePoint("cue2", "slnt", 0)...)
+	plst := append(le32(4), "cue1"...)
+	plst = append(plst, le32(3, 2)...)
+	// segments without loops aren't played
+	plst = append(plst, "cue1"...)
+	plst = append(plst, le32(5, 0)...)
+	plst = append(plst, "cue2"...)
+	plst = append(plst, le32(2, 1)...)
+	plst = append(plst, "cue1"...)
+	plst = append(plst, le32(1, 1)...)
+
+	body := append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+	body = append(body, chunk("data", pcm)...)
+	body = append(body, chunk("slnt", le32(2))...)
+	body = append(body, chunk("cue ", cue)...)
+	body = append(body, chunk("plst", plst)...)
+	file := chunk("RIFF", body)
+
+	d := NewDecoder(bytes.NewReader(file))
+	r, err := NewPlayListReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []*PlaySegment{
+		{CueID: [4]byte{'c', 'u', 'e', '1'}, Length: 3, Loops: 2},
+		{CueID: [4]byte{'c', 'u', 'e', '1'}, Length: 5, Loops: 0},
+		{CueID: [4]byte{'c', 'u', 'e', '2'}, Length: 2, Loops: 1},
+		{CueID: [4]byte{'c', 'u', 'e', '1'}, Length: 1, Loops: 1},
+	}; !reflect.DeepEqual(d.Metadata.PlayList, expected) {
+		t.Fatalf("expected play list %+v, got %+v", expected, d.Metadata.PlayList)
+	}
+	var got []int
+	// small buffer to cross segment boundaries
+	buf := &audio.IntBuffer{Data: make([]int, 4)}
+	for {
+		n, err := r.PCMBuffer(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, buf.Data[:n]...)
+	}
+	if expected := []int{2, 3, 4, 2, 3, 4, 0, 0, 2}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	// the slnt cue points of wave lists are resolved in the list, a segment
+	// going past the slnt chunk continues with the following data chunk
+	wavl := append([]byte("wavl"), chunk("data", []byte{1, 0, 2, 0})...)
+	wavl = append(wavl, chunk("slnt", le32(1))...)
+	wavl = append(wavl, chunk("data", []byte{7, 0, 8, 0})...)
+	cue = append(le32(2), cuePoint("cue1", "data", 1)...)
+	cue = append(cue, "cue2"...)
+	cue = append(cue, le32(0)...)
+	cue = append(cue, "slnt"...)
+	cue = append(cue, le32(12, 0, 0)...)
+	plst = append(le32(2), "cue2"...)
+	plst = append(plst, le32(3, 1)...)
+	plst = append(plst, "cue1"...)
+	plst = append(plst, le32(1, 1)...)
+	body = append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+	body = append(body, chunk("LIST", wavl)...)
+	body = append(body, chunk("cue ", cue)...)
+	body = append(body, chunk("plst", plst)...)
+	if r, err = NewPlayListReader(NewDecoder(bytes.NewReader(chunk("RIFF", body)))); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for {
+		n, err := r.PCMBuffer(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, buf.Data[:n]...)
+	}
+	if expected := []int{0, 7, 8, 2}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	// without play list the PCM data is read as is
+	d = NewDecoder(bytes.NewReader(wavWithChunks()))
+	if r, err = NewPlayListReader(d); err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.PCMBuffer(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(buf.Data[:n], expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data[:n])
+	}
+}
+
+func TestDecoder_WaveList(t *testing.T) {
+	pcm16 := func(vals ...uint16) []byte {
+		b := make([]byte, 2*len(vals))
+		for i, v := range vals {
+			binary.LittleEndian.PutUint16(b[i*2:], v)
+		}
+		return b
+	}
+	// 16 bit mono data, silence and data segments
+	wavl := append([]byte("wavl"), chunk("data", pcm16(0, 1, 2, 3))...)
+	wavl = append(wavl, chunk("slnt", le32(2))...)
+	wavl = append(wavl, chunk("data", pcm16(10, 11, 12))...)
+	// cue point on the second sample of the last data chunk (offset 28 in
+	// the wave list)
+	cue := append(le32(1), "cue1"...)
+	cue = append(cue, le32(0)...)
+	cue = append(cue, "data"...)
+	cue = append(cue, le32(28, 0, 1)...)
+
+	body := append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+	body = append(body, chunk("LIST", wavl)...)
+	body = append(body, chunk("cue ", cue)...)
+	file := chunk("RIFF", body)
+
+	d := NewDecoder(bytes.NewReader(file))
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{0, 1, 2, 3, 0, 0, 10, 11, 12}; !reflect.DeepEqual(buf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data)
+	}
+	if n, err := d.NumFrames(); err != nil || n != 9 {
+		t.Fatalf("expected 9 frames, got %d (%v)", n, err)
+	}
+
+	d = NewDecoder(bytes.NewReader(file))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	frame, err := d.CuePointFrame(d.Metadata.CuePoints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame != 7 {
+		t.Fatalf("expected the cue point to be on frame 7, got %d", frame)
+	}
+	if err := d.seekFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	intBuf := &audio.IntBuffer{Data: make([]int, 4)}
+	n, err := d.PCMBuffer(intBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{11, 12}; !reflect.DeepEqual(intBuf.Data[:n], expected) {
+		t.Fatalf("expected %v, got %v", expected, intBuf.Data[:n])
+	}
+}
+
+func TestDecoder_VerifyChecksum(t *testing.T) {
+	fmtChunk := chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})
+	// wave list of data and slnt segments, only the stored data being hashed
+	wavl := append([]byte("wavl"), chunk("data", []byte{1, 0, 2, 0})...)
+	wavl = append(wavl, chunk("slnt", le32(1))...)
+	wavl = append(wavl, chunk("data", []byte{4, 0})...)
+	wavlSum := md5.Sum([]byte{1, 0, 2, 0, 4, 0})
+	// data chunk size left to the placeholder of streaming writers
+	dataSum := md5.Sum([]byte{1, 0, 2, 0, 3, 0})
+	unknownSize := append(append([]byte("data"), le32(0xFFFFFFFF)...), 1, 0, 2, 0, 3, 0)
+
+	testCases := []struct {
+		desc   string
+		body   [][]byte
+		first  int
+		verify bool
+	}{
+		{"wave list", [][]byte{fmtChunk, chunk("LIST", wavl), chunk("MD5 ", wavlSum[:])}, 1, true},
+		{"wave list mismatch", [][]byte{fmtChunk, chunk("LIST", wavl), chunk("MD5 ", dataSum[:])}, 1, false},
+		{"unknown data size", [][]byte{fmtChunk, chunk("MD5 ", dataSum[:]), unknownSize}, 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			file := chunk("RIFF", append([]byte("WAVE"), bytes.Join(tc.body, nil)...))
+			d := NewDecoder(bytes.NewReader(file))
+			err := d.VerifyChecksum()
+			var checksumErr *ChecksumError
+			if tc.verify && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.verify && !errors.As(err, &checksumErr) {
+				t.Fatalf("expected a checksum error, got %v", err)
+			}
+			// the decoder must be rewound to the PCM data in both cases
+			buf := &audio.IntBuffer{Data: make([]int, 1)}
+			if _, err := d.PCMBuffer(buf); err != nil || buf.Data[0] != tc.first {
+				t.Fatalf("expected the first sample to be %d, got %v (%v)", tc.first, buf.Data, err)
+			}
+		})
+	}
+
+	d := NewStreamDecoder(bytes.NewReader(wavWithChunks()))
+	if err := d.VerifyChecksum(); !errors.Is(err, ErrNotSeekable) {
+		t.Fatalf("expected %v, got %v", ErrNotSeekable, err)
+	}
+}
+
+// le32 returns the passed values encoded as little endian uint32.
+func le32(vals ...uint32) []byte {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+// onlyReader hides the Seek method of the underlying reader.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestStreamDecoder_ShortReads(t *testing.T) {
+	e := &Encoder{Metadata: &Metadata{
+		XMP: &XMP{Title: "streamed"},
+		ID3: &ID3Tag{Version: 4, Text: map[string]string{"TBPM": "120"}},
+	}}
+	body := append([]byte("WAVE"), chunk("id3 ", encodeID3Chunk(e))...)
+	body = append(body, chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+	body = append(body, chunk("data", []byte{1, 0, 2, 0})...)
+	body = append(body, chunk("_PMX", encodeXMPChunk(e))...)
+
+	// pipes and sockets return short reads, the chunks must be read whole
+	d := NewStreamDecoder(iotest.OneByteReader(bytes.NewReader(chunk("RIFF", body))))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata.XMP == nil || d.Metadata.XMP.Title != "streamed" {
+		t.Fatalf("unexpected XMP packet %+v", d.Metadata.XMP)
+	}
+	if d.Metadata.ID3 == nil || d.Metadata.ID3.Text["TBPM"] != "120" {
+		t.Fatalf("unexpected ID3 tag %+v", d.Metadata.ID3)
+	}
+}
+
+func TestStreamDecoder(t *testing.T) {
+	// bwf.wav and listChunkInHeader.wav have chunks preceding the fmt chunk
+	for _, path := range []string{"fixtures/bwf.wav", "fixtures/listChunkInHeader.wav", "fixtures/kick.wav"} {
+		t.Run(path, func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			expected, err := NewDecoder(f).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Seek(0, io.SeekStart)
+
+			d := NewStreamDecoder(onlyReader{f})
+			buf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(buf, expected) {
+				t.Fatalf("PCM data mismatch, got %d samples, expected %d", len(buf.Data), len(expected.Data))
+			}
+			if err := d.Rewind(); !errors.Is(err, ErrNotSeekable) {
+				t.Fatalf("expected ErrNotSeekable, got %v", err)
+			}
+		})
+	}
+
+	// sizes left to the placeholder values by a streaming writer
+	for _, size := range []uint32{0, 0xFFFFFFFF} {
+		body := append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+		body = append(body, "data"...)
+		body = append(body, le32(size)...)
+		body = append(body, 1, 0, 2, 0, 3, 0)
+		file := append(append([]byte("RIFF"), le32(size)...), body...)
+
+		d := NewStreamDecoder(bytes.NewReader(file))
+		buf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []int{1, 2, 3}; !reflect.DeepEqual(buf.Data, expected) {
+			t.Fatalf("size %#x: expected %v, got %v", size, expected, buf.Data)
+		}
+		if size == 0 {
+			continue
+		}
+		// seekable readers use the size of the file
+		d = NewDecoder(bytes.NewReader(file))
+		if n, err := d.NumFrames(); err != nil || n != 3 {
+			t.Fatalf("expected 3 frames, got %d (%v)", n, err)
+		}
+	}
+
+	// metadata following the PCM data
+	d := NewStreamDecoder(onlyReader{bytes.NewReader(wavWithChunks(chunk("LIST", append([]byte("INFO"), infoEntry("INAM", []byte("title"))...))))})
+	buf := &audio.IntBuffer{Data: make([]int, 1)}
+	if _, err := d.PCMBuffer(buf); err != nil || buf.Data[0] != 1 {
+		t.Fatalf("unexpected PCM data %v (%v)", buf.Data, err)
+	}
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || d.Metadata.Title != "title" {
+		t.Fatalf("unexpected metadata %+v", d.Metadata)
+	}
+}
+
+func TestDecodeFloat32s(t *testing.T) {
+	testCases := []struct {
+		bitDepth int
+		float    bool
+		src      []byte
+		expected []float32
+	}{
+		{8, false, []byte{0, 0x80, 0xC0}, []float32{-1, 0, 0.5}},
+		{16, false, []byte{0, 0x80, 0, 0x40, 0xFF}, []float32{-1, 0.5}},
+		{24, false, []byte{0, 0, 0x80, 0, 0, 0xC0}, []float32{-1, -0.5}},
+		{32, false, []byte{0, 0, 0, 0x40}, []float32{0.5}},
+		{32, true, []byte{0, 0, 0x40, 0xBF}, []float32{-0.75}},
+		{64, true, []byte{0, 0, 0, 0, 0, 0, 0xE8, 0x3F}, []float32{0.75}},
+	}
+	for _, tc := range testCases {
+		dst := make([]float32, 4)
+		n, err := decodeFloat32s(dst, tc.src, tc.bitDepth, tc.float)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(dst[:n], tc.expected) {
+			t.Fatalf("%d bits: expected %v, got %v", tc.bitDepth, tc.expected, dst[:n])
+		}
+	}
+}
+
+func TestDecoder_PCMBufferAllocs(t *testing.T) {
+	data, err := os.ReadFile("fixtures/bass.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(data))
+	buf := &audio.IntBuffer{Data: make([]int, 1024)}
+	// the first call reads the headers
+	if _, err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		if _, err := d.PCMBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected PCMBuffer not to allocate, got %.1f allocations per call", allocs)
+	}
+}
+
+// benchmarkPCMBuffer decodes a second of stereo audio of the passed bit
+// depth, 4096 samples at a time.
+func benchmarkPCMBuffer(b *testing.B, bitDepth int) {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, bitDepth, 2, 1)
+	in := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, SourceBitDepth: bitDepth, Data: make([]int, 2*48000)}
+	for i := range in.Data {
+		in.Data[i] = i % 100
+	}
+	if err := e.Write(in); err != nil {
+		b.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		b.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	buf := &audio.IntBuffer{Data: make([]int, 4096)}
+	// the first call reads the headers and allocates the internal buffer
+	if _, err := d.PCMBuffer(buf); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(buf.Data) * bitDepth / 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := d.PCMBuffer(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n < len(buf.Data) {
+			b.StopTimer()
+			if err := d.seekFrame(0); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+		}
+	}
+}
+
+func BenchmarkDecoder_PCMBuffer8(b *testing.B)  { benchmarkPCMBuffer(b, 8) }
+func BenchmarkDecoder_PCMBuffer16(b *testing.B) { benchmarkPCMBuffer(b, 16) }
+func BenchmarkDecoder_PCMBuffer24(b *testing.B) { benchmarkPCMBuffer(b, 24) }
+func BenchmarkDecoder_PCMBuffer32(b *testing.B) { benchmarkPCMBuffer(b, 32) }
+
+func TestDecoder_PCMFloat32Buffer(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		bitDepth    int
+		audioFormat int
+		ints        []int
+		expected    []float32
+	}{
+		{"8 bit", 8, 1, []int{0, 64, 128, 255}, []float32{-1, -0.5, 0, 127.0 / 128}},
+		{"16 bit", 16, 1, []int{-32768, -16384, 0, 32767}, []float32{-1, -0.5, 0, 32767.0 / 32768}},
+		{"24 bit", 24, 1, []int{-8388608, -4194304, 1, 8388607}, []float32{-1, -0.5, 1.0 / 8388608, 8388607.0 / 8388608}},
+		{"32 bit", 32, 1, []int{-2147483648, -1073741824, 0, 1073741824}, []float32{-1, -0.5, 0, 0.5}},
+		{"32 bit float", 32, 3, nil, []float32{-1.5, -0.5, 0, 0.75}},
+		{"64 bit float", 64, 3, nil, []float32{-1.5, -0.5, 0, 0.75}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := &seekableBuffer{}
+			e := NewEncoder(out, 8000, tc.bitDepth, 2, tc.audioFormat)
+			format := &audio.Format{NumChannels: 2, SampleRate: 8000}
+			var err error
+			if tc.ints != nil {
+				err = e.Write(&audio.IntBuffer{Format: format, Data: tc.ints})
+			} else {
+				err = e.WriteFloat32(&audio.Float32Buffer{Format: format, Data: tc.expected})
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDecoder(bytes.NewReader(out.Bytes()))
+			var got []float32
+			// odd sized buffer to not read full frames
+			buf := &audio.Float32Buffer{Data: make([]float32, 3)}
+			for {
+				n, err := d.PCMFloat32Buffer(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n == 0 {
+					break
+				}
+				got = append(got, buf.Data[:n]...)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, got)
+			}
+			if buf.SourceBitDepth != tc.bitDepth || buf.Format.NumChannels != 2 || buf.Format.SampleRate != 8000 {
+				t.Fatalf("unexpected format %+v, %d bits", buf.Format, buf.SourceBitDepth)
+			}
+		})
+	}
+
+	// the samples match the integer ones
+	f, err := os.Open("fixtures/bass.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ints, err := NewDecoder(f).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := &audio.Float32Buffer{Data: make([]float32, len(ints.Data))}
+	n, err := NewDecoder(f).PCMFloat32Buffer(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(ints.Data) {
+		t.Fatalf("expected %d samples, got %d", len(ints.Data), n)
+	}
+	for i, v := range ints.Data {
+		if expected := float32(v) / 0x800000; buf.Data[i] != expected {
+			t.Fatalf("sample %d: expected %f, got %f", i, expected, buf.Data[i])
+		}
+	}
+}
+
+// sineFile returns a mono 24 bit file of a second of a sine wave.
+func sineFile(t *testing.T, sampleRate int, frequency, amplitude float64) []byte {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, sampleRate, 24, 1, 1)
+	buf := &audio.Float32Buffer{Format: &audio.Format{NumChannels: 1, SampleRate: sampleRate}, Data: make([]float32, sampleRate)}
+	for i := range buf.Data {
+		buf.Data[i] = float32(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)))
+	}
+	if err := e.WriteFloat32(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestResampleReader(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		inRate    int
+		outRate   int
+		frequency float64
+		quality   ResampleQuality
+		// maxError is the maximum difference with the expected sine, the
+		// frequencies above the output Nyquist frequency being expected to
+		// be removed.
+		maxError float64
+	}{
+		{"same rate", 48000, 48000, 1000, ResampleDefault, 1e-6},
+		{"44.1 to 48 kHz", 44100, 48000, 1000, ResampleDefault, 1e-3},
+		{"48 to 44.1 kHz", 48000, 44100, 5000, ResampleHigh, 1e-3},
+		{"96 to 48 kHz", 96000, 48000, 10000, ResampleLow, 3e-3},
+		{"96 to 48 kHz alias", 96000, 48000, 30000, ResampleDefault, 1e-3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := NewDecoder(bytes.NewReader(sineFile(t, tc.inRate, tc.frequency, 0.5)))
+			r, err := NewResampleReader(d, tc.outRate, tc.quality)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []float32
+			buf := &audio.Float32Buffer{Data: make([]float32, 1000)}
+			for {
+				n, err := r.PCMFloat32Buffer(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n == 0 {
+					break
+				}
+				got = append(got, buf.Data[:n]...)
+			}
+			if len(got) != tc.outRate {
+				t.Fatalf("expected %d frames, got %d", tc.outRate, len(got))
+			}
+			if buf.Format.SampleRate != tc.outRate {
+				t.Fatalf("unexpected format %+v", buf.Format)
+			}
+			amplitude := 0.5
+			if tc.frequency > float64(tc.outRate)/2 {
+				amplitude = 0
+			}
+			var maxErr float64
+			// the edges are interpolated against silence
+			for i := tc.outRate / 10; i < tc.outRate*9/10; i++ {
+				expected := amplitude * math.Sin(2*math.Pi*tc.frequency*float64(i)/float64(tc.outRate))
+				maxErr = math.Max(maxErr, math.Abs(float64(got[i])-expected))
+			}
+			if maxErr > tc.maxError {
+				t.Fatalf("expected a maximum error of %g, got %g", tc.maxError, maxErr)
+			}
+		})
+	}
+
+	// integer samples
+	d := NewDecoder(bytes.NewReader(sineFile(t, 44100, 1000, 0.5)))
+	r, err := NewResampleReader(d, 22050, ResampleDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &audio.IntBuffer{Data: make([]int, 22050)}
+	n, err := r.PCMBuffer(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 22050 || buf.SourceBitDepth != 24 || buf.Format.SampleRate != 22050 {
+		t.Fatalf("unexpected buffer of %d samples, %d bits, %+v", n, buf.SourceBitDepth, buf.Format)
+	}
+	if expected := int(0.5 * math.Sin(2*math.Pi*1000*100/22050) * 0x800000); math.Abs(float64(buf.Data[100]-expected)) > 0x800000*1e-3 {
+		t.Fatalf("expected %d, got %d", expected, buf.Data[100])
+	}
+}
+
+func TestDecoder_ChannelMatrix(t *testing.T) {
+	const numFrames = 10
+	k := math.Sqrt2 / 2
+	// the file has 6 channels, the sample of channel c at frame f being
+	// 10*(c+1)+f
+	value := func(c, f int) float64 { return float64(10*(c+1) + f) }
+	testCases := []struct {
+		desc   string
+		matrix ChannelMatrix
+		// expected returns the sample of the output channel c at frame f.
+		expected func(c, f int) float64
+		err      bool
+	}{
+		{"select", SelectChannels(3), func(c, f int) float64 { return value(3, f) }, false},
+		{"reorder", SelectChannels(5, 0, 2), func(c, f int) float64 { return value([]int{5, 0, 2}[c], f) }, false},
+		{"stereo to mono", DownmixStereoToMono(), func(c, f int) float64 { return (value(0, f) + value(1, f)) / 2 }, false},
+		{"5.1 to stereo", Downmix51ToStereo(), func(c, f int) float64 {
+			return value(c, f) + k*value(2, f) + k*value(4+c, f)
+		}, false},
+		{"custom", ChannelMatrix{{0, 0, 0, 0, 0, 1}, {-1, 1}}, func(c, f int) float64 {
+			if c == 0 {
+				return value(5, f)
+			}
+			return value(1, f) - value(0, f)
+		}, false},
+		{"missing channel", SelectChannels(6), nil, true},
+		{"negative channel", SelectChannels(-1), nil, true},
+		{"empty", ChannelMatrix{}, nil, true},
+	}
+	for _, bitDepth := range []int{8, 16, 24} {
+		out := &seekableBuffer{}
+		e := NewEncoder(out, 48000, bitDepth, 6, 1)
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 6, SampleRate: 48000}, SourceBitDepth: bitDepth}
+		for f := 0; f < numFrames; f++ {
+			for c := 0; c < 6; c++ {
+				v := int(value(c, f))
+				if bitDepth == 8 {
+					v += 128
+				}
+				buf.Data = append(buf.Data, v)
+			}
+		}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s %d bits", tc.desc, bitDepth), func(t *testing.T) {
+				d := NewDecoder(bytes.NewReader(out.Bytes()))
+				d.ChannelMatrix = tc.matrix
+				ints, err := d.FullPCMBuffer()
+				if tc.err {
+					if err == nil {
+						t.Fatal("expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				numChans := len(tc.matrix)
+				if ints.Format.NumChannels != numChans || d.Format().NumChannels != numChans {
+					t.Fatalf("expected %d channels, got %d and %d", numChans, ints.Format.NumChannels, d.Format().NumChannels)
+				}
+				if d.NumChans != 6 {
+					t.Fatalf("expected the file to still have 6 channels, got %d", d.NumChans)
+				}
+				if len(ints.Data) != numFrames*numChans {
+					t.Fatalf("expected %d samples, got %d", numFrames*numChans, len(ints.Data))
+				}
+				for i, v := range ints.Data {
+					expected := int(math.Round(tc.expected(i%numChans, i/numChans)))
+					if bitDepth == 8 {
+						expected += 128
+					}
+					if v != expected {
+						t.Fatalf("sample %d: expected %d, got %d", i, expected, v)
+					}
+				}
+
+				d = NewDecoder(bytes.NewReader(out.Bytes()))
+				d.ChannelMatrix = tc.matrix
+				// the buffer doesn't fit a whole number of input frames
+				floats := &audio.Float32Buffer{Data: make([]float32, 4*numChans+1)}
+				var frame int
+				for {
+					n, err := d.PCMFloat32Buffer(floats)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if n == 0 {
+						break
+					}
+					if floats.Format.NumChannels != numChans {
+						t.Fatalf("expected %d channels, got %d", numChans, floats.Format.NumChannels)
+					}
+					for i, v := range floats.Data[:n] {
+						expected := tc.expected(i%numChans, frame+i/numChans) / float64(int(1)<<uint(bitDepth-1))
+						if math.Abs(float64(v)-expected) > 1e-6 {
+							t.Fatalf("frame %d: expected %f, got %f", frame+i/numChans, expected, v)
+						}
+					}
+					frame += n / numChans
+				}
+				if frame != numFrames {
+					t.Fatalf("expected %d frames, got %d", numFrames, frame)
+				}
+			})
+		}
+	}
+}
+
+func TestDecoder_ChannelMatrixClipping(t *testing.T) {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, 16, 2, 1)
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: 2, SampleRate: 48000},
+		Data:           []int{30000, 30000, -30000, -30000},
+		SourceBitDepth: 16,
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ChannelMatrix = ChannelMatrix{{1, 1}}
+	ints, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{32767, -32768}; !reflect.DeepEqual(ints.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, ints.Data)
+	}
+}
+
+func TestDecoder_ChannelMatrixErrors(t *testing.T) {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, 32, 2, 3)
+	for _, frame := range [][]float64{{0.5, 0.25}, {-0.5, 0.125}} {
+		if err := e.WriteFloatFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// buffers shorter than a frame would be mistaken for the end of the data
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ChannelMatrix = SelectChannels(1, 0)
+	if _, err := d.PCMFloat32Buffer(&audio.Float32Buffer{Data: make([]float32, 1)}); err == nil {
+		t.Fatal("expected a buffer shorter than a frame to be refused")
+	}
+
+	// the samples of PCMBuffer are the bits of the floats
+	d = NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ChannelMatrix = DownmixStereoToMono()
+	if _, err := d.PCMBuffer(&audio.IntBuffer{Data: make([]int, 2)}); err == nil {
+		t.Fatal("expected the IEEE float samples of PCMBuffer not to be mixed")
+	}
+	buf := &audio.Float32Buffer{Data: make([]float32, 4)}
+	n, err := d.PCMFloat32Buffer(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []float32{0.375, -0.1875}; !reflect.DeepEqual(buf.Data[:n], expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data[:n])
+	}
+}
+
+func TestDecoder_OddDataSize(t *testing.T) {
+	// 8 bit mono, the data chunk being followed by a padding byte
+	body := append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x40, 0x1F, 0, 0, 1, 0, 8, 0})...)
+	body = append(body, chunk("data", []byte{0x80, 0x81, 0x7F})...)
+	body = append(body, chunk("LIST", append([]byte("INFO"), infoEntry("INAM", []byte("odd"))...))...)
+	file := chunk("RIFF", body)
+
+	d := NewDecoder(bytes.NewReader(file))
+	if n, err := d.NumFrames(); err != nil || n != 3 {
+		t.Fatalf("expected 3 frames, got %d (%v)", n, err)
+	}
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{0x80, 0x81, 0x7F}; !reflect.DeepEqual(buf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data)
+	}
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || d.Metadata.Title != "odd" {
+		t.Fatalf("expected the INFO chunk to be read, got %+v", d.Metadata)
+	}
+}
@@ -0,0 +1,124 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-audio/riff"
+)
+
+// DISP chunk is documented here:
+// https://www.recordingblogs.com/wiki/display-chunk-of-a-wave-file
+
+// Clipboard formats of the DISP chunks.
+const (
+	// DisplayText is a NUL terminated ANSI text.
+	DisplayText uint32 = 1
+	// DisplayBitmap is a device dependent bitmap.
+	DisplayBitmap uint32 = 2
+	// DisplayMetafile is a Windows metafile picture.
+	DisplayMetafile uint32 = 3
+	// DisplayDIB is a device independent bitmap, a BMP file without its 14
+	// byte file header.
+	DisplayDIB uint32 = 8
+	// DisplayUnicodeText is a NUL terminated UTF-16 text.
+	DisplayUnicodeText uint32 = 13
+	// DisplayEnhancedMetafile is an enhanced Windows metafile.
+	DisplayEnhancedMetafile uint32 = 14
+)
+
+// Display is the content of a DISP chunk, data meant to represent the file
+// in user interfaces, usually a title or a picture.
+type Display struct {
+	// Type is the clipboard format of the data, for instance DisplayText or
+	// DisplayDIB.
+	Type uint32
+	// Data is the payload, text or image bytes depending on Type.
+	Data []byte
+	// charset is the charset of the ANSI text found by the decoder, following
+	// its CSET chunk and CharsetFallback.
+	charset Charset
+}
+
+// NewDisplayText returns a DISP chunk containing the passed text.
+func NewDisplayText(text string) *Display {
+	return &Display{Type: DisplayText, Data: append([]byte(text), 0)}
+}
+
+// Text returns the payload of text chunks, ok is false for other types. ANSI
+// text is decoded as the INFO strings, using the code page of the CSET chunk
+// of the file if any.
+func (disp *Display) Text() (text string, ok bool) {
+	switch disp.Type {
+	case DisplayText:
+		raw := disp.Data[:clen(disp.Data)]
+		if disp.charset != CharsetUnknown {
+			return disp.charset.decode(raw), true
+		}
+		if utf8.Valid(raw) {
+			return string(raw), true
+		}
+		return CharsetWindows1252.decode(raw), true
+	case DisplayUnicodeText:
+		u := make([]uint16, 0, len(disp.Data)/2)
+		for i := 0; i+1 < len(disp.Data); i += 2 {
+			c := binary.LittleEndian.Uint16(disp.Data[i:])
+			if c == 0 {
+				break
+			}
+			u = append(u, c)
+		}
+		return string(utf16.Decode(u)), true
+	}
+	return "", false
+}
+
+// setCharset sets the charset of ANSI text using the CSET chunk read by the
+// decoder.
+func (disp *Display) setCharset(d *Decoder) {
+	if disp.Type == DisplayText {
+		disp.charset = d.infoCharset(disp.Data[:clen(disp.Data)])
+	}
+}
+
+// DecodeDISPChunk decodes a DISP chunk and adds it to
+// Decoder.Metadata.Displays.
+func DecodeDISPChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDDisp {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		if _, err := io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the DISP chunk - %w", err)
+		}
+		if len(buf) < 4 {
+			return fmt.Errorf("DISP chunk too short: %d bytes", len(buf))
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		disp := &Display{
+			Type: binary.LittleEndian.Uint32(buf),
+			Data: buf[4:],
+		}
+		disp.setCharset(d)
+		d.Metadata.Displays = append(d.Metadata.Displays, disp)
+	}
+	ch.Drain()
+	return nil
+}
+
+// encodeDISPChunk returns the content of the DISP chunk.
+func encodeDISPChunk(disp *Display) []byte {
+	buf := make([]byte, 4, 4+len(disp.Data))
+	binary.LittleEndian.PutUint32(buf, disp.Type)
+	return append(buf, disp.Data...)
+}
@@ -0,0 +1,181 @@
+package wav
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Dither is the noise added to the samples before reducing their resolution,
+// which decorrelates the quantization error from the signal.
+type Dither int
+
+const (
+	// DitherNone rounds the samples to the closest value.
+	DitherNone Dither = iota
+	// DitherRectangular adds a noise of rectangular probability density of 1
+	// LSB peak to peak.
+	DitherRectangular
+	// DitherTPDF adds a noise of triangular probability density of 2 LSB peak
+	// to peak, which also removes the modulation of the noise by the signal.
+	DitherTPDF
+)
+
+// String implements the Stringer interface.
+func (d Dither) String() string {
+	switch d {
+	case DitherNone:
+		return "none"
+	case DitherRectangular:
+		return "rectangular"
+	case DitherTPDF:
+		return "TPDF"
+	default:
+		return "unknown"
+	}
+}
+
+// quantizer rounds samples to a lower resolution.
+type quantizer struct {
+	dither   Dither
+	shaping  bool
+	bitDepth int
+	rng      *rand.Rand
+	// errs contains the last quantization error of each channel, fed back by
+	// the noise shaping.
+	errs []float64
+}
+
+func newQuantizer(dither Dither, shaping bool, bitDepth, numChans int) *quantizer {
+	return &quantizer{
+		dither:   dither,
+		shaping:  shaping,
+		bitDepth: bitDepth,
+		// a constant seed keeps the output reproducible
+		rng:  rand.New(rand.NewSource(1)),
+		errs: make([]float64, numChans),
+	}
+}
+
+// quantize rounds v, expressed in LSBs of the target bit depth, to a signed
+// sample of the channel ch. Values out of range are clipped, in which case
+// clipped is true.
+func (q *quantizer) quantize(v float64, ch int) (s int, clipped bool) {
+	if math.IsNaN(v) {
+		return 0, false
+	}
+	if q.shaping && ch < len(q.errs) {
+		// first order error feedback, moving the noise to the high frequencies
+		v -= q.errs[ch]
+	}
+	r := v
+	switch q.dither {
+	case DitherRectangular:
+		r += q.rng.Float64() - 0.5
+	case DitherTPDF:
+		r += q.rng.Float64() - q.rng.Float64()
+	}
+	r = math.Floor(r + 0.5)
+	max := float64(int64(1) << uint(q.bitDepth-1))
+	switch {
+	case r > max-1:
+		r, clipped = max-1, true
+	case r < -max:
+		r, clipped = -max, true
+	}
+	if q.shaping && ch < len(q.errs) {
+		// the error of clipped samples isn't fed back to not diverge
+		q.errs[ch] = 0
+		if !clipped {
+			q.errs[ch] = r - v
+		}
+	}
+	return int(r), clipped
+}
+
+// clipInt clips v to the range of signed samples of the passed bit depth,
+// clipped being true if v was out of range.
+func clipInt(v, bitDepth int) (s int, clipped bool) {
+	max := int(1) << uint(bitDepth-1)
+	switch {
+	case v > max-1:
+		return max - 1, true
+	case v < -max:
+		return -max, true
+	}
+	return v, false
+}
+
+// converting returns positively if samples of the passed bit depth must be
+// converted to the bit depth of the encoder.
+func (e *Encoder) converting(sourceBitDepth int) bool {
+	return sourceBitDepth > 0 && sourceBitDepth != e.BitDepth && e.WavAudioFormat != wavFormatIEEEFloat
+}
+
+// convertInts rescales the samples of src, starting at the passed frame,
+// from the passed bit depth to the bit depth of the encoder, dithering them
+// when the resolution is reduced. The returned slice is reused across calls.
+func (e *Encoder) convertInts(src []int, sourceBitDepth, numChans, frame int) ([]int, error) {
+	if cap(e.convBuf) < len(src) {
+		e.convBuf = make([]int, len(src))
+	}
+	dst := e.convBuf[:len(src)]
+	if numChans < 1 {
+		numChans = 1
+	}
+	for i, v := range src {
+		// 8 bit samples are unsigned
+		if sourceBitDepth == 8 {
+			v -= 128
+		}
+		var clipped bool
+		if sourceBitDepth < e.BitDepth {
+			v, clipped = clipInt(v<<uint(e.BitDepth-sourceBitDepth), e.BitDepth)
+		} else {
+			scale := float64(int64(1) << uint(sourceBitDepth-e.BitDepth))
+			v, clipped = e.quant.quantize(float64(v)/scale, i%numChans)
+		}
+		if clipped {
+			if err := e.clipped(frame+i/numChans, i%numChans); err != nil {
+				return nil, err
+			}
+		}
+		if e.BitDepth == 8 {
+			v += 128
+		}
+		dst[i] = v
+	}
+	return dst, nil
+}
+
+// quantizeFloats converts the samples of src, starting at the passed frame,
+// from the [-1, 1] range to the bit depth of the encoder using its dither and
+// noise shaping settings. The returned slice is reused across calls.
+func (e *Encoder) quantizeFloats(src []float64, numChans, frame int) ([]int, error) {
+	if cap(e.convBuf) < len(src) {
+		e.convBuf = make([]int, len(src))
+	}
+	dst := e.convBuf[:len(src)]
+	if numChans < 1 {
+		numChans = 1
+	}
+	scale := float64(int64(1) << uint(e.BitDepth-1))
+	for i, v := range src {
+		s, clipped := e.quant.quantize(v*scale, i%numChans)
+		if clipped {
+			if err := e.clipped(frame+i/numChans, i%numChans); err != nil {
+				return nil, err
+			}
+		}
+		if e.BitDepth == 8 {
+			s += 128
+		}
+		dst[i] = s
+	}
+	return dst, nil
+}
+
+// dithering returns positively if float samples must go through the
+// quantizer instead of being rounded.
+func (e *Encoder) dithering() bool {
+	return (e.Dither != DitherNone || e.NoiseShaping) && e.WavAudioFormat != wavFormatIEEEFloat
+}
@@ -2,10 +2,13 @@ package wav
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
 	"time"
 
@@ -15,8 +18,20 @@ import (
 
 // Encoder encodes LPCM data into a wav containter.
 type Encoder struct {
-	w   io.WriteSeeker
-	buf *bytes.Buffer
+	w io.WriteSeeker
+	// pcmBuf is reused across calls to encode the PCM data.
+	pcmBuf []byte
+	// convBuf and floatBuf are reused to convert the samples to the bit depth
+	// of the encoder.
+	convBuf  []int
+	floatBuf []float64
+	quant    *quantizer
+	clips    ClipStats
+	// resampler converts the buffers of resampleRate and resampleOut is
+	// reused to read it.
+	resampler    *resampler
+	resampleRate int
+	resampleOut  []float64
 
 	SampleRate int
 	BitDepth   int
@@ -26,17 +41,87 @@ type Encoder struct {
 	// the <format-specific-fields> portion of the ‘fmt’ chunk, and the
 	// interpretation of the waveform data, depend on this value. PCM = 1 (i.e.
 	// Linear quantization) Values other than 1 indicate some form of
-	// compression.
+	// compression and a fact chunk containing the number of frames is
+	// written.
 	WavAudioFormat int
 
 	// Metadata contains metadata to inject in the file.
 	Metadata *Metadata
+	// InfoCharset is the charset used to write the INFO strings. A CSET chunk
+	// is written for UTF-8, ISO-8859-1 and Windows-1252, characters that
+	// can't be represented using ASCII or the 8 bit charsets are replaced by a
+	// question mark. By default, strings are written as UTF-8 without CSET
+	// chunk unless Metadata.CharacterSet is set, the encoder failing if its
+	// code page isn't supported.
+	InfoCharset Charset
+	// PeakEnvelope, when set before writing any data, is computed as frames
+	// are written and stored in a levl chunk when the encoder is closed. See
+	// PeakEnvelope for the available settings.
+	PeakEnvelope *PeakEnvelope
+	// Peak, when set to a non nil value before writing any data, is updated
+	// with the peak of each channel as frames are written and stored in a
+	// PEAK chunk when the encoder is closed.
+	Peak *Peak
+	// WriteMD5, when set before writing any data, computes the MD5 of the PCM
+	// data as it is written and stores it in a MD5 chunk when the encoder is
+	// closed.
+	WriteMD5 bool
+	// Dither is the noise added to the samples before reducing their
+	// resolution: when writing an IntBuffer whose SourceBitDepth is higher
+	// than BitDepth, or float samples to an integer format. Samples are
+	// otherwise rounded to the closest value. In all cases, values out of
+	// range are clipped. It must be set before writing any data.
+	Dither Dither
+	// NoiseShaping, when set before writing any data, feeds the quantization
+	// error back to move the noise to the high frequencies where it is less
+	// audible. See Dither for when samples are quantized.
+	NoiseShaping bool
+	// MaxOvers is the number of clipped samples whose position is recorded
+	// in the ClipStats.
+	MaxOvers int
+	// FailOnClip makes the writing methods return an error wrapping
+	// ErrClipped as soon as a sample is clipped, the frames preceding the
+	// buffer or frame being written. See ClipStats.
+	FailOnClip bool
+	// Resample, when set, converts the buffers whose Format.SampleRate differs
+	// from SampleRate instead of writing them as is, using a windowed-sinc
+	// filter of ResampleQuality. Integer samples are scaled using their
+	// SourceBitDepth, the bit depth of the encoder being used when not set.
+	// All the resampled buffers must have the same rate and number of
+	// channels.
+	Resample        bool
+	ResampleQuality ResampleQuality
 
 	WrittenBytes    int
 	frames          int
 	pcmChunkStarted bool
 	pcmChunkSizePos int
-	wroteHeader     bool // true if we've written the header out
+	// factSampleLengthPos is the position of the sample length of the fact
+	// chunk, 0 if the file doesn't have one.
+	factSampleLengthPos int
+	wroteHeader         bool // true if we've written the header out
+	// pending contains the bytes of a partially written sample and
+	// partialFrame the number of bytes of a partially written frame
+	// (WriteFrame)
+	pending      []byte
+	partialFrame int
+	// observedInts and observedFloats are reused across calls to decode the
+	// samples written by WriteFrame.
+	observedInts   []int
+	observedFloats []float32
+	levl           *peakEnvelopeWriter
+	peak           *peakWriter
+	md5            hash.Hash
+	markers        []*Marker
+	regions        []*Region
+	// stream is true for the encoders created by NewStreamEncoder,
+	// streamFrames and streamSize being the announced number of frames and
+	// RIFF size, and streamMetadata the metadata chunks rendered when writing
+	// the header.
+	stream         bool
+	streamFrames   int
+	streamSize     int
+	streamMetadata []byte
 }
 
 // NewEncoder creates a new encoder to create a new wav file.
@@ -44,7 +129,6 @@ type Encoder struct {
 func NewEncoder(w io.WriteSeeker, sampleRate, bitDepth, numChans, audioFormat int) *Encoder {
 	return &Encoder{
 		w:              w,
-		buf:            bytes.NewBuffer(make([]byte, 0, bytesNumFromDuration(time.Minute, sampleRate, bitDepth)*numChans)),
 		SampleRate:     sampleRate,
 		BitDepth:       bitDepth,
 		NumChans:       numChans,
@@ -64,50 +148,144 @@ func (e *Encoder) AddBE(src interface{}) error {
 	return binary.Write(e.w, binary.BigEndian, src)
 }
 
+// pcmBlockSize is the maximum number of samples encoded before being written
+// to the underlying writer.
+const pcmBlockSize = 16384
+
 func (e *Encoder) addBuffer(buf *audio.IntBuffer) error {
 	if buf == nil {
 		return fmt.Errorf("can't add a nil buffer")
 	}
 
 	frameCount := buf.NumFrames()
-	// performance tweak: setup a buffer so we don't do too many writes
-	var err error
-	for i := 0; i < frameCount; i++ {
-		for j := 0; j < buf.Format.NumChannels; j++ {
-			v := buf.Data[i*buf.Format.NumChannels+j]
-			switch e.BitDepth {
-			case 8:
-				if err = binary.Write(e.buf, binary.LittleEndian, uint8(v)); err != nil {
-					return err
-				}
-			case 16:
-				if err = binary.Write(e.buf, binary.LittleEndian, int16(v)); err != nil {
-					return err
-				}
-			case 24:
-				if err = binary.Write(e.buf, binary.LittleEndian, audio.Int32toInt24LEBytes(int32(v))); err != nil {
-					return err
-				}
-			case 32:
-				if err = binary.Write(e.buf, binary.LittleEndian, int32(v)); err != nil {
-					return err
-				}
-			default:
-				return fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
+	if frameCount == 0 {
+		return nil
+	}
+	numChans := buf.Format.NumChannels
+	data := buf.Data[:frameCount*numChans]
+	convert := e.converting(buf.SourceBitDepth)
+	// the samples are encoded by blocks of full frames so we don't do too
+	// many writes
+	blockSize := blockSizeFor(numChans)
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		var (
+			block []int
+			err   error
+		)
+		if convert {
+			block, err = e.convertInts(data[:n], buf.SourceBitDepth, numChans, e.frames)
+		} else {
+			block, err = e.clipInts(data[:n], numChans, e.frames)
+		}
+		if err != nil {
+			return err
+		}
+		if e.observing() {
+			for _, v := range block {
+				e.observe(v)
 			}
 		}
-		e.frames++
+		if e.pcmBuf, err = encodeInts(e.pcmBuf[:0], block, e.BitDepth); err != nil {
+			return err
+		}
+		if err := e.writePCM(e.pcmBuf); err != nil {
+			return err
+		}
+		e.frames += n / numChans
+		data = data[n:]
 	}
-	if n, err := e.w.Write(e.buf.Bytes()); err != nil {
-		e.WrittenBytes += n
-		return err
+
+	return nil
+}
+
+func (e *Encoder) addFloat32Buffer(buf *audio.Float32Buffer) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+
+	frameCount := buf.NumFrames()
+	if frameCount == 0 {
+		return nil
+	}
+	numChans := buf.Format.NumChannels
+	data := buf.Data[:frameCount*numChans]
+	blockSize := blockSizeFor(numChans)
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		block := e.floatScratch(n)
+		for i, v := range data[:n] {
+			block[i] = float64(v)
+		}
+		if err := e.encodeFloats(block, numChans); err != nil {
+			return err
+		}
+		if err := e.writePCM(e.pcmBuf); err != nil {
+			return err
+		}
+		e.frames += n / numChans
+		data = data[n:]
 	}
-	e.WrittenBytes += e.buf.Len()
-	e.buf.Reset()
 
 	return nil
 }
 
+// encodeFloats encodes float samples into pcmBuf, dithering them if needed.
+func (e *Encoder) encodeFloats(src []float64, numChans int) error {
+	float := e.WavAudioFormat == wavFormatIEEEFloat
+	if e.observing() {
+		for _, v := range src {
+			e.observeFloatSample(v, float)
+		}
+	}
+	var err error
+	if e.dithering() {
+		// the quantizer reports the clipped samples
+		var ints []int
+		if ints, err = e.quantizeFloats(src, numChans, e.frames); err != nil {
+			return err
+		}
+		e.pcmBuf, err = encodeInts(e.pcmBuf[:0], ints, e.BitDepth)
+		return err
+	}
+	if err := e.clipFloats(src, numChans, e.frames); err != nil {
+		return err
+	}
+	e.pcmBuf, err = encodeFloat64s(e.pcmBuf[:0], src, e.BitDepth, float)
+	return err
+}
+
+// pcmDataSize returns the size of the PCM data written so far, without the
+// padding byte.
+func (e *Encoder) pcmDataSize() int {
+	return (e.BitDepth/8)*e.NumChans*e.frames + e.partialFrame
+}
+
+// blockSizeFor returns the number of samples of the blocks of full frames
+// encoded at once.
+func blockSizeFor(numChans int) int {
+	if numChans < 1 || numChans > pcmBlockSize {
+		return pcmBlockSize
+	}
+	return pcmBlockSize / numChans * numChans
+}
+
+// writePCM writes encoded PCM data to the underlying writer.
+func (e *Encoder) writePCM(b []byte) error {
+	if e.md5 != nil {
+		e.md5.Write(b)
+	}
+	n, err := e.w.Write(b)
+	e.WrittenBytes += n
+	return err
+}
+
 func (e *Encoder) writeHeader() error {
 	if e.wroteHeader {
 		return errors.New("already wrote header")
@@ -124,12 +302,21 @@ func (e *Encoder) writeHeader() error {
 		return nil
 	}
 
+	// file size uint32, to update later on. The size of streams is checked
+	// before writing anything as they can't be rewritten.
+	riffSize := uint32(4294967295)
+	if e.stream {
+		var err error
+		if riffSize, err = e.streamRIFFSize(); err != nil {
+			return err
+		}
+	}
+
 	// riff ID
 	if err := e.AddLE(riff.RiffID); err != nil {
 		return err
 	}
-	// file size uint32, to update later on.
-	if err := e.AddLE(uint32(4294967295)); err != nil {
+	if err := e.AddLE(riffSize); err != nil {
 		return err
 	}
 	// wave headers
@@ -140,8 +327,12 @@ func (e *Encoder) writeHeader() error {
 	if err := e.AddLE(riff.FmtID); err != nil {
 		return err
 	}
-	// chunk size
-	if err := e.AddLE(uint32(16)); err != nil {
+	// chunk size, non PCM formats have an extra cbSize field
+	fmtSize := 16
+	if e.WavAudioFormat != wavFormatPCM {
+		fmtSize = 18
+	}
+	if err := e.AddLE(uint32(fmtSize)); err != nil {
 		return err
 	}
 	// wave format
@@ -170,67 +361,373 @@ func (e *Encoder) writeHeader() error {
 		return fmt.Errorf("error encoding bits per sample - %w", err)
 	}
 
+	if e.WavAudioFormat != wavFormatPCM {
+		// cbSize, no extra format information
+		if err := e.AddLE(uint16(0)); err != nil {
+			return fmt.Errorf("error encoding the format extension size - %w", err)
+		}
+		// the fact chunk is required for all the non PCM formats, its sample
+		// length is updated when the encoder is closed.
+		if err := e.AddLE(CIDFact); err != nil {
+			return fmt.Errorf("error encoding the fact chunk ID - %w", err)
+		}
+		if err := e.AddLE(uint32(4)); err != nil {
+			return fmt.Errorf("error encoding the fact chunk size - %w", err)
+		}
+		var sampleLength uint32
+		if e.stream {
+			sampleLength = uint32(e.streamFrames)
+		} else {
+			e.factSampleLengthPos = e.WrittenBytes
+		}
+		if err := e.AddLE(sampleLength); err != nil {
+			return fmt.Errorf("error encoding the fact sample length - %w", err)
+		}
+	}
+
 	return nil
 }
 
 // Write encodes and writes the passed buffer to the underlying writer.
 // Don't forget to Close() the encoder or the file won't be valid.
 func (e *Encoder) Write(buf *audio.IntBuffer) error {
+	if buf != nil && e.resampling(buf.Format) {
+		if err := e.startWrite(0); err != nil {
+			return err
+		}
+		return e.addResampledBuffer(buf)
+	}
+	if err := e.startWrite(buf.NumFrames()); err != nil {
+		return err
+	}
+	return e.addBuffer(buf)
+}
+
+// WriteFloat32 encodes and writes the passed buffer to the underlying writer.
+// The samples are written as is to IEEE float files (WavAudioFormat 3) of 32
+// or 64 bits. Otherwise they are expected to be in the [-1, 1] range and are
+// scaled to the bit depth of the encoder, values out of range being clipped.
+// Don't forget to Close() the encoder or the file won't be valid.
+func (e *Encoder) WriteFloat32(buf *audio.Float32Buffer) error {
+	if buf != nil && e.resampling(buf.Format) {
+		if err := e.startWrite(0); err != nil {
+			return err
+		}
+		src := e.floatScratch(len(buf.Data))
+		for i, v := range buf.Data {
+			src[i] = float64(v)
+		}
+		return e.resample(src, buf.Format.NumChannels, buf.Format.SampleRate)
+	}
+	if err := e.startWrite(buf.NumFrames()); err != nil {
+		return err
+	}
+	return e.addFloat32Buffer(buf)
+}
+
+// startWrite writes the headers if needed before writing the passed number
+// of frames.
+func (e *Encoder) startWrite(frames int) error {
 	if !e.wroteHeader {
 		if err := e.writeHeader(); err != nil {
 			return err
 		}
 	}
 
-	if !e.pcmChunkStarted {
-		// sound header
-		if err := e.AddLE(riff.DataFormatID); err != nil {
-			return fmt.Errorf("error encoding sound header %w", err)
-		}
-		e.pcmChunkStarted = true
+	if err := e.startPCMChunk(); err != nil {
+		return err
+	}
+	if e.stream && e.streamFrames >= 0 && e.frames+frames > e.streamFrames {
+		return fmt.Errorf("can't write more than the %d frames announced to the stream", e.streamFrames)
+	}
+	return nil
+}
 
-		// write a temporary chunksize
-		e.pcmChunkSizePos = e.WrittenBytes
-		if err := e.AddLE(uint32(4294967295)); err != nil {
-			return fmt.Errorf("%w when writing wav data chunk size header", err)
+// WriteIntFrame writes a frame made of a sample per channel. The samples use
+// the same representation as Write, 8 bit samples being unsigned.
+func (e *Encoder) WriteIntFrame(frame []int) error {
+	if len(frame) != e.NumChans {
+		return fmt.Errorf("can't write a frame of %d samples to %d channels", len(frame), e.NumChans)
+	}
+	if err := e.startWrite(1); err != nil {
+		return err
+	}
+	frame, err := e.clipInts(frame, e.NumChans, e.frames)
+	if err != nil {
+		return err
+	}
+	if e.observing() {
+		for _, v := range frame {
+			e.observe(v)
 		}
 	}
+	if e.pcmBuf, err = encodeInts(e.pcmBuf[:0], frame, e.BitDepth); err != nil {
+		return err
+	}
+	if err := e.writePCM(e.pcmBuf); err != nil {
+		return err
+	}
+	e.frames++
+	return nil
+}
 
-	return e.addBuffer(buf)
+// WriteFloatFrame writes a frame made of a sample per channel. As with
+// WriteFloat32, the samples are written as is to IEEE float files and are
+// otherwise scaled from the [-1, 1] range to the bit depth of the encoder.
+func (e *Encoder) WriteFloatFrame(frame []float64) error {
+	if len(frame) != e.NumChans {
+		return fmt.Errorf("can't write a frame of %d samples to %d channels", len(frame), e.NumChans)
+	}
+	if err := e.startWrite(1); err != nil {
+		return err
+	}
+	if err := e.encodeFloats(frame, e.NumChans); err != nil {
+		return err
+	}
+	if err := e.writePCM(e.pcmBuf); err != nil {
+		return err
+	}
+	e.frames++
+	return nil
 }
 
-// WriteFrame writes a single frame of data to the underlying writer.
+// WriteFrame writes the passed value as is to the underlying writer using
+// binary.Write, whatever the bit depth and number of channels of the
+// encoder.
+//
+// Deprecated: use WriteIntFrame or WriteFloatFrame which validate the frame
+// and convert it to the format of the encoder.
 func (e *Encoder) WriteFrame(value interface{}) error {
 	if !e.wroteHeader {
-		e.writeHeader()
-	}
-	if !e.pcmChunkStarted {
-		// sound header
-		if err := e.AddLE(riff.DataFormatID); err != nil {
-			return fmt.Errorf("error encoding sound header %w", err)
+		if err := e.writeHeader(); err != nil {
+			return err
 		}
-		e.pcmChunkStarted = true
+	}
+	if err := e.startPCMChunk(); err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, value); err != nil {
+		return err
+	}
+	// the value might only be a part of a frame
+	if blockAlign := e.NumChans * e.BitDepth / 8; blockAlign > 0 {
+		e.partialFrame += buf.Len()
+		e.frames += e.partialFrame / blockAlign
+		e.partialFrame %= blockAlign
+	}
+	if e.md5 != nil {
+		e.md5.Write(buf.Bytes())
+	}
+	if err := e.AddBE(buf.Bytes()); err != nil {
+		return err
+	}
+	return e.observeBytes(buf.Bytes())
+}
 
-		// write a temporary chunksize
+// startPCMChunk writes the PCM chunk header if it wasn't written yet.
+func (e *Encoder) startPCMChunk() error {
+	if e.pcmChunkStarted {
+		return nil
+	}
+	// sound header
+	if err := e.AddLE(riff.DataFormatID); err != nil {
+		return fmt.Errorf("error encoding sound header %w", err)
+	}
+	e.pcmChunkStarted = true
+
+	// write a temporary chunksize
+	chunkSize := uint32(4294967295)
+	if e.stream {
+		if e.streamFrames >= 0 {
+			chunkSize = uint32(e.streamDataSize())
+		}
+	} else {
 		e.pcmChunkSizePos = e.WrittenBytes
-		if err := e.AddLE(uint32(4294967295)); err != nil {
-			return fmt.Errorf("%w when writing wav data chunk size header", err)
+	}
+	if err := e.AddLE(chunkSize); err != nil {
+		return fmt.Errorf("%w when writing wav data chunk size header", err)
+	}
+
+	if e.PeakEnvelope != nil {
+		levl, err := newPeakEnvelopeWriter(e.PeakEnvelope, e.NumChans)
+		if err != nil {
+			return err
+		}
+		e.levl = levl
+	}
+	if e.Peak != nil {
+		peak, err := newPeakWriter(e.Peak, e.NumChans)
+		if err != nil {
+			return err
 		}
+		e.peak = peak
+	}
+	if e.WriteMD5 {
+		e.md5 = md5.New()
+	}
+	e.quant = newQuantizer(e.Dither, e.NoiseShaping, e.BitDepth, e.NumChans)
+	return nil
+}
+
+// AudioMD5 returns the MD5 of the PCM data written so far, nil if WriteMD5
+// wasn't set.
+func (e *Encoder) AudioMD5() []byte {
+	if e.md5 == nil {
+		return nil
 	}
+	return e.md5.Sum(nil)
+}
 
-	e.frames++
-	return e.AddLE(value)
+// observe passes the written sample to the enabled analyzers.
+func (e *Encoder) observe(v int) {
+	if !e.observing() {
+		return
+	}
+	if e.BitDepth == 8 {
+		// 8 bit samples are unsigned
+		e.observeFloat(float64(v-128) / 128)
+		return
+	}
+	e.observeFloat(float64(v) / float64(int(1)<<uint(e.BitDepth-1)))
+}
+
+// observeFloatSample passes a float sample to the enabled analyzers, the
+// samples written to integer formats being clipped.
+func (e *Encoder) observeFloatSample(v float64, float bool) {
+	if !float {
+		v = math.Max(-1, math.Min(1, v))
+	}
+	e.observeFloat(v)
+}
+
+// observeFloat passes the written sample, scaled to the [-1, 1] range, to
+// the enabled analyzers.
+func (e *Encoder) observeFloat(s float64) {
+	if e.levl != nil {
+		e.levl.add(s)
+	}
+	if e.peak != nil {
+		e.peak.add(s)
+	}
+}
+
+// observing returns positively if an analyzer needs the written samples.
+func (e *Encoder) observing() bool {
+	return e.levl != nil || e.peak != nil
+}
+
+// observeBytes passes the samples contained in the written PCM bytes to the
+// enabled analyzers.
+func (e *Encoder) observeBytes(b []byte) error {
+	if !e.observing() {
+		return nil
+	}
+	e.pending = append(e.pending, b...)
+	bPerSample := bytesPerSample(e.BitDepth)
+	if bPerSample == 0 {
+		return fmt.Errorf("unhandled bit depth:%d", e.BitDepth)
+	}
+	size := len(e.pending) / bPerSample
+	var n int
+	if e.WavAudioFormat == wavFormatIEEEFloat {
+		if cap(e.observedFloats) < size {
+			e.observedFloats = make([]float32, size)
+		}
+		var err error
+		if n, err = decodeFloat32s(e.observedFloats[:size], e.pending, e.BitDepth, true); err != nil {
+			return err
+		}
+		for _, v := range e.observedFloats[:n] {
+			e.observeFloatSample(float64(v), true)
+		}
+	} else {
+		if cap(e.observedInts) < size {
+			e.observedInts = make([]int, size)
+		}
+		var err error
+		if n, err = decodeInts(e.observedInts[:size], e.pending, e.BitDepth); err != nil {
+			return err
+		}
+		for _, v := range e.observedInts[:n] {
+			e.observe(v)
+		}
+	}
+	// the bytes of a partial sample are kept for the next call
+	e.pending = append(e.pending[:0], e.pending[n*bPerSample:]...)
+	return nil
 }
 
 func (e *Encoder) writeMetadata() error {
-	chunkData := encodeInfoChunk(e)
-	if err := e.AddBE(CIDList); err != nil {
-		return fmt.Errorf("failed to write the LIST chunk ID: %w", err)
+	if err := e.checkInfoCharset(); err != nil {
+		return err
+	}
+	// the CSET chunk must precede the text chunks
+	if chunkData := encodeCSETChunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDCSET, chunkData); err != nil {
+			return err
+		}
 	}
-	if err := e.AddLE(uint32(len(chunkData))); err != nil {
-		return fmt.Errorf("failed to write the LIST chunk size: %w", err)
+	if err := e.writeCues(); err != nil {
+		return fmt.Errorf("failed to write the markers - %w", err)
 	}
-	return e.AddBE(chunkData)
+	if chunkData := encodeBextChunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDBext, chunkData); err != nil {
+			return err
+		}
+	}
+	if chunkData := encodeInfoChunk(e); len(chunkData) > len(CIDInfo) {
+		if err := e.writeChunk(CIDList, chunkData); err != nil {
+			return err
+		}
+	}
+	if e.Metadata != nil {
+		for _, disp := range e.Metadata.Displays {
+			if err := e.writeChunk(CIDDisp, encodeDISPChunk(disp)); err != nil {
+				return err
+			}
+		}
+	}
+	if chunkData := encodeID3Chunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDID3, chunkData); err != nil {
+			return err
+		}
+	}
+	if chunkData := encodeXMPChunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDXMP, chunkData); err != nil {
+			return err
+		}
+	}
+	if chunkData := encodeChnaChunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDChna, chunkData); err != nil {
+			return err
+		}
+	}
+	if chunkData := encodeAxmlChunk(e); chunkData != nil {
+		if err := e.writeChunk(CIDAxml, chunkData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChunk writes a chunk header followed by the passed data and the
+// padding byte needed to keep the next chunk word aligned.
+func (e *Encoder) writeChunk(id [4]byte, data []byte) error {
+	if err := e.AddBE(id); err != nil {
+		return fmt.Errorf("failed to write the %s chunk ID: %w", id[:], err)
+	}
+	if err := e.AddLE(uint32(len(data))); err != nil {
+		return fmt.Errorf("failed to write the %s chunk size: %w", id[:], err)
+	}
+	if err := e.AddBE(data); err != nil {
+		return fmt.Errorf("failed to write the %s chunk: %w", id[:], err)
+	}
+	if len(data)%2 == 1 {
+		return e.AddBE(uint8(0))
+	}
+	return nil
 }
 
 // Close flushes the content to disk, make sure the headers are up to date
@@ -240,9 +737,54 @@ func (e *Encoder) Close() error {
 		return nil
 	}
 
+	if e.resampler != nil {
+		e.resampler.flush()
+		if err := e.drainResampler(); err != nil {
+			return fmt.Errorf("failed to write the resampled frames - %w", err)
+		}
+	}
+
+	if e.stream && !e.pcmChunkStarted {
+		// the announced headers are written even if no frame was
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+		if err := e.startPCMChunk(); err != nil {
+			return err
+		}
+	}
+
+	// all chunks must be word aligned
+	if e.pcmChunkStarted && e.pcmDataSize()%2 == 1 {
+		if err := e.AddLE(uint8(0)); err != nil {
+			return fmt.Errorf("%w when writing the PCM chunk padding", err)
+		}
+	}
+
+	if e.md5 != nil {
+		if err := e.writeChunk(CIDMD5, e.AudioMD5()); err != nil {
+			return fmt.Errorf("failed to write the PCM checksum - %w", err)
+		}
+	}
+	if e.peak != nil {
+		e.peak.close(time.Now())
+		if err := e.writeChunk(CIDPeak, encodePeakChunk(e.Peak)); err != nil {
+			return fmt.Errorf("failed to write the peaks - %w", err)
+		}
+	}
+	if e.levl != nil {
+		e.levl.close(time.Now())
+		if err := e.writeChunk(CIDLevl, encodeLevlChunk(e.PeakEnvelope)); err != nil {
+			return fmt.Errorf("failed to write the peak envelope - %w", err)
+		}
+	}
+
 	// inject metadata at the end to not trip implementation not supporting
 	// metadata chunks
-	if e.Metadata != nil {
+	if e.stream {
+		return e.closeStream()
+	}
+	if e.Metadata != nil || e.hasCues() {
 		if err := e.writeMetadata(); err != nil {
 			return fmt.Errorf("failed to write metadata - %w", err)
 		}
@@ -261,12 +803,21 @@ func (e *Encoder) Close() error {
 		if _, err := e.w.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
 			return err
 		}
-		chunksize := uint32((int(e.BitDepth) / 8) * int(e.NumChans) * e.frames)
-		if err := e.AddLE(uint32(chunksize)); err != nil {
+		if err := e.AddLE(uint32(e.pcmDataSize())); err != nil {
 			return fmt.Errorf("%w when writing wav data chunk size header", err)
 		}
 	}
 
+	// rewrite the number of frames of the fact chunk
+	if e.factSampleLengthPos > 0 {
+		if _, err := e.w.Seek(int64(e.factSampleLengthPos), 0); err != nil {
+			return err
+		}
+		if err := e.AddLE(uint32(e.frames)); err != nil {
+			return fmt.Errorf("%w when writing the fact sample length", err)
+		}
+	}
+
 	// jump back to the end of the file.
 	if _, err := e.w.Seek(0, 2); err != nil {
 		return err
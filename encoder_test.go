@@ -1,9 +1,21 @@
 package wav
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
 	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
 )
 
 func TestEncoderRoundTrip(t *testing.T) {
@@ -156,3 +168,1532 @@ func TestEncoderRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestEncoderID3RoundTrip(t *testing.T) {
+	for _, version := range []uint8{3, 4} {
+		meta := &Metadata{
+			Title:  "Déjà vu",
+			Artist: "日本のアーティスト",
+			ID3: &ID3Tag{
+				Version:  version,
+				Text:     map[string]string{"TBPM": "120"},
+				UserText: []*ID3UserText{{Description: "CATALOG", Value: "GA-001"}},
+				Comments: []*ID3Comment{{Language: "eng", Description: "note", Text: "first"}},
+				Pictures: []*ID3Picture{{MIMEType: "image/png", PictureType: 3, Description: "cover", Data: []byte{0x89, 'P', 'N', 'G'}}},
+			},
+		}
+		d := roundTripMetadata(t, "fixtures/kick.wav", meta)
+		tag := d.Metadata.ID3
+		if tag == nil {
+			t.Fatalf("v2.%d: expected an ID3 tag", version)
+		}
+		if tag.Version != version {
+			t.Errorf("expected version %d, got %d", version, tag.Version)
+		}
+		if tag.Text["TIT2"] != meta.Title || tag.Text["TPE1"] != meta.Artist || tag.Text["TBPM"] != "120" {
+			t.Errorf("v2.%d: unexpected text frames %#v", version, tag.Text)
+		}
+		if !reflect.DeepEqual(tag.UserText, meta.ID3.UserText) {
+			t.Errorf("v2.%d: expected user text %#v, got %#v", version, meta.ID3.UserText, tag.UserText)
+		}
+		if !reflect.DeepEqual(tag.Comments, meta.ID3.Comments) {
+			t.Errorf("v2.%d: expected comments %#v, got %#v", version, meta.ID3.Comments, tag.Comments)
+		}
+		if !reflect.DeepEqual(tag.Pictures, meta.ID3.Pictures) {
+			t.Errorf("v2.%d: expected pictures %#v, got %#v", version, meta.ID3.Pictures, tag.Pictures)
+		}
+		if d.Metadata.Comments != "first" {
+			t.Errorf("v2.%d: expected the comment to be mapped, got %q", version, d.Metadata.Comments)
+		}
+	}
+}
+
+func TestEncoderID3MultipleValues(t *testing.T) {
+	testCases := []struct {
+		version uint8
+		// composers and genres are the encoded values of the TCOM and TCON
+		// frames
+		composers string
+		genres    string
+	}{
+		{3, "Jane/John", "Rock\x00Pop"},
+		{4, "Jane\x00John", "Rock\x00Pop"},
+	}
+	for _, tc := range testCases {
+		meta := &Metadata{ID3: &ID3Tag{
+			Version:  tc.version,
+			Text:     map[string]string{"TCOM": "Jane; John", "TCON": "Rock; Pop"},
+			UserText: []*ID3UserText{{Description: "MOOD", Value: "calm; dark"}},
+		}}
+		e := &Encoder{Metadata: meta}
+		raw := encodeID3Chunk(e)
+		for _, s := range []string{tc.composers, tc.genres, "calm\x00dark"} {
+			if !bytes.Contains(raw, []byte(s)) {
+				t.Errorf("v2.%d: expected the tag to contain %q, got %q", tc.version, s, raw)
+			}
+		}
+		d := roundTripMetadata(t, "fixtures/kick.wav", meta)
+		tag := d.Metadata.ID3
+		if tag == nil {
+			t.Fatalf("v2.%d: expected an ID3 tag", tc.version)
+		}
+		if !reflect.DeepEqual(tag.Text, meta.ID3.Text) {
+			t.Errorf("v2.%d: expected text frames %#v, got %#v", tc.version, meta.ID3.Text, tag.Text)
+		}
+		if !reflect.DeepEqual(tag.UserText, meta.ID3.UserText) {
+			t.Errorf("v2.%d: expected user text %#v, got %#v", tc.version, meta.ID3.UserText, tag.UserText)
+		}
+	}
+}
+
+// roundTripMetadata encodes the PCM data of the passed file with the passed
+// metadata and returns a decoder with the metadata of the new file read.
+func roundTripMetadata(t *testing.T, in string, meta *Metadata) *Decoder {
+	t.Helper()
+	f, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Mkdir("testOutput", 0777)
+	outPath := path.Join("testOutput", "meta_"+path.Base(in))
+	out, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outPath)
+	e := NewEncoder(out, buf.Format.SampleRate, int(d.BitDepth), buf.Format.NumChannels, int(d.WavAudioFormat))
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	e.Metadata = meta
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := NewDecoder(bytes.NewReader(data))
+	nd.ReadMetadata()
+	if err := nd.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if nd.Metadata == nil {
+		t.Fatal("expected some metadata, got a nil value")
+	}
+	return nd
+}
+
+func TestEncoderXMPRoundTrip(t *testing.T) {
+	meta := &Metadata{XMP: &XMP{
+		Title:   "Tom & Jerry <live>",
+		Creator: []string{"Jane"},
+		Rights:  "CC-BY",
+		Tempo:   97,
+		Key:     "F#",
+		Markers: []*XMPMarker{
+			{Name: "hit", Type: "Cue", Start: 1000},
+			{Name: "frames", Start: 25, Duration: 50, FrameRate: "f25"},
+		},
+	}}
+	d := roundTripMetadata(t, "fixtures/kick.wav", meta)
+	x := d.Metadata.XMP
+	if x == nil {
+		t.Fatal("expected an XMP packet")
+	}
+	if len(x.Raw) == 0 {
+		t.Fatal("expected the raw packet to be available")
+	}
+	x.Raw = nil
+	expected := *meta.XMP
+	expected.Markers = []*XMPMarker{
+		{Name: "hit", Type: "Cue", Start: 1000, FrameRate: "f22050"},
+		{Name: "frames", Start: 25, Duration: 50, FrameRate: "f25"},
+	}
+	if !reflect.DeepEqual(x, &expected) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", &expected, x)
+	}
+}
+
+func TestEncoderXMPUpdate(t *testing.T) {
+	packet := []byte(`<?xpacket begin="` + "\xEF\xBB\xBF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+   xmp:CreatorTool="Adobe Audition"
+   xmpDM:tempo="128">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Old title</rdf:li></rdf:Alt></dc:title>
+   <xmpDM:Tracks>
+    <rdf:Bag>
+     <rdf:li rdf:parseType="Resource">
+      <xmpDM:trackName>CuePoint Markers</xmpDM:trackName>
+      <xmpDM:frameRate>f22050</xmpDM:frameRate>
+      <xmpDM:markers><rdf:Seq><rdf:li xmpDM:startTime="100" xmpDM:name="old"/></rdf:Seq></xmpDM:markers>
+     </rdf:li>
+     <rdf:li rdf:parseType="Resource">
+      <xmpDM:trackName>Speech</xmpDM:trackName>
+      <xmpDM:trackType>Speech</xmpDM:trackType>
+     </rdf:li>
+    </rdf:Bag>
+   </xmpDM:Tracks>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	x, err := ParseXMP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.Title = "New <title>"
+	x.Tempo = 0
+	x.Key = "Am"
+	x.Markers = []*XMPMarker{{Name: "new", Start: 200, FrameRate: "f22050"}}
+
+	d := roundTripMetadata(t, "fixtures/kick.wav", &Metadata{XMP: x})
+	got := d.Metadata.XMP
+	if got == nil {
+		t.Fatal("expected an XMP packet")
+	}
+	expected := &XMP{Raw: got.Raw, Title: x.Title, Key: "Am", Markers: x.Markers}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", expected, got)
+	}
+	// the properties which aren't modeled are kept
+	for _, s := range []string{`="Adobe Audition"`, "<xmpDM:trackType>Speech</xmpDM:trackType>", `<?xpacket end="w"?>`} {
+		if !bytes.Contains(got.Raw, []byte(s)) {
+			t.Fatalf("expected the packet to contain %s, got\n%s", s, got.Raw)
+		}
+	}
+	for _, s := range []string{"Old title", "tempo", "old"} {
+		if bytes.Contains(got.Raw, []byte(s)) {
+			t.Fatalf("expected %s to be removed from the packet, got\n%s", s, got.Raw)
+		}
+	}
+}
+
+func TestEncoderXMPKeepPacket(t *testing.T) {
+	packet := []byte(`<?xpacket begin="` + "\xEF\xBB\xBF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <!-- edited by hand -->
+ <rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
+  <rdf:Description rdf:about='' xmlns:dc='http://purl.org/dc/elements/1.1/' xmlns:xmpDM='http://ns.adobe.com/xmp/1.0/DynamicMedia/' xmpDM:tempo='fast'>
+   <?adobe-xap-filters esc="CRLF"?>
+   <dc:title><rdf:Alt><rdf:li xml:lang="fr-FR">Le titre</rdf:li><rdf:li xml:lang="x-default">The title</rdf:li><rdf:li xml:lang="de">Der Titel</rdf:li></rdf:Alt></dc:title>
+   <dc:rights><rdf:Alt><rdf:li xml:lang="x-default">All rights reserved</rdf:li><rdf:li xml:lang="fr-FR">Tous droits réservés</rdf:li></rdf:Alt></dc:rights>
+   <xmpDM:markers><rdf:Seq><rdf:li xmpDM:startTime="100" xmpDM:name="cue"/></rdf:Seq></xmpDM:markers>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	x, err := ParseXMP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the untouched packet is written as is
+	d := roundTripMetadata(t, "fixtures/kick.wav", &Metadata{XMP: x})
+	if got := d.Metadata.XMP; got == nil || !bytes.Equal(got.Raw, packet) {
+		t.Fatalf("expected the packet to be kept, got\n%s", got.Raw)
+	}
+
+	// only the modified property is rewritten
+	x.Title = "New title"
+	d = roundTripMetadata(t, "fixtures/kick.wav", &Metadata{XMP: x})
+	got := d.Metadata.XMP
+	if got == nil {
+		t.Fatal("expected an XMP packet")
+	}
+	expected := bytes.Replace(packet, []byte(">The title<"), []byte(">New title<"), 1)
+	if !bytes.Equal(got.Raw, expected) {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, got.Raw)
+	}
+	if got.Title != "New title" || got.Rights != "All rights reserved" || len(got.Markers) != 1 {
+		t.Fatalf("unexpected values %+v", got)
+	}
+}
+
+func TestEncoderInfoRoundTrip(t *testing.T) {
+	meta := &Metadata{
+		Artist:           "first artist",
+		Title:            "odd",
+		DigitizationDate: "Wed Jan 02 02:03:55 1990",
+		SMPTETimecode:    "01:00:00:00",
+		Language:         "English",
+		BPM:              "120",
+		Commissioned:     "Pope Julian II",
+		Country:          "FR",
+		Part:             "1/3",
+		TrackNbr:         "2/12",
+		ProductionStudio: "Studio A",
+		ExtraInfo: map[string][]string{
+			"IART": {"second artist", "third artist"},
+			"IXYZ": {"custom value"},
+		},
+	}
+	d := roundTripMetadata(t, "fixtures/kick.wav", meta)
+	if !reflect.DeepEqual(d.Metadata, meta) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", meta, d.Metadata)
+	}
+}
+
+func TestEncoderInfoCharset(t *testing.T) {
+	testCases := []struct {
+		charset  Charset
+		codePage uint16
+		title    string
+	}{
+		{CharsetUnknown, 0, "Café € 日本"},
+		{CharsetUTF8, 65001, "Café € 日本"},
+		{CharsetLatin1, 28591, "Café ? ??"},
+		{CharsetWindows1252, 1252, "Café € ??"},
+		{CharsetASCII, 0, "Caf? ? ??"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.charset.String(), func(t *testing.T) {
+			f, err := os.Open("fixtures/kick.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			d := NewDecoder(f)
+			buf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &seekableBuffer{}
+			e := NewEncoder(out, buf.Format.SampleRate, int(d.BitDepth), buf.Format.NumChannels, int(d.WavAudioFormat))
+			e.InfoCharset = tc.charset
+			e.Metadata = &Metadata{Title: "Café € 日本"}
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			nd := NewDecoder(bytes.NewReader(out.Bytes()))
+			nd.ReadMetadata()
+			if err := nd.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if nd.Metadata.Title != tc.title {
+				t.Errorf("expected %q, got %q", tc.title, nd.Metadata.Title)
+			}
+			var codePage uint16
+			if nd.Metadata.CharacterSet != nil {
+				codePage = nd.Metadata.CharacterSet.CodePage
+			}
+			if codePage != tc.codePage {
+				t.Errorf("expected code page %d, got %d", tc.codePage, codePage)
+			}
+		})
+	}
+}
+
+func TestEncoderUnsupportedCodePage(t *testing.T) {
+	// Shift JIS
+	cset := &CharacterSet{CodePage: 932}
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 44100, 16, 1, 1)
+	e.Metadata = &Metadata{Title: "title", CharacterSet: cset}
+	if err := e.Close(); err == nil || !strings.Contains(err.Error(), "code page 932") {
+		t.Fatalf("expected the unsupported code page to be refused, got %v", err)
+	}
+
+	// the strings can be written using another charset
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 44100, 16, 1, 1)
+	e.InfoCharset = CharsetUTF8
+	e.Metadata = &Metadata{Title: "title", CharacterSet: cset}
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: []int{1, 2, 3, 4}, SourceBitDepth: 16}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata.CharacterSet == nil || d.Metadata.CharacterSet.CodePage != 65001 || d.Metadata.Title != "title" {
+		t.Fatalf("unexpected metadata %+v", d.Metadata)
+	}
+}
+
+// seekableBuffer is an in memory io.WriteSeeker.
+type seekableBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekableBuffer) Write(p []byte) (int, error) {
+	if extra := b.pos + len(p) - len(b.buf); extra > 0 {
+		b.buf = append(b.buf, make([]byte, extra)...)
+	}
+	n := copy(b.buf[b.pos:], p)
+	b.pos += n
+	return n, nil
+}
+
+func (b *seekableBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = int(offset)
+	return offset, nil
+}
+
+func (b *seekableBuffer) Bytes() []byte {
+	return b.buf
+}
+
+func TestEncoderPeakEnvelope(t *testing.T) {
+	testCases := []struct {
+		bitDepth int
+		env      *PeakEnvelope
+		values   int
+	}{
+		{16, &PeakEnvelope{}, 2},
+		{24, &PeakEnvelope{Format: PeakEnvelopeFormat8, PointsPerValue: 1, BlockSize: 100}, 1},
+	}
+	for _, tc := range testCases {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, SourceBitDepth: tc.bitDepth}
+		max := 1<<uint(tc.bitDepth-1) - 1
+		for i := 0; i < 300; i++ {
+			// left channel is at half scale, right one at full scale
+			l, r := max/2, -max
+			if i%2 == 1 {
+				l, r = -l, -r
+			}
+			if i >= 200 {
+				l, r = 0, 0
+			}
+			buf.Data = append(buf.Data, l, r)
+		}
+		out := &seekableBuffer{}
+		e := NewEncoder(out, 44100, tc.bitDepth, 2, 1)
+		e.PeakEnvelope = tc.env
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewDecoder(bytes.NewReader(out.Bytes()))
+		d.ReadMetadata()
+		if err := d.Err(); err != nil {
+			t.Fatal(err)
+		}
+		env := d.Metadata.PeakEnvelope
+		if env == nil {
+			t.Fatal("expected a peak envelope")
+		}
+		blockSize := int(tc.env.BlockSize)
+		if blockSize == 0 {
+			blockSize = 256
+		}
+		expectedFrames := (300 + blockSize - 1) / blockSize
+		if int(env.NumPeakFrames) != expectedFrames || env.NumChannels != 2 || len(env.Peaks) != expectedFrames*2*tc.values {
+			t.Fatalf("unexpected envelope layout %+v", env)
+		}
+		if env.PosPeakOfPeaks != 0 {
+			t.Errorf("expected the peak of peaks at frame 0, got %d", env.PosPeakOfPeaks)
+		}
+		if len(env.Timestamp) != 23 {
+			t.Errorf("unexpected timestamp %q", env.Timestamp)
+		}
+		pos, neg := env.Peak(0, 0)
+		if math.Abs(pos-0.5) > 0.01 || math.Abs(neg-0.5) > 0.01 {
+			t.Errorf("expected the left channel peaks to be 0.5, got %f %f", pos, neg)
+		}
+		pos, neg = env.Peak(0, 1)
+		if math.Abs(pos-1) > 0.01 || math.Abs(neg-1) > 0.01 {
+			t.Errorf("expected the right channel peaks to be 1, got %f %f", pos, neg)
+		}
+		if pos, neg = env.Peak(expectedFrames-1, 1); pos != 0 || neg != 0 {
+			t.Errorf("expected the last block to be silent, got %f %f", pos, neg)
+		}
+	}
+
+	e := NewEncoder(&seekableBuffer{}, 44100, 16, 0, 1)
+	e.PeakEnvelope = &PeakEnvelope{}
+	if err := e.WriteFrame(int16(0)); err == nil {
+		t.Fatal("expected the peak envelope of a file without channels to be refused")
+	}
+}
+
+func TestEncoderPeak(t *testing.T) {
+	// stereo file written with Write
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 44100, 16, 2, 1)
+	e.Peak = &Peak{}
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{NumChannels: 2, SampleRate: 44100},
+		Data:   []int{0, 0, 100, -16384, 8192, 200, -300, 0},
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ChannelPeak{{Value: 0.25, Position: 2}, {Value: 0.5, Position: 1}}
+	if d.Metadata.Peak == nil || !reflect.DeepEqual(d.Metadata.Peak.Channels, expected) {
+		t.Fatalf("expected peaks %+v, got %+v", expected, d.Metadata.Peak)
+	}
+	if d.Metadata.Peak.Version != 1 || d.Metadata.Peak.Timestamp != e.Peak.Timestamp || d.Metadata.Peak.Time().IsZero() {
+		t.Fatalf("unexpected PEAK header %+v", d.Metadata.Peak)
+	}
+
+	// mono 8 bit file written with WriteFrame
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 22050, 8, 1, 1)
+	e.Peak = &Peak{}
+	for _, v := range []uint8{128, 160, 0, 140} {
+		if err := e.WriteFrame(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d = NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected = []ChannelPeak{{Value: 1, Position: 2}}
+	if d.Metadata.Peak == nil || !reflect.DeepEqual(d.Metadata.Peak.Channels, expected) {
+		t.Fatalf("expected peaks %+v, got %+v", expected, d.Metadata.Peak)
+	}
+
+	// IEEE float samples written with WriteFrame
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 22050, 32, 1, 3)
+	e.Peak = &Peak{}
+	for _, v := range []float32{0.25, -0.75, 0.5} {
+		if err := e.WriteFrame(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected = []ChannelPeak{{Value: 0.75, Position: 1}}; !reflect.DeepEqual(e.Peak.Channels, expected) {
+		t.Fatalf("expected peaks %+v, got %+v", expected, e.Peak.Channels)
+	}
+
+	// no channel to track
+	e = NewEncoder(&seekableBuffer{}, 22050, 8, 0, 1)
+	e.Peak = &Peak{}
+	if err := e.WriteFrame(uint8(128)); err == nil {
+		t.Fatal("expected the PEAK chunk of a file without channels to be refused")
+	}
+}
+
+func TestEncoderMD5(t *testing.T) {
+	// odd sized PCM data so the padding byte must be ignored
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 22050, 8, 1, 1)
+	e.WriteMD5 = true
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{NumChannels: 1, SampleRate: 22050},
+		Data:   []int{128, 160, 0},
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFrame(uint8(140)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFrame(uint8(20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte{128, 160, 0, 140, 20})
+	if !bytes.Equal(e.AudioMD5(), sum[:]) {
+		t.Fatalf("expected the encoder checksum to be %x, got %x", sum, e.AudioMD5())
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	if err := d.VerifyChecksum(); err != nil {
+		t.Fatal(err)
+	}
+	// the decoder must be ready to read the PCM data
+	intBuf := &audio.IntBuffer{Data: make([]int, 8)}
+	n, err := d.PCMBuffer(intBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{128, 160, 0, 140, 20}; n < len(expected) || !reflect.DeepEqual(intBuf.Data[:len(expected)], expected) {
+		t.Fatalf("expected %v, got %v", expected, intBuf.Data[:n])
+	}
+	d = NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if !bytes.Equal(d.Metadata.AudioMD5, sum[:]) {
+		t.Fatalf("expected the decoded checksum to be %x, got %x", sum, d.Metadata.AudioMD5)
+	}
+
+	// corrupt a sample
+	corrupted := out.Bytes()
+	corrupted[45] ^= 0xFF
+	err = NewDecoder(bytes.NewReader(corrupted)).VerifyChecksum()
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if !bytes.Equal(checksumErr.Expected, sum[:]) {
+		t.Fatalf("expected the error to report %x, got %x", sum, checksumErr.Expected)
+	}
+
+	// no checksum
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 22050, 8, 1, 1)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDecoder(bytes.NewReader(out.Bytes())).VerifyChecksum(); err != ErrChecksumNotFound {
+		t.Fatalf("expected %v, got %v", ErrChecksumNotFound, err)
+	}
+}
+
+func TestEncoderFact(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		audioFormat int
+		hasFact     bool
+	}{
+		{"PCM", 1, false},
+		{"IEEE float", 3, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := &seekableBuffer{}
+			e := NewEncoder(out, 8000, 32, 2, tc.audioFormat)
+			buf := &audio.IntBuffer{
+				Format: &audio.Format{NumChannels: 2, SampleRate: 8000},
+				Data:   make([]int, 2*400),
+			}
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if hasFact := bytes.Contains(out.Bytes(), CIDFact[:]); hasFact != tc.hasFact {
+				t.Fatalf("expected the fact chunk presence to be %t", tc.hasFact)
+			}
+
+			d := NewDecoder(bytes.NewReader(out.Bytes()))
+			n, err := d.NumFrames()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 400 {
+				t.Fatalf("expected 400 frames, got %d", n)
+			}
+			if d.hasFact != tc.hasFact || (tc.hasFact && d.factSampleLength != 400) {
+				t.Fatalf("unexpected fact sample length %d", d.factSampleLength)
+			}
+			if int(d.WavAudioFormat) != tc.audioFormat || d.NumChans != 2 || d.BitDepth != 32 {
+				t.Fatalf("unexpected format %d, %d channels, %d bits", d.WavAudioFormat, d.NumChans, d.BitDepth)
+			}
+			if !tc.hasFact {
+				return
+			}
+			d = NewDecoder(bytes.NewReader(out.Bytes()))
+			d.ReadInfo()
+			pos, _ := d.r.Seek(0, io.SeekCurrent)
+			dur, err := d.Duration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := 50 * time.Millisecond; dur != expected {
+				t.Fatalf("expected a duration of %s, got %s", expected, dur)
+			}
+			// the duration is a query which doesn't move the decoder
+			if cur, _ := d.r.Seek(0, io.SeekCurrent); cur != pos || d.WasPCMAccessed() {
+				t.Fatalf("expected the decoder to stay at %d, got %d", pos, cur)
+			}
+			if buf, err := d.FullPCMBuffer(); err != nil || len(buf.Data) != 2*400 {
+				t.Fatalf("expected 800 samples after getting the duration, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEncoderMetadataCues(t *testing.T) {
+	// INFO only metadata doesn't get cue or smpl chunks
+	d := roundTripMetadata(t, "fixtures/kick.wav", &Metadata{Title: "kick"})
+	if d.Metadata.CuePoints != nil || d.Metadata.SamplerInfo != nil {
+		t.Fatalf("unexpected cue points %v and sampler info %v", d.Metadata.CuePoints, d.Metadata.SamplerInfo)
+	}
+
+	cue := &CuePoint{ID: [4]byte{1}, Position: 10, DataChunkID: [4]byte{'d', 'a', 't', 'a'}, SampleOffset: 10}
+	meta := &Metadata{
+		CuePoints:   []*CuePoint{cue},
+		Labels:      []*CueLabel{{CueID: [4]byte{1}, Text: "hit"}},
+		SamplerInfo: &SamplerInfo{MIDIUnityNote: 60},
+	}
+	d = roundTripMetadata(t, "fixtures/kick.wav", meta)
+	if len(d.Metadata.CuePoints) != 1 || *d.Metadata.CuePoints[0] != *cue {
+		t.Fatalf("expected the cue point to be written, got %v", d.Metadata.CuePoints)
+	}
+	if len(d.Metadata.Labels) != 1 || d.Metadata.Labels[0].Text != "hit" {
+		t.Fatalf("expected the label to be written, got %v", d.Metadata.Labels)
+	}
+	if d.Metadata.SamplerInfo == nil || d.Metadata.SamplerInfo.MIDIUnityNote != 60 {
+		t.Fatalf("expected the sampler info to be written, got %v", d.Metadata.SamplerInfo)
+	}
+}
+
+func TestEncoderMarkers(t *testing.T) {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 8000, 16, 1, 1)
+	e.InfoCharset = CharsetWindows1252
+	e.SetMarkers(
+		&Marker{Frame: 100, Label: "intro", Note: "café"},
+		&Marker{ID: 1, Time: 500 * time.Millisecond, Label: "verse"},
+	)
+	e.SetRegions(
+		&Region{Start: 200, Length: 50, Label: "hit"},
+		&Region{StartTime: time.Second, Duration: 250 * time.Millisecond, Loop: true, PlayCount: 2},
+	)
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{NumChannels: 1, SampleRate: 8000},
+		Data:   make([]int, 16000),
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	markers, err := d.Markers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMarkers := []*Marker{
+		{ID: 2, Frame: 100, Time: 12500 * time.Microsecond, Label: "intro", Note: "café"},
+		{ID: 1, Frame: 4000, Time: 500 * time.Millisecond, Label: "verse"},
+	}
+	if !reflect.DeepEqual(markers, expectedMarkers) {
+		t.Fatalf("expected markers %+v, got %+v", expectedMarkers, markers)
+	}
+	regions, err := d.Regions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRegions := []*Region{
+		{ID: 3, Start: 200, Length: 50, StartTime: 25 * time.Millisecond, Duration: 6250 * time.Microsecond, Label: "hit"},
+		{ID: 4, Start: 8000, Length: 2000, StartTime: time.Second, Duration: 250 * time.Millisecond, Loop: true, PlayCount: 2},
+	}
+	if !reflect.DeepEqual(regions, expectedRegions) {
+		t.Fatalf("expected regions %+v, got %+v", expectedRegions, regions)
+	}
+	if d.Metadata.CharacterSet == nil || d.Metadata.CharacterSet.CodePage != 1252 {
+		t.Fatalf("expected a CSET chunk, got %+v", d.Metadata.CharacterSet)
+	}
+	if d.Metadata.SamplerInfo == nil || d.Metadata.SamplerInfo.SamplePeriod != 125000 {
+		t.Fatalf("unexpected sampler info %+v", d.Metadata.SamplerInfo)
+	}
+}
+
+func TestEncoderADM(t *testing.T) {
+	alloc := &ChannelAllocation{
+		AudioIDs: []*AudioID{
+			{TrackIndex: 1, UID: "ATU_00000001", TrackFormatRef: "AT_00010001_01", PackFormatRef: "AP_00010002"},
+			{TrackIndex: 2, UID: "ATU_00000002", TrackFormatRef: "AT_00010002_01", PackFormatRef: "AP_00010002"},
+		},
+	}
+	adm := &ADM{
+		Objects: []*ADMObject{{
+			ID:             "AO_1001",
+			Name:           "Dialogue & FX",
+			Start:          "00:00:00.00000",
+			PackFormatRefs: []string{"AP_00010002"},
+			TrackUIDRefs:   []string{"ATU_00000001", "ATU_00000002"},
+		}},
+		PackFormats: []*ADMPackFormat{{
+			ID:                "AP_00010002",
+			Name:              "RoomCentricStereo",
+			TypeLabel:         "0001",
+			TypeDefinition:    "DirectSpeakers",
+			ChannelFormatRefs: []string{"AC_00010001", "AC_00010002"},
+		}},
+	}
+
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, 24, 2, 1)
+	e.Metadata = &Metadata{ChannelAllocation: alloc, ADM: adm}
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{NumChannels: 2, SampleRate: 48000},
+		Data:   make([]int, 2*100),
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// the number of tracks defaults to the number of channels
+	alloc.NumTracks = 2
+	if !reflect.DeepEqual(d.Metadata.ChannelAllocation, alloc) {
+		t.Fatalf("expected %+v, got %+v", alloc, d.Metadata.ChannelAllocation)
+	}
+	got := d.Metadata.ADM
+	if got == nil || len(got.Raw) == 0 {
+		t.Fatal("expected an axml chunk")
+	}
+	if !reflect.DeepEqual(got.Objects, adm.Objects) || !reflect.DeepEqual(got.PackFormats, adm.PackFormats) {
+		t.Fatalf("expected %+v, got %+v", adm, got)
+	}
+
+	// documents using prefixed elements are supported
+	prefixed := []byte(`<?xml version="1.0"?>
+<ebu:ebuCoreMain xmlns:ebu="urn:ebu:metadata-schema:ebuCore_2014"><ebu:coreMetadata><ebu:format><ebu:audioFormatExtended>
+<ebu:audioObject audioObjectID="AO_1002" audioObjectName="Music"><ebu:audioPackFormatIDRef>AP_00010003</ebu:audioPackFormatIDRef></ebu:audioObject>
+</ebu:audioFormatExtended></ebu:format></ebu:coreMetadata></ebu:ebuCoreMain>`)
+	parsed, err := ParseADM(prefixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Objects) != 1 || parsed.Objects[0].Name != "Music" || !reflect.DeepEqual(parsed.Objects[0].PackFormatRefs, []string{"AP_00010003"}) {
+		t.Fatalf("unexpected objects %+v", parsed.Objects)
+	}
+}
+
+func TestEncoderADMUpdate(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ebuCoreMain xmlns="urn:ebu:metadata-schema:ebuCore_2016" xml:lang="en"><coreMetadata><format><audioFormatExtended>
+<audioProgramme audioProgrammeID="APR_1001" audioProgrammeName="Main"><audioContentIDRef>ACO_1001</audioContentIDRef></audioProgramme>
+<audioObject audioObjectID="AO_1001" audioObjectName="Bed" interact="0"><audioPackFormatIDRef>AP_00010002</audioPackFormatIDRef><gain>0.5</gain><audioTrackUIDRef>ATU_00000001</audioTrackUIDRef><audioTrackUIDRef>ATU_00000002</audioTrackUIDRef></audioObject>
+<audioObject audioObjectID="AO_1002" audioObjectName="Removed"/>
+<audioPackFormat audioPackFormatID="AP_00010002" audioPackFormatName="Stereo" typeLabel="0001" typeDefinition="DirectSpeakers"><audioChannelFormatIDRef>AC_00010001</audioChannelFormatIDRef><absoluteDistance>1</absoluteDistance></audioPackFormat>
+<audioChannelFormat audioChannelFormatID="AC_00010001" audioChannelFormatName="Left"/>
+</audioFormatExtended></format></coreMetadata></ebuCoreMain>`)
+	adm, err := ParseADM(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adm.Objects[0].Name = "Music bed"
+	adm.Objects[0].TrackUIDRefs = adm.Objects[0].TrackUIDRefs[:1]
+	adm.Objects = append(adm.Objects[:1], &ADMObject{ID: "AO_1003", Name: "Added", TrackUIDRefs: []string{"ATU_00000002"}})
+	adm.PackFormats[0].ChannelFormatRefs = append(adm.PackFormats[0].ChannelFormatRefs, "AC_00010002")
+
+	d := roundTripMetadata(t, "fixtures/kick.wav", &Metadata{ADM: adm})
+	got := d.Metadata.ADM
+	if got == nil {
+		t.Fatal("expected an axml chunk")
+	}
+	if !reflect.DeepEqual(got.Objects, adm.Objects) || !reflect.DeepEqual(got.PackFormats, adm.PackFormats) {
+		t.Fatalf("expected %+v, got %+v", adm, got)
+	}
+	// the elements and attributes which aren't modeled are kept
+	for _, s := range []string{`audioProgrammeID="APR_1001"`, `interact="0"`, "<gain>0.5</gain>", "<absoluteDistance>1</absoluteDistance>", `audioChannelFormatName="Left"`, "ebuCore_2016"} {
+		if !bytes.Contains(got.Raw, []byte(s)) {
+			t.Fatalf("expected the document to contain %s, got\n%s", s, got.Raw)
+		}
+	}
+	if bytes.Contains(got.Raw, []byte("AO_1002")) {
+		t.Fatalf("expected the removed object to be dropped, got\n%s", got.Raw)
+	}
+}
+
+func TestEncoderADMKeepUnmatched(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ebuCoreMain xmlns="urn:ebu:metadata-schema:ebuCore_2014"><coreMetadata><format><audioFormatExtended>
+<audioObject audioObjectID="AO_1001" audioObjectName="Bed"/>
+<audioObject audioObjectName="Unnamed"/>
+<audioPackFormat audioPackFormatID="AP_00010002" audioPackFormatName="Stereo"/>
+</audioFormatExtended></format></coreMetadata></ebuCoreMain>`)
+	// the typed values weren't parsed from the document, its elements are
+	// kept
+	adm := &ADM{Raw: doc, Objects: []*ADMObject{{ID: "AO_1002", Name: "Dialog"}}}
+	d := roundTripMetadata(t, "fixtures/kick.wav", &Metadata{ADM: adm})
+	got := d.Metadata.ADM
+	if got == nil {
+		t.Fatal("expected an axml chunk")
+	}
+	for _, s := range []string{`audioObjectName="Bed"`, `audioObjectName="Unnamed"`, `audioObjectName="Dialog"`, `audioPackFormatName="Stereo"`} {
+		if !bytes.Contains(got.Raw, []byte(s)) {
+			t.Fatalf("expected the document to contain %s, got\n%s", s, got.Raw)
+		}
+	}
+
+	// only the elements deleted from the parsed values are removed
+	parsed, err := ParseADM(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.Objects = parsed.Objects[1:]
+	d = roundTripMetadata(t, "fixtures/kick.wav", &Metadata{ADM: parsed})
+	got = d.Metadata.ADM
+	if got == nil {
+		t.Fatal("expected an axml chunk")
+	}
+	if bytes.Contains(got.Raw, []byte("AO_1001")) || !bytes.Contains(got.Raw, []byte(`audioObjectName="Unnamed"`)) || !bytes.Contains(got.Raw, []byte("AP_00010002")) {
+		t.Fatalf("expected only the deleted object to be removed, got\n%s", got.Raw)
+	}
+	if len(got.Objects) != 1 || got.Objects[0].Name != "Unnamed" {
+		t.Fatalf("unexpected objects %+v", got.Objects)
+	}
+}
+
+func TestEncoderBroadcastExtension(t *testing.T) {
+	umid, err := NewUMID(UMIDMultipleAudio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bext := &BroadcastExtension{
+		Description:     "Scene 12 take 3",
+		Originator:      "go-audio",
+		OriginationDate: "2024-05-06",
+		OriginationTime: "07:08:09",
+		TimeReference:   172800000,
+		Version:         2,
+		LoudnessValue:   -2300,
+		CodingHistory:   "A=PCM,F=48000,W=24,M=stereo\r\n",
+	}
+	bext.SetUMID(umid)
+	picture := &Display{Type: DisplayDIB, Data: []byte{40, 0, 0, 0, 1}}
+
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, 24, 2, 1)
+	e.Metadata = &Metadata{
+		BroadcastExtension: bext,
+		Displays:           []*Display{NewDisplayText("Scene 12"), picture},
+	}
+	buf := &audio.IntBuffer{
+		Format: &audio.Format{NumChannels: 2, SampleRate: 48000},
+		Data:   make([]int, 2*100),
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.Metadata.BroadcastExtension, bext) {
+		t.Fatalf("expected %+v, got %+v", bext, d.Metadata.BroadcastExtension)
+	}
+	parsed, err := ParseUMID(d.Metadata.BroadcastExtension.UMID[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, umid) || parsed.MaterialType() != UMIDMultipleAudio {
+		t.Fatalf("expected UMID %s, got %s", umid, parsed)
+	}
+	if len(d.Metadata.Displays) != 2 {
+		t.Fatalf("expected 2 DISP chunks, got %d", len(d.Metadata.Displays))
+	}
+	if text, ok := d.Metadata.Displays[0].Text(); !ok || text != "Scene 12" {
+		t.Fatalf("unexpected DISP text %q", text)
+	}
+	// odd sized payloads are followed by a padding byte
+	if got := d.Metadata.Displays[1]; got.Type != DisplayDIB || !bytes.HasPrefix(got.Data, picture.Data) {
+		t.Fatalf("unexpected DISP chunk %+v", got)
+	}
+}
+
+func TestParseUMID(t *testing.T) {
+	basic := "060A2B340101010501010D4313000000AE2A3F1C8F2B11D89C5E00A0C9A48C7B"
+	// source pack without time and spatial coordinates
+	pack := strings.Repeat("00", 20) + hex.EncodeToString([]byte("CHE\x00EBU\x00USR\x00"))
+
+	u, err := ParseUMIDString("0x" + basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Extended || u.MaterialType() != UMIDMixed || u.String() != basic {
+		t.Fatalf("unexpected basic UMID %s", u)
+	}
+	// basic UMIDs are padded with zeros in the bext chunk
+	if u, err = ParseUMID(append(u.Bytes(), make([]byte, 32)...)); err != nil || u.String() != basic {
+		t.Fatalf("unexpected padded UMID %s (%v)", u, err)
+	}
+
+	extended := basic[:24] + "33" + basic[26:] + strings.ToUpper(pack)
+	if u, err = ParseUMIDString(extended); err != nil {
+		t.Fatal(err)
+	}
+	if !u.Extended || u.String() != extended || u.Country() != "CHE" || u.Organization() != "EBU" || u.User() != "USR" {
+		t.Fatalf("unexpected extended UMID %s", u)
+	}
+
+	if u, err = ParseUMID(make([]byte, 64)); u != nil || err != nil {
+		t.Fatalf("expected no UMID, got %s (%v)", u, err)
+	}
+	if _, err = ParseUMIDString("060A2B34"); err == nil {
+		t.Fatal("expected an error for a truncated UMID")
+	}
+}
+
+func TestStreamEncoder(t *testing.T) {
+	newBuffer := func(frames int) *audio.IntBuffer {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, SourceBitDepth: 24}
+		for i := 0; i < frames; i++ {
+			buf.Data = append(buf.Data, i*100, -i*100)
+		}
+		return buf
+	}
+
+	testCases := []struct {
+		desc        string
+		audioFormat int
+		numFrames   int
+		setup       func(e *Encoder)
+	}{
+		{"unknown length", 1, UnknownFrames, nil},
+		{"known length", 1, 333, nil},
+		{"known length IEEE float", 3, 333, nil},
+		{"known length with metadata", 1, 333, func(e *Encoder) {
+			e.Metadata = &Metadata{Title: "stream", Artist: "go-audio"}
+			e.SetMarkers(&Marker{Frame: 100, Label: "intro"})
+			e.Peak = &Peak{}
+			e.PeakEnvelope = &PeakEnvelope{BlockSize: 100}
+			e.WriteMD5 = true
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			e := NewStreamEncoder(out, 8000, 24, 2, tc.audioFormat, tc.numFrames)
+			if tc.setup != nil {
+				tc.setup(e)
+			}
+			// the frames are written in several buffers
+			for _, n := range []int{200, 133} {
+				if err := e.Write(newBuffer(n)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b := out.Bytes()
+			riffSize := binary.LittleEndian.Uint32(b[4:8])
+			if tc.numFrames == UnknownFrames {
+				if riffSize != 0xFFFFFFFF {
+					t.Fatalf("expected a placeholder RIFF size, got %d", riffSize)
+				}
+			} else if int(riffSize) != len(b)-8 {
+				t.Fatalf("expected a RIFF size of %d, got %d", len(b)-8, riffSize)
+			}
+
+			d := NewStreamDecoder(onlyReader{bytes.NewReader(b)})
+			buf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buf.Data) != 2*333 {
+				t.Fatalf("expected %d samples, got %d", 2*333, len(buf.Data))
+			}
+			if tc.audioFormat == 1 && buf.Data[2*332+1] != -13200 {
+				t.Fatalf("unexpected last sample %d", buf.Data[2*332+1])
+			}
+			if tc.setup == nil {
+				return
+			}
+			d = NewDecoder(bytes.NewReader(b))
+			markers, err := d.Markers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(markers) != 1 || markers[0].Frame != 100 || markers[0].Label != "intro" {
+				t.Fatalf("unexpected markers %+v", markers)
+			}
+			m := d.Metadata
+			if m.Title != "stream" || m.Peak == nil || m.PeakEnvelope == nil || m.PeakEnvelope.NumPeakFrames != 4 {
+				t.Fatalf("unexpected metadata %+v", m)
+			}
+			if err := NewDecoder(bytes.NewReader(b)).VerifyChecksum(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("refusals", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		e := NewStreamEncoder(out, 8000, 24, 2, 1, UnknownFrames)
+		e.Metadata = &Metadata{Title: "stream"}
+		if err := e.Write(newBuffer(10)); err == nil {
+			t.Fatal("expected metadata of an unknown length stream to be refused")
+		}
+		// nothing can be undone in a stream
+		if out.Len() != 0 {
+			t.Fatalf("expected nothing to be written by refused streams, got %d bytes", out.Len())
+		}
+		e = NewStreamEncoder(&bytes.Buffer{}, 8000, 24, 2, 3, UnknownFrames)
+		if err := e.Write(newBuffer(10)); err == nil {
+			t.Fatal("expected a float stream of unknown length to be refused")
+		}
+		e = NewStreamEncoder(&bytes.Buffer{}, 8000, 24, 2, 1, 10)
+		if err := e.Write(newBuffer(11)); err == nil {
+			t.Fatal("expected writing more frames than announced to fail")
+		}
+		e = NewStreamEncoder(&bytes.Buffer{}, 8000, 24, 2, 1, 10)
+		if err := e.Write(newBuffer(9)); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err == nil {
+			t.Fatal("expected writing less frames than announced to fail")
+		}
+	})
+
+	t.Run("no frames", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		e := NewStreamEncoder(out, 8000, 16, 1, 1, 0)
+		e.Metadata = &Metadata{Title: "empty"}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		d := NewDecoder(bytes.NewReader(out.Bytes()))
+		d.ReadMetadata()
+		if err := d.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if d.Metadata.Title != "empty" {
+			t.Fatalf("unexpected metadata %+v", d.Metadata)
+		}
+		if n, err := NewDecoder(bytes.NewReader(out.Bytes())).NumFrames(); err != nil || n != 0 {
+			t.Fatalf("expected no frames, got %d (%v)", n, err)
+		}
+	})
+}
+
+func TestEncoderWriteFloat32(t *testing.T) {
+	samples := []float32{0, 0.5, -0.5, 1, -1, 1.5, -1.5, 0.25}
+	testCases := []struct {
+		desc        string
+		bitDepth    int
+		audioFormat int
+		expected    []float32
+	}{
+		{"8 bit", 8, 1, []float32{0, 0.5, -0.5, 127.0 / 128, -1, 127.0 / 128, -1, 0.25}},
+		{"16 bit", 16, 1, []float32{0, 0.5, -0.5, 32767.0 / 32768, -1, 32767.0 / 32768, -1, 0.25}},
+		{"24 bit", 24, 1, []float32{0, 0.5, -0.5, 8388607.0 / 8388608, -1, 8388607.0 / 8388608, -1, 0.25}},
+		{"32 bit float", 32, 3, samples},
+		{"64 bit float", 64, 3, samples},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := &seekableBuffer{}
+			e := NewEncoder(out, 8000, tc.bitDepth, 2, tc.audioFormat)
+			e.Peak = &Peak{}
+			buf := &audio.Float32Buffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: samples}
+			if err := e.WriteFloat32(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDecoder(bytes.NewReader(out.Bytes()))
+			if n, err := d.NumFrames(); err != nil || n != 4 {
+				t.Fatalf("expected 4 frames, got %d (%v)", n, err)
+			}
+			d = NewDecoder(bytes.NewReader(out.Bytes()))
+			if err := d.FwdToPCM(); err != nil {
+				t.Fatal(err)
+			}
+			src, err := d.readPCM(d.PCMSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]float32, len(samples))
+			n, err := decodeFloat32s(got, src, tc.bitDepth, tc.audioFormat == 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got[:n], tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, got[:n])
+			}
+			// the peaks of the PCM formats are clipped
+			expectedPeak := float32(1)
+			if tc.audioFormat == 3 {
+				expectedPeak = 1.5
+			}
+			if p := e.Peak.Channels; len(p) != 2 || p[0].Value != expectedPeak || p[1].Value != expectedPeak {
+				t.Fatalf("unexpected peaks %+v", e.Peak.Channels)
+			}
+		})
+	}
+}
+
+// discardSeeker is an io.WriteSeeker discarding the written data.
+type discardSeeker struct{}
+
+func (discardSeeker) Write(p []byte) (int, error)                  { return len(p), nil }
+func (discardSeeker) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+
+// benchmarkEncoderWrite encodes stereo buffers of 4096 samples.
+func benchmarkEncoderWrite(b *testing.B, bitDepth int) {
+	e := NewEncoder(discardSeeker{}, 48000, bitDepth, 2, 1)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, SourceBitDepth: bitDepth, Data: make([]int, 4096)}
+	for i := range buf.Data {
+		buf.Data[i] = i % 100
+	}
+	// the first call writes the headers and allocates the internal buffer
+	if err := e.Write(buf); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(buf.Data) * bitDepth / 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := e.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoder_Write16(b *testing.B) { benchmarkEncoderWrite(b, 16) }
+func BenchmarkEncoder_Write24(b *testing.B) { benchmarkEncoderWrite(b, 24) }
+func BenchmarkEncoder_Write32(b *testing.B) { benchmarkEncoderWrite(b, 32) }
+
+// benchmarkEncoderWriteFloat32 encodes stereo float buffers of 4096 samples.
+func benchmarkEncoderWriteFloat32(b *testing.B, bitDepth, audioFormat int) {
+	e := NewEncoder(discardSeeker{}, 48000, bitDepth, 2, audioFormat)
+	buf := &audio.Float32Buffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: make([]float32, 4096)}
+	for i := range buf.Data {
+		buf.Data[i] = float32(i%100) / 100
+	}
+	if err := e.WriteFloat32(buf); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(buf.Data) * bitDepth / 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := e.WriteFloat32(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoder_WriteFloat32To16(b *testing.B) { benchmarkEncoderWriteFloat32(b, 16, 1) }
+func BenchmarkEncoder_WriteFloat32To24(b *testing.B) { benchmarkEncoderWriteFloat32(b, 24, 1) }
+func BenchmarkEncoder_WriteFloat32(b *testing.B)     { benchmarkEncoderWriteFloat32(b, 32, 3) }
+
+func TestEncoderWriteTypedFrames(t *testing.T) {
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 8000, 24, 2, 1)
+	e.Peak = &Peak{}
+	if err := e.WriteIntFrame([]int{1000, -1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFloatFrame([]float64{0.5, -2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteIntFrame([]int{1}); err == nil {
+		t.Fatal("expected a frame with missing channels to be refused")
+	}
+	if err := e.WriteFloatFrame([]float64{0, 0, 0}); err == nil {
+		t.Fatal("expected a frame with extra channels to be refused")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1000, -1000, 4194304, -8388608}; !reflect.DeepEqual(buf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data)
+	}
+	if n, err := NewDecoder(bytes.NewReader(out.Bytes())).NumFrames(); err != nil || n != 2 {
+		t.Fatalf("expected 2 frames, got %d (%v)", n, err)
+	}
+	if expected := []ChannelPeak{{Value: 0.5, Position: 1}, {Value: 1, Position: 1}}; !reflect.DeepEqual(e.Peak.Channels, expected) {
+		t.Fatalf("expected peaks %+v, got %+v", expected, e.Peak.Channels)
+	}
+
+	// samples written one by one with the deprecated WriteFrame
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 8000, 16, 2, 1)
+	for _, v := range []int16{1, -1, 2, -2, 3} {
+		if err := e.WriteFrame(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d = NewDecoder(bytes.NewReader(out.Bytes()))
+	if buf, err = d.FullPCMBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1, -1, 2, -2, 3}; !reflect.DeepEqual(buf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data)
+	}
+}
+
+func TestEncoderDither(t *testing.T) {
+	// encode returns the 16 bit samples written from the passed 24 bit
+	// samples.
+	encode := func(dither Dither, shaping bool, data []int) []int {
+		out := &seekableBuffer{}
+		e := NewEncoder(out, 8000, 16, 1, 1)
+		e.Dither = dither
+		e.NoiseShaping = shaping
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, SourceBitDepth: 24, Data: data}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := NewDecoder(bytes.NewReader(out.Bytes())).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decoded.Data
+	}
+
+	// rounding and clipping instead of wrapping around
+	got := encode(DitherNone, false, []int{8388607, -8388608, 100*256 + 128, 100*256 + 127, 9000000, -9000000})
+	if expected := []int{32767, -32768, 101, 100, 32767, -32768}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	// a constant value between two steps is reproduced on average
+	const n = 20000
+	input := make([]int, n)
+	for i := range input {
+		input[i] = 100*256 + 64
+	}
+	for _, tc := range []struct {
+		dither  Dither
+		shaping bool
+	}{
+		{DitherRectangular, false},
+		{DitherTPDF, false},
+		{DitherTPDF, true},
+	} {
+		got := encode(tc.dither, tc.shaping, input)
+		var sum, minV, maxV int
+		minV, maxV = got[0], got[0]
+		for _, v := range got {
+			sum += v
+			if v < minV {
+				minV = v
+			}
+			if v > maxV {
+				maxV = v
+			}
+		}
+		if mean := float64(sum) / n; math.Abs(mean-100.25) > 0.02 {
+			t.Errorf("%s dither, shaping %t: expected a mean of 100.25, got %f", tc.dither, tc.shaping, mean)
+		}
+		if minV < 98 || maxV > 103 || minV == maxV {
+			t.Errorf("%s dither, shaping %t: unexpected range [%d, %d]", tc.dither, tc.shaping, minV, maxV)
+		}
+		if tc.shaping {
+			// the errors are fed back so their running sum stays bounded
+			var errSum float64
+			for _, v := range got {
+				errSum += float64(v) - 100.25
+				if math.Abs(errSum) > 3 {
+					t.Fatalf("the quantization error isn't shaped, running sum %f", errSum)
+				}
+			}
+		}
+	}
+
+	// upscaling
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 8000, 24, 1, 1)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, SourceBitDepth: 8, Data: []int{0, 128, 255}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := NewDecoder(bytes.NewReader(out.Bytes())).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{-8388608, 0, 127 << 16}; !reflect.DeepEqual(decoded.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, decoded.Data)
+	}
+
+	// float samples
+	out = &seekableBuffer{}
+	e = NewEncoder(out, 8000, 16, 1, 1)
+	e.Dither = DitherTPDF
+	floats := make([]float32, n)
+	for i := range floats {
+		floats[i] = -100.25 / 32768
+	}
+	if err := e.WriteFloat32(&audio.Float32Buffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: floats}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = NewDecoder(bytes.NewReader(out.Bytes())).FullPCMBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	var sum int
+	for _, v := range decoded.Data {
+		sum += v
+	}
+	if mean := float64(sum) / n; math.Abs(mean+100.25) > 0.02 {
+		t.Fatalf("expected a mean of -100.25, got %f", mean)
+	}
+}
+
+func TestEncoderClipStats(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 8000}
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 8000, 16, 2, 1)
+	e.MaxOvers = 2
+	data := []int{40000, 0, 0, -40000, 100, 100, 32768, 0}
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFloat32(&audio.Float32Buffer{Format: format, Data: []float32{0.5, -1.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteIntFrame([]int{-32769, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != 40000 {
+		t.Fatal("the samples of the caller were modified")
+	}
+	stats := e.ClipStats()
+	expected := ClipStats{Channels: []int{3, 2}, Overs: []Over{{Frame: 0, Channel: 0}, {Frame: 1, Channel: 1}}}
+	if !reflect.DeepEqual(stats, expected) || stats.Clipped() != 5 {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+	buf, err := NewDecoder(bytes.NewReader(out.Bytes())).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{32767, 0, 0, -32768, 100, 100, 32767, 0, 16384, -32768, -32768, 1}; !reflect.DeepEqual(buf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, buf.Data)
+	}
+
+	// overs of IEEE float files are reported
+	e = NewEncoder(&seekableBuffer{}, 8000, 32, 2, 3)
+	if err := e.WriteFloatFrame([]float64{1, 1.25}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := e.ClipStats(); !reflect.DeepEqual(stats.Channels, []int{0, 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// failing fast
+	e = NewEncoder(&seekableBuffer{}, 8000, 24, 2, 1)
+	e.FailOnClip = true
+	e.Dither = DitherTPDF
+	if err := e.WriteFloatFrame([]float64{0.5, -0.5}); err != nil {
+		t.Fatal(err)
+	}
+	err = e.Write(&audio.IntBuffer{Format: format, SourceBitDepth: 16, Data: []int{0, 0, 0, 40000}})
+	if !errors.Is(err, ErrClipped) {
+		t.Fatalf("expected %v, got %v", ErrClipped, err)
+	}
+	if stats := e.ClipStats(); !reflect.DeepEqual(stats.Channels, []int{0, 1}) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEncoderResample(t *testing.T) {
+	// a second of a 1 kHz sine at 44.1 kHz written by blocks of various sizes
+	in := make([]int, 2*44100)
+	for i := 0; i < 44100; i++ {
+		v := int(0.5 * math.Sin(2*math.Pi*1000*float64(i)/44100) * 32768)
+		in[2*i], in[2*i+1] = v, -v
+	}
+	out := &seekableBuffer{}
+	e := NewEncoder(out, 48000, 24, 2, 1)
+	e.Resample = true
+	for start, size := 0, 2; start < len(in); size *= 3 {
+		end := start + size
+		if end > len(in) {
+			end = len(in)
+		}
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, SourceBitDepth: 16, Data: in[start:end]}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		start = end
+	}
+	err := e.WriteFloat32(&audio.Float32Buffer{Format: &audio.Format{NumChannels: 2, SampleRate: 22050}, Data: make([]float32, 2)})
+	if err == nil {
+		t.Fatal("expected buffers of another rate to be refused")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(out.Bytes()))
+	if n, err := d.NumFrames(); err != nil || n != 48000 {
+		t.Fatalf("expected 48000 frames, got %d (%v)", n, err)
+	}
+	d = NewDecoder(bytes.NewReader(out.Bytes()))
+	buf := &audio.Float32Buffer{Data: make([]float32, 2*48000)}
+	if _, err := d.PCMFloat32Buffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	var maxErr float64
+	for i := 4800; i < 43200; i++ {
+		expected := 0.5 * math.Sin(2*math.Pi*1000*float64(i)/48000)
+		maxErr = math.Max(maxErr, math.Abs(float64(buf.Data[2*i])-expected))
+		maxErr = math.Max(maxErr, math.Abs(float64(buf.Data[2*i+1])+expected))
+	}
+	if maxErr > 1e-3 {
+		t.Fatalf("expected a maximum error of 1e-3, got %g", maxErr)
+	}
+}
@@ -95,7 +95,12 @@ func ExampleDecoder_ReadMetadata() {
 	if d.Err() != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("%#v\n", d.Metadata)
+	m := d.Metadata
+	fmt.Printf("Artist: %q, Title: %q, Product: %q, TrackNbr: %q\n", m.Artist, m.Title, m.Product, m.TrackNbr)
+	fmt.Printf("CreationDate: %q, Genre: %q, Comments: %q\n", m.CreationDate, m.Genre, m.Comments)
+	fmt.Printf("ID3v2.%d frames: %d\n", m.ID3.Version, len(m.ID3.Text)+len(m.ID3.Comments))
 	// Output:
-	// &wav.Metadata{SamplerInfo:(*wav.SamplerInfo)(nil), Artist:"artist", Comments:"my comment", Copyright:"", CreationDate:"2017", Engineer:"", Technician:"", Genre:"genre", Keywords:"", Medium:"", Title:"track title", Product:"album title", Subject:"", Software:"", Source:"", Location:"", TrackNbr:"42", CuePoints:[]*wav.CuePoint(nil)}
+	// Artist: "artist", Title: "track title", Product: "album title", TrackNbr: "42"
+	// CreationDate: "2017", Genre: "genre", Comments: "my comment"
+	// ID3v2.3 frames: 7
 }
@@ -0,0 +1,127 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// wavFormatPCM is the WavAudioFormat of uncompressed integer PCM data, all
+// the other formats must have a fact chunk.
+const wavFormatPCM = 1
+
+// wavFormatIEEEFloat is the WavAudioFormat of IEEE float samples.
+const wavFormatIEEEFloat = 3
+
+// DecodeFactChunk decodes a fact chunk and stores the number of frames it
+// contains. See Decoder.NumFrames.
+func DecodeFactChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDFact {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the fact chunk - %w", err)
+		}
+		if len(buf) < 4 {
+			return fmt.Errorf("fact chunk too short: %d bytes", len(buf))
+		}
+		d.factSampleLength = binary.LittleEndian.Uint32(buf)
+		d.hasFact = true
+	}
+	ch.Drain()
+	return nil
+}
+
+// NumFrames returns the number of frames (samples per channel) of the file.
+// For non PCM formats (compressed or floating point data), the sample length
+// found in the fact chunk is used. Otherwise the number of frames is computed
+// from the size of the PCM data.
+// The decoder is forwarded to the PCM data if it wasn't accessed yet.
+func (d *Decoder) NumFrames() (int, error) {
+	if d == nil {
+		return 0, errors.New("nil decoder")
+	}
+	if !d.WasPCMAccessed() {
+		if err := d.FwdToPCM(); err != nil {
+			return 0, err
+		}
+		if err := d.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if d.WavAudioFormat != wavFormatPCM && d.hasFact {
+		return int(d.factSampleLength), nil
+	}
+	blockAlign := d.blockAlign()
+	if blockAlign == 0 {
+		return 0, fmt.Errorf("can't compute the number of frames of %d channels of %d bits", d.NumChans, d.BitDepth)
+	}
+	return d.PCMSize / blockAlign, nil
+}
+
+// factDuration returns the duration based on the fact chunk, ok is false if
+// the file doesn't need or have one.
+func (d *Decoder) factDuration() (dur time.Duration, ok bool) {
+	if d.WavAudioFormat == wavFormatPCM || d.SampleRate == 0 {
+		return 0, false
+	}
+	if !d.hasFact && !d.WasPCMAccessed() {
+		if err := d.findFact(); err != nil {
+			return 0, false
+		}
+	}
+	if !d.hasFact {
+		return 0, false
+	}
+	return time.Duration(float64(d.factSampleLength) / float64(d.SampleRate) * float64(time.Second)), true
+}
+
+// findFact reads the fact chunk preceding the PCM data. The position of the
+// reader is restored, except for streams which are forwarded to the PCM data.
+func (d *Decoder) findFact() error {
+	if d.stream() != nil {
+		return d.FwdToPCM()
+	}
+	pos, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	defer d.r.Seek(pos, io.SeekStart)
+	// skip the RIFF and WAVE IDs and the RIFF size
+	if _, err := d.r.Seek(12, io.SeekStart); err != nil {
+		return err
+	}
+	for {
+		var (
+			id   [4]byte
+			size uint32
+		)
+		if err := binary.Read(d.r, binary.BigEndian, &id); err != nil {
+			return err
+		}
+		if err := binary.Read(d.r, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+		if id == riff.DataFormatID {
+			// the fact chunk precedes the PCM data
+			return nil
+		}
+		if id == CIDFact {
+			return DecodeFactChunk(d, &riff.Chunk{ID: id, Size: int(size), R: io.LimitReader(d.r, int64(size))})
+		}
+		if _, err := d.r.Seek(int64(size)+int64(size%2), io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
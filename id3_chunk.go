@@ -0,0 +1,525 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-audio/riff"
+)
+
+// ID3v2 is documented here:
+// https://id3.org/id3v2.3.0 and https://id3.org/id3v2.4.0-structure
+
+// ID3 text encodings
+const (
+	id3EncodingISO88591 = 0
+	id3EncodingUTF16    = 1
+	id3EncodingUTF16BE  = 2
+	id3EncodingUTF8     = 3
+)
+
+// id3MetadataFields maps the ID3 text frames to the Metadata string fields
+// they correspond to.
+var id3MetadataFields = []struct {
+	id    string
+	field func(m *Metadata) *string
+}{
+	{"TIT2", func(m *Metadata) *string { return &m.Title }},
+	{"TPE1", func(m *Metadata) *string { return &m.Artist }},
+	{"TALB", func(m *Metadata) *string { return &m.Product }},
+	{"TCON", func(m *Metadata) *string { return &m.Genre }},
+	{"TRCK", func(m *Metadata) *string { return &m.TrackNbr }},
+	{"TCOP", func(m *Metadata) *string { return &m.Copyright }},
+	{"TSSE", func(m *Metadata) *string { return &m.Software }},
+	{"TENC", func(m *Metadata) *string { return &m.Technician }},
+	{"TIT3", func(m *Metadata) *string { return &m.Subject }},
+	{"TMED", func(m *Metadata) *string { return &m.Medium }},
+}
+
+// ID3Tag represents an ID3v2 tag embedded in the wav file using an "id3 " (or
+// "ID3 ") chunk, as written by iTunes, Mp3tag, Serato and many others.
+//
+// When decoding, the frames that have an INFO equivalent are also copied to
+// the matching Metadata fields if those are empty: TIT2 (Title), TPE1
+// (Artist), TALB (Product), TCON (Genre), TRCK (TrackNbr), TCOP (Copyright),
+// TSSE (Software), TENC (Technician), TIT3 (Subject), TMED (Medium),
+// TDRC/TYER (CreationDate) and the first COMM frame (Comments).
+// When encoding, non empty Metadata fields take precedence over the
+// corresponding frames.
+type ID3Tag struct {
+	// Version is the major version of the tag, 3 for ID3v2.3 and 4 for ID3v2.4.
+	// Tags are written using ID3v2.4 if the version isn't set.
+	Version uint8
+	// Text contains the text information frames (T000 - TZZZ, TXXX excluded)
+	// keyed by frame ID. Multiple values are separated by a semicolon and a
+	// blank, they are stored using null separators in ID3v2.4 tags and using
+	// slashes in the ID3v2.3 frames listing people (TCOM, TEXT, TOLY, TOPE
+	// and TPE1).
+	Text map[string]string
+	// UserText contains the user defined text frames (TXXX).
+	UserText []*ID3UserText
+	// Comments contains the comment frames (COMM).
+	Comments []*ID3Comment
+	// Pictures contains the attached pictures (APIC), such as cover art.
+	Pictures []*ID3Picture
+	// Frames contains the frames this package doesn't interpret. They are
+	// written back verbatim.
+	Frames []*ID3Frame
+}
+
+// ID3UserText is a user defined text information frame (TXXX).
+type ID3UserText struct {
+	Description string
+	// Value contains the text, multiple values being separated by a
+	// semicolon and a blank.
+	Value string
+}
+
+// ID3Comment is a comment frame (COMM).
+type ID3Comment struct {
+	// Language is a 3 letter ISO-639-2 language code such as "eng".
+	Language    string
+	Description string
+	Text        string
+}
+
+// ID3Picture is an attached picture frame (APIC).
+type ID3Picture struct {
+	// MIMEType of the image, for instance image/jpeg or image/png.
+	MIMEType string
+	// PictureType describes what the picture represents, 3 is the front cover.
+	PictureType byte
+	Description string
+	Data        []byte
+}
+
+// ID3Frame is an ID3v2 frame kept in its raw form.
+type ID3Frame struct {
+	ID    string
+	Flags uint16
+	Data  []byte
+}
+
+// DecodeID3Chunk decodes an id3 chunk and puts the data in Decoder.Metadata.ID3
+func DecodeID3Chunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDID3 || ch.ID == CIDID3Upper {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the id3 chunk - %w", err)
+		}
+		tag, err := decodeID3Tag(buf)
+		if err != nil {
+			return err
+		}
+		if tag == nil {
+			// unsupported version
+			return nil
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.ID3 = tag
+		tag.copyTo(d.Metadata)
+	}
+	ch.Drain()
+	return nil
+}
+
+// copyTo sets the empty Metadata fields using the matching frames.
+func (t *ID3Tag) copyTo(m *Metadata) {
+	for _, f := range id3MetadataFields {
+		if v := t.Text[f.id]; v != "" && *f.field(m) == "" {
+			*f.field(m) = v
+		}
+	}
+	if m.CreationDate == "" {
+		if v := t.Text["TDRC"]; v != "" {
+			m.CreationDate = v
+		} else {
+			m.CreationDate = t.Text["TYER"]
+		}
+	}
+	if m.Comments == "" && len(t.Comments) > 0 {
+		m.Comments = t.Comments[0].Text
+	}
+}
+
+// decodeID3Tag parses an ID3v2.3 or ID3v2.4 tag. A nil tag is returned for
+// other versions.
+func decodeID3Tag(b []byte) (*ID3Tag, error) {
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return nil, errors.New("invalid ID3 tag header")
+	}
+	version := b[3]
+	if version != 3 && version != 4 {
+		return nil, nil
+	}
+	flags := b[5]
+	size := int(syncsafeUint32(b[6:10]))
+	b = b[10:]
+	if size < len(b) {
+		b = b[:size]
+	}
+	if version == 3 && flags&0x80 != 0 {
+		b = id3Deunsync(b)
+	}
+	// skip the extended header
+	if flags&0x40 != 0 {
+		if len(b) < 4 {
+			return nil, errors.New("invalid ID3 extended header")
+		}
+		extSize := int(binary.BigEndian.Uint32(b[:4])) + 4
+		if version == 4 {
+			extSize = int(syncsafeUint32(b[:4]))
+		}
+		if extSize > len(b) {
+			return nil, errors.New("invalid ID3 extended header size")
+		}
+		b = b[extSize:]
+	}
+
+	tag := &ID3Tag{Version: version, Text: map[string]string{}}
+	for len(b) >= 10 {
+		// we reached the padding
+		if b[0] == 0 {
+			break
+		}
+		id := string(b[:4])
+		frameSize := int(binary.BigEndian.Uint32(b[4:8]))
+		if version == 4 {
+			frameSize = int(syncsafeUint32(b[4:8]))
+		}
+		frameFlags := binary.BigEndian.Uint16(b[8:10])
+		if frameSize > len(b)-10 {
+			return nil, fmt.Errorf("ID3 frame %s is too large: %d", id, frameSize)
+		}
+		data := b[10 : 10+frameSize]
+		b = b[10+frameSize:]
+
+		if version == 4 {
+			// data length indicator
+			if frameFlags&0x0001 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+			if frameFlags&0x0002 != 0 || flags&0x80 != 0 {
+				data = id3Deunsync(data)
+			}
+			frameFlags &^= 0x0003
+		}
+		// compressed or encrypted frames are preserved as is
+		compressed := (version == 3 && frameFlags&0x00C0 != 0) || (version == 4 && frameFlags&0x000C != 0)
+		if compressed || len(data) == 0 {
+			tag.Frames = append(tag.Frames, &ID3Frame{ID: id, Flags: frameFlags, Data: data})
+			continue
+		}
+
+		switch {
+		case id == "TXXX":
+			desc, rest := id3SplitString(data[0], data[1:])
+			tag.UserText = append(tag.UserText, &ID3UserText{
+				Description: id3DecodeString(data[0], desc),
+				Value:       id3DecodeText(data[0], rest),
+			})
+		case id[0] == 'T':
+			v := id3DecodeText(data[0], data[1:])
+			if version == 3 && id3SlashFrames[id] {
+				v = strings.Replace(v, "/", id3ValueSeparator, -1)
+			}
+			tag.Text[id] = v
+		case id == "COMM" && len(data) >= 4:
+			desc, rest := id3SplitString(data[0], data[4:])
+			tag.Comments = append(tag.Comments, &ID3Comment{
+				Language:    string(bytes.TrimRight(data[1:4], "\x00")),
+				Description: id3DecodeString(data[0], desc),
+				Text:        id3DecodeText(data[0], rest),
+			})
+		case id == "APIC":
+			mime, rest := id3SplitString(id3EncodingISO88591, data[1:])
+			if len(rest) < 1 {
+				return nil, errors.New("invalid ID3 APIC frame")
+			}
+			pic := &ID3Picture{
+				MIMEType:    id3DecodeString(id3EncodingISO88591, mime),
+				PictureType: rest[0],
+			}
+			desc, img := id3SplitString(data[0], rest[1:])
+			pic.Description = id3DecodeString(data[0], desc)
+			pic.Data = append([]byte(nil), img...)
+			tag.Pictures = append(tag.Pictures, pic)
+		default:
+			tag.Frames = append(tag.Frames, &ID3Frame{ID: id, Flags: frameFlags, Data: data})
+		}
+	}
+
+	return tag, nil
+}
+
+// encodeID3Chunk returns the content of the id3 chunk, nil if no tag should
+// be written.
+func encodeID3Chunk(e *Encoder) []byte {
+	if e == nil || e.Metadata == nil || e.Metadata.ID3 == nil {
+		return nil
+	}
+	t := e.Metadata.ID3
+	version := t.Version
+	if version != 3 {
+		version = 4
+	}
+
+	text := map[string]string{}
+	for id, v := range t.Text {
+		text[id] = v
+	}
+	for _, f := range id3MetadataFields {
+		if v := *f.field(e.Metadata); v != "" {
+			text[f.id] = v
+		}
+	}
+	if e.Metadata.CreationDate != "" {
+		if version == 4 {
+			text["TDRC"] = e.Metadata.CreationDate
+			delete(text, "TYER")
+		} else {
+			text["TYER"] = e.Metadata.CreationDate
+			delete(text, "TDRC")
+		}
+	}
+	comments := t.Comments
+	if e.Metadata.Comments != "" {
+		if len(comments) == 0 {
+			comments = []*ID3Comment{{Language: "eng", Text: e.Metadata.Comments}}
+		} else {
+			first := *comments[0]
+			first.Text = e.Metadata.Comments
+			comments = append([]*ID3Comment{&first}, comments[1:]...)
+		}
+	}
+
+	frames := bytes.NewBuffer(nil)
+	writeFrame := func(id string, flags uint16, data []byte) {
+		frames.WriteString(id)
+		if version == 4 {
+			frames.Write(syncsafeBytes(uint32(len(data))))
+		} else {
+			binary.Write(frames, binary.BigEndian, uint32(len(data)))
+		}
+		binary.Write(frames, binary.BigEndian, flags)
+		frames.Write(data)
+	}
+
+	ids := make([]string, 0, len(text))
+	for id := range text {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if len(id) != 4 || text[id] == "" {
+			continue
+		}
+		enc := id3TextEncoding(version, text[id])
+		values := strings.Split(text[id], id3ValueSeparator)
+		if version == 3 && id3SlashFrames[id] {
+			values = []string{strings.Join(values, "/")}
+		}
+		writeFrame(id, 0, append([]byte{enc}, id3EncodeText(enc, values)...))
+	}
+	for _, ut := range t.UserText {
+		enc := id3TextEncoding(version, ut.Description+ut.Value)
+		data := append([]byte{enc}, id3EncodeString(enc, ut.Description, true)...)
+		writeFrame("TXXX", 0, append(data, id3EncodeText(enc, strings.Split(ut.Value, id3ValueSeparator))...))
+	}
+	for _, c := range comments {
+		enc := id3TextEncoding(version, c.Description+c.Text)
+		lang := []byte((c.Language + "\x00\x00\x00")[:3])
+		if c.Language == "" {
+			lang = []byte("XXX")
+		}
+		data := append([]byte{enc}, lang...)
+		data = append(data, id3EncodeString(enc, c.Description, true)...)
+		writeFrame("COMM", 0, append(data, id3EncodeString(enc, c.Text, false)...))
+	}
+	for _, p := range t.Pictures {
+		enc := id3TextEncoding(version, p.Description)
+		data := append([]byte{enc}, id3EncodeString(id3EncodingISO88591, p.MIMEType, true)...)
+		data = append(data, p.PictureType)
+		data = append(data, id3EncodeString(enc, p.Description, true)...)
+		writeFrame("APIC", 0, append(data, p.Data...))
+	}
+	for _, f := range t.Frames {
+		if len(f.ID) != 4 {
+			continue
+		}
+		writeFrame(f.ID, f.Flags, f.Data)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("ID3")
+	buf.Write([]byte{version, 0, 0})
+	buf.Write(syncsafeBytes(uint32(frames.Len())))
+	buf.Write(frames.Bytes())
+	return buf.Bytes()
+}
+
+// id3TextEncoding returns the encoding to use to write the passed string.
+func id3TextEncoding(version uint8, s string) byte {
+	if version == 4 {
+		return id3EncodingUTF8
+	}
+	for _, r := range s {
+		if r > 0xFF {
+			return id3EncodingUTF16
+		}
+	}
+	return id3EncodingISO88591
+}
+
+// id3EncodeString encodes the passed string, optionally adding the encoding
+// specific terminator.
+func id3EncodeString(enc byte, s string, terminated bool) []byte {
+	var b []byte
+	switch enc {
+	case id3EncodingUTF16:
+		b = []byte{0xFF, 0xFE}
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	case id3EncodingUTF8:
+		b = []byte(s)
+	default:
+		for _, r := range s {
+			if r > 0xFF {
+				r = '?'
+			}
+			b = append(b, byte(r))
+		}
+	}
+	if terminated {
+		b = append(b, 0)
+		if enc == id3EncodingUTF16 || enc == id3EncodingUTF16BE {
+			b = append(b, 0)
+		}
+	}
+	return b
+}
+
+// id3EncodeText encodes the values of a text frame, separated by the
+// encoding specific terminator.
+func id3EncodeText(enc byte, values []string) []byte {
+	var b []byte
+	for i, v := range values {
+		b = append(b, id3EncodeString(enc, v, i < len(values)-1)...)
+	}
+	return b
+}
+
+// id3SplitString splits the passed data after the first terminated string.
+func id3SplitString(enc byte, b []byte) (str []byte, rest []byte) {
+	if enc == id3EncodingUTF16 || enc == id3EncodingUTF16BE {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// id3ValueSeparator separates the multiple values of the decoded text
+// frames.
+const id3ValueSeparator = "; "
+
+// id3SlashFrames are the ID3v2.3 text frames whose values are separated by a
+// slash.
+var id3SlashFrames = map[string]bool{"TCOM": true, "TEXT": true, "TOLY": true, "TOPE": true, "TPE1": true}
+
+// id3DecodeText decodes the content of a text frame, multiple values being
+// joined by a semicolon and a blank.
+func id3DecodeText(enc byte, b []byte) string {
+	var values []string
+	for len(b) > 0 {
+		var s []byte
+		s, b = id3SplitString(enc, b)
+		values = append(values, id3DecodeString(enc, s))
+	}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return strings.Join(values, id3ValueSeparator)
+}
+
+// id3DecodeString converts an encoded (non terminated) string into a Go
+// string.
+func id3DecodeString(enc byte, b []byte) string {
+	switch enc {
+	case id3EncodingUTF16, id3EncodingUTF16BE:
+		bigEndian := enc == id3EncodingUTF16BE
+		if len(b) >= 2 {
+			if b[0] == 0xFF && b[1] == 0xFE {
+				bigEndian = false
+				b = b[2:]
+			} else if b[0] == 0xFE && b[1] == 0xFF {
+				bigEndian = true
+				b = b[2:]
+			}
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if bigEndian {
+				u[i] = binary.BigEndian.Uint16(b[i*2:])
+			} else {
+				u[i] = binary.LittleEndian.Uint16(b[i*2:])
+			}
+		}
+		return string(utf16.Decode(u))
+	case id3EncodingUTF8:
+		if utf8.Valid(b) {
+			return string(b)
+		}
+		fallthrough
+	default:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+}
+
+// id3Deunsync reverses the unsynchronisation scheme (0xFF 0x00 -> 0xFF).
+func id3Deunsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+func syncsafeUint32(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+func syncsafeBytes(n uint32) []byte {
+	return []byte{byte(n>>21) & 0x7F, byte(n>>14) & 0x7F, byte(n>>7) & 0x7F, byte(n) & 0x7F}
+}
@@ -0,0 +1,143 @@
+package wav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-audio/riff"
+)
+
+// iXML is documented here:
+// http://www.gallery.co.uk/ixml/
+
+// IXML represents the iXML document stored in the iXML chunk by field
+// recorders.
+type IXML struct {
+	// Raw is the iXML document as found in the file.
+	Raw []byte
+	// Project, Scene, Take and Tape identify the recording.
+	Project string
+	Scene   string
+	Take    string
+	Tape    string
+	// TimecodeRate is the SPEED/TIMECODE_RATE value, a fraction such as
+	// 30000/1001.
+	TimecodeRate string
+	// TimecodeFlag is the SPEED/TIMECODE_FLAG value, DF for drop frame
+	// timecodes and NDF otherwise.
+	TimecodeFlag string
+	// TimestampSamplesSinceMidnight is the position of the first sample of
+	// the file, counted at TimestampSampleRate.
+	TimestampSamplesSinceMidnight uint64
+	// TimestampSampleRate is the sample rate used by the timestamp, it can
+	// differ from the sample rate of the file.
+	TimestampSampleRate uint32
+
+	// hasTimestamp is true when the document defines a timestamp.
+	hasTimestamp bool
+}
+
+// Rate returns the timecode rate defined by TimecodeRate and TimecodeFlag,
+// TimecodeRateUnknown if it isn't supported.
+func (x *IXML) Rate() TimecodeRate {
+	df := strings.EqualFold(strings.TrimSpace(x.TimecodeFlag), "DF")
+	switch strings.ReplaceAll(x.TimecodeRate, " ", "") {
+	case "24000/1001":
+		if !df {
+			return TimecodeRate23976
+		}
+	case "24/1", "24":
+		return TimecodeRate24
+	case "25/1", "25":
+		return TimecodeRate25
+	case "30000/1001":
+		if df {
+			return TimecodeRate2997DF
+		}
+	case "30/1", "30":
+		if !df {
+			return TimecodeRate30
+		}
+	}
+	return TimecodeRateUnknown
+}
+
+// DecodeIXMLChunk decodes an iXML chunk and puts the data in
+// Decoder.Metadata.IXML
+func DecodeIXMLChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDIXML {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		if _, err := io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the iXML chunk - %w", err)
+		}
+		x, err := ParseIXML(bytes.TrimRight(buf, "\x00"))
+		if err != nil {
+			return err
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.IXML = x
+	}
+	ch.Drain()
+	return nil
+}
+
+// ParseIXML parses the passed iXML document.
+func ParseIXML(doc []byte) (*IXML, error) {
+	root, err := parseXMLTree(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the iXML document - %w", err)
+	}
+	// the fields are looked up by name, as their position in the tree
+	// changed between the versions of the specification
+	first := func(name string) (string, bool) {
+		if found := root.findAll("", name); len(found) > 0 {
+			return strings.TrimSpace(found[0].text), true
+		}
+		return "", false
+	}
+	x := &IXML{Raw: doc}
+	x.Project, _ = first("PROJECT")
+	x.Scene, _ = first("SCENE")
+	x.Take, _ = first("TAKE")
+	x.Tape, _ = first("TAPE")
+	x.TimecodeRate, _ = first("TIMECODE_RATE")
+	x.TimecodeFlag, _ = first("TIMECODE_FLAG")
+
+	hi, hasHi := first("TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI")
+	lo, hasLo := first("TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO")
+	if hasHi || hasLo {
+		var h, l uint64
+		if hi != "" {
+			if h, err = strconv.ParseUint(hi, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid iXML TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI - %w", err)
+			}
+		}
+		if lo != "" {
+			if l, err = strconv.ParseUint(lo, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid iXML TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO - %w", err)
+			}
+		}
+		x.TimestampSamplesSinceMidnight = h<<32 | l
+		x.hasTimestamp = true
+	}
+	if v, ok := first("TIMESTAMP_SAMPLE_RATE"); ok && v != "" {
+		rate, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid iXML TIMESTAMP_SAMPLE_RATE - %w", err)
+		}
+		x.TimestampSampleRate = uint32(rate)
+	}
+	return x, nil
+}
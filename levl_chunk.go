@@ -0,0 +1,278 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// levl chunk is documented here:
+// https://tech.ebu.ch/docs/tech/tech3285s3.pdf
+
+const (
+	// PeakEnvelopeFormat8 stores the peak values as unsigned 8 bit values.
+	PeakEnvelopeFormat8 = 1
+	// PeakEnvelopeFormat16 stores the peak values as unsigned 16 bit values.
+	PeakEnvelopeFormat16 = 2
+
+	// levlHeaderSize is the size of the levl chunk content preceding the
+	// peak values.
+	levlHeaderSize = 120
+	// levlTimestampFormat is the layout of the levl timestamp, the
+	// milliseconds being appended.
+	levlTimestampFormat = "2006:01:02:15:04:05"
+	// noPeakOfPeaks is the value of PosPeakOfPeaks when it is unknown.
+	noPeakOfPeaks = 0xFFFFFFFF
+)
+
+// PeakEnvelope is the content of the levl chunk defined by the EBU (Tech 3285
+// Supplement 3). It contains a reduced version of the audio signal so
+// overviews can be drawn without scanning the PCM data.
+//
+// To have the encoder generate a levl chunk, set Encoder.PeakEnvelope before
+// writing any data. Format, PointsPerValue and BlockSize are used as settings
+// (they default to PeakEnvelopeFormat16, 2 and 256), the other fields are
+// computed as frames are written.
+type PeakEnvelope struct {
+	// Version of the peak envelope chunk, currently 1.
+	Version uint32
+	// Format of the peak values, PeakEnvelopeFormat8 or PeakEnvelopeFormat16.
+	Format uint32
+	// PointsPerValue is 1 when only the absolute peak value is stored and 2
+	// when the positive and negative peak values are stored.
+	PointsPerValue uint32
+	// BlockSize is the number of audio frames used to compute each peak value.
+	BlockSize uint32
+	// NumChannels is the number of channels of the envelope.
+	NumChannels uint32
+	// NumPeakFrames is the number of peak frames, each peak frame containing
+	// PointsPerValue values per channel.
+	NumPeakFrames uint32
+	// PosPeakOfPeaks is the audio frame containing the highest sample of the
+	// file, 0xFFFFFFFF if unknown.
+	PosPeakOfPeaks uint32
+	// Timestamp is the creation date of the envelope using the
+	// YYYY:MM:DD:hh:mm:ss:uuu format.
+	Timestamp string
+	// Peaks contains the unsigned peak values, interleaved by channel. When
+	// PointsPerValue is 2, the positive peak of a channel precedes the
+	// absolute value of its negative peak.
+	Peaks []uint16
+}
+
+// Peak returns the peak values of the passed peak frame and channel,
+// normalized between 0 and 1. When the envelope only has one point per value,
+// pos and neg are equal.
+func (p *PeakEnvelope) Peak(peakFrame, channel int) (pos, neg float64) {
+	if p == nil || p.NumChannels == 0 || channel < 0 || channel >= int(p.NumChannels) {
+		return 0, 0
+	}
+	ppv := 1
+	if p.PointsPerValue == 2 {
+		ppv = 2
+	}
+	i := (peakFrame*int(p.NumChannels) + channel) * ppv
+	if peakFrame < 0 || i+ppv > len(p.Peaks) {
+		return 0, 0
+	}
+	max := float64(math.MaxUint16)
+	if p.Format == PeakEnvelopeFormat8 {
+		max = math.MaxUint8
+	}
+	pos = float64(p.Peaks[i]) / max
+	neg = pos
+	if ppv == 2 {
+		neg = float64(p.Peaks[i+1]) / max
+	}
+	return pos, neg
+}
+
+// DecodeLevlChunk decodes a levl chunk and puts the data in
+// Decoder.Metadata.PeakEnvelope.
+func DecodeLevlChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDLevl {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the levl chunk - %w", err)
+		}
+		if len(buf) < levlHeaderSize {
+			return fmt.Errorf("levl chunk too short: %d bytes", len(buf))
+		}
+		p := &PeakEnvelope{}
+		r := bytes.NewReader(buf)
+		var offsetToPeaks uint32
+		for _, v := range []*uint32{&p.Version, &p.Format, &p.PointsPerValue, &p.BlockSize,
+			&p.NumChannels, &p.NumPeakFrames, &p.PosPeakOfPeaks, &offsetToPeaks} {
+			if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+				return fmt.Errorf("failed to read the levl header - %w", err)
+			}
+		}
+		p.Timestamp = string(buf[32 : 32+clen(buf[32:60])])
+
+		// the offset includes the chunk header
+		start := int(offsetToPeaks) - 8
+		if start < levlHeaderSize || start > len(buf) {
+			start = levlHeaderSize
+		}
+		data := buf[start:]
+		numValues := int(p.NumPeakFrames) * int(p.NumChannels) * int(p.PointsPerValue)
+		switch p.Format {
+		case PeakEnvelopeFormat8:
+			if numValues > len(data) {
+				numValues = len(data)
+			}
+			p.Peaks = make([]uint16, numValues)
+			for i := range p.Peaks {
+				p.Peaks[i] = uint16(data[i])
+			}
+		case PeakEnvelopeFormat16:
+			if numValues > len(data)/2 {
+				numValues = len(data) / 2
+			}
+			p.Peaks = make([]uint16, numValues)
+			for i := range p.Peaks {
+				p.Peaks[i] = binary.LittleEndian.Uint16(data[i*2:])
+			}
+		default:
+			return fmt.Errorf("unsupported levl format %d", p.Format)
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.PeakEnvelope = p
+	}
+	ch.Drain()
+	return nil
+}
+
+// encodeLevlChunk returns the content of the levl chunk.
+func encodeLevlChunk(p *PeakEnvelope) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, levlHeaderSize+len(p.Peaks)*2))
+	for _, v := range []uint32{p.Version, p.Format, p.PointsPerValue, p.BlockSize,
+		p.NumChannels, p.NumPeakFrames, p.PosPeakOfPeaks, levlHeaderSize + 8} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	var timestamp [28]byte
+	copy(timestamp[:], p.Timestamp)
+	buf.Write(timestamp[:])
+	// reserved
+	buf.Write(make([]byte, 60))
+	for _, v := range p.Peaks {
+		if p.Format == PeakEnvelopeFormat8 {
+			buf.WriteByte(byte(v))
+		} else {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// peakEnvelopeWriter computes a peak envelope from the interleaved samples
+// passed to add.
+type peakEnvelopeWriter struct {
+	env         *PeakEnvelope
+	ch          int
+	frame       int
+	blockFrames int
+	pos, neg    []float64
+	peakOfPeaks float64
+}
+
+// newPeakEnvelopeWriter returns a writer computing the peak envelope of
+// numChans channels into the passed envelope.
+func newPeakEnvelopeWriter(env *PeakEnvelope, numChans int) (*peakEnvelopeWriter, error) {
+	if numChans < 1 {
+		return nil, fmt.Errorf("can't compute the peak envelope of %d channels", numChans)
+	}
+	if env.Version == 0 {
+		env.Version = 1
+	}
+	if env.Format != PeakEnvelopeFormat8 {
+		env.Format = PeakEnvelopeFormat16
+	}
+	if env.PointsPerValue != 1 {
+		env.PointsPerValue = 2
+	}
+	if env.BlockSize == 0 {
+		env.BlockSize = 256
+	}
+	env.NumChannels = uint32(numChans)
+	env.NumPeakFrames = 0
+	env.PosPeakOfPeaks = noPeakOfPeaks
+	env.Peaks = nil
+	return &peakEnvelopeWriter{
+		env: env,
+		pos: make([]float64, numChans),
+		neg: make([]float64, numChans),
+	}, nil
+}
+
+// add adds a sample normalized between -1 and 1.
+func (w *peakEnvelopeWriter) add(v float64) {
+	if v >= 0 {
+		if v > w.pos[w.ch] {
+			w.pos[w.ch] = v
+		}
+	} else if -v > w.neg[w.ch] {
+		w.neg[w.ch] = -v
+	}
+	if math.Abs(v) > w.peakOfPeaks {
+		w.peakOfPeaks = math.Abs(v)
+		w.env.PosPeakOfPeaks = uint32(w.frame)
+	}
+	w.ch++
+	if w.ch < len(w.pos) {
+		return
+	}
+	w.ch = 0
+	w.frame++
+	w.blockFrames++
+	if w.blockFrames == int(w.env.BlockSize) {
+		w.flush()
+	}
+}
+
+// flush adds a peak frame using the data of the current block.
+func (w *peakEnvelopeWriter) flush() {
+	if w.blockFrames == 0 {
+		return
+	}
+	max := float64(math.MaxUint16)
+	if w.env.Format == PeakEnvelopeFormat8 {
+		max = math.MaxUint8
+	}
+	quantize := func(v float64) uint16 {
+		return uint16(math.Round(math.Min(v, 1) * max))
+	}
+	for i := range w.pos {
+		if w.env.PointsPerValue == 2 {
+			w.env.Peaks = append(w.env.Peaks, quantize(w.pos[i]), quantize(w.neg[i]))
+		} else {
+			w.env.Peaks = append(w.env.Peaks, quantize(math.Max(w.pos[i], w.neg[i])))
+		}
+		w.pos[i], w.neg[i] = 0, 0
+	}
+	w.env.NumPeakFrames++
+	w.blockFrames = 0
+}
+
+// close flushes the pending block and timestamps the envelope.
+func (w *peakEnvelopeWriter) close(now time.Time) {
+	w.flush()
+	if w.env.Timestamp == "" {
+		w.env.Timestamp = fmt.Sprintf("%s:%03d", now.Format(levlTimestampFormat), now.Nanosecond()/int(time.Millisecond))
+	}
+}
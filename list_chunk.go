@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/go-audio/riff"
 )
@@ -29,8 +30,92 @@ var (
 	markerITCH    = [4]byte{'I', 'T', 'C', 'H'}
 	markerIKEY    = [4]byte{'I', 'K', 'E', 'Y'}
 	markerIMED    = [4]byte{'I', 'M', 'E', 'D'}
+	markerICMS    = [4]byte{'I', 'C', 'M', 'S'}
+	markerICRP    = [4]byte{'I', 'C', 'R', 'P'}
+	markerIDIM    = [4]byte{'I', 'D', 'I', 'M'}
+	markerIDPI    = [4]byte{'I', 'D', 'P', 'I'}
+	markerILGT    = [4]byte{'I', 'L', 'G', 'T'}
+	markerIPLT    = [4]byte{'I', 'P', 'L', 'T'}
+	markerISHP    = [4]byte{'I', 'S', 'H', 'P'}
+	markerISRF    = [4]byte{'I', 'S', 'R', 'F'}
+	markerIDIT    = [4]byte{'I', 'D', 'I', 'T'}
+	markerISMP    = [4]byte{'I', 'S', 'M', 'P'}
+	markerILNG    = [4]byte{'I', 'L', 'N', 'G'}
+	markerICNT    = [4]byte{'I', 'C', 'N', 'T'}
+	markerIPRT    = [4]byte{'I', 'P', 'R', 'T'}
+	markerIBPM    = [4]byte{'I', 'B', 'P', 'M'}
+	markerIRTD    = [4]byte{'I', 'R', 'T', 'D'}
+	markerISTR    = [4]byte{'I', 'S', 'T', 'R'}
+	markerIWRI    = [4]byte{'I', 'W', 'R', 'I'}
+	markerIEDT    = [4]byte{'I', 'E', 'D', 'T'}
+	markerIENC    = [4]byte{'I', 'E', 'N', 'C'}
+	markerIMUS    = [4]byte{'I', 'M', 'U', 'S'}
+	markerIPRO    = [4]byte{'I', 'P', 'R', 'O'}
+	markerISGN    = [4]byte{'I', 'S', 'G', 'N'}
+	markerISTD    = [4]byte{'I', 'S', 'T', 'D'}
 )
 
+// infoFields maps the INFO markers to the Metadata fields they are stored in.
+// Entries are encoded in this order.
+var infoFields = []struct {
+	id    [4]byte
+	field func(m *Metadata) *string
+}{
+	{markerIART, func(m *Metadata) *string { return &m.Artist }},
+	{markerICMT, func(m *Metadata) *string { return &m.Comments }},
+	{markerICOP, func(m *Metadata) *string { return &m.Copyright }},
+	{markerICRD, func(m *Metadata) *string { return &m.CreationDate }},
+	{markerIENG, func(m *Metadata) *string { return &m.Engineer }},
+	{markerITCH, func(m *Metadata) *string { return &m.Technician }},
+	{markerIGNR, func(m *Metadata) *string { return &m.Genre }},
+	{markerIKEY, func(m *Metadata) *string { return &m.Keywords }},
+	{markerIMED, func(m *Metadata) *string { return &m.Medium }},
+	{markerINAM, func(m *Metadata) *string { return &m.Title }},
+	{markerIPRD, func(m *Metadata) *string { return &m.Product }},
+	{markerISBJ, func(m *Metadata) *string { return &m.Subject }},
+	{markerISFT, func(m *Metadata) *string { return &m.Software }},
+	{markerISRC, func(m *Metadata) *string { return &m.Source }},
+	{markerIARL, func(m *Metadata) *string { return &m.Location }},
+	{markerITRK, func(m *Metadata) *string { return &m.TrackNbr }},
+	{markerICMS, func(m *Metadata) *string { return &m.Commissioned }},
+	{markerICRP, func(m *Metadata) *string { return &m.Cropped }},
+	{markerIDIM, func(m *Metadata) *string { return &m.Dimensions }},
+	{markerIDPI, func(m *Metadata) *string { return &m.DotsPerInch }},
+	{markerILGT, func(m *Metadata) *string { return &m.Lightness }},
+	{markerIPLT, func(m *Metadata) *string { return &m.Palette }},
+	{markerISHP, func(m *Metadata) *string { return &m.Sharpness }},
+	{markerISRF, func(m *Metadata) *string { return &m.SourceForm }},
+	{markerIDIT, func(m *Metadata) *string { return &m.DigitizationDate }},
+	{markerISMP, func(m *Metadata) *string { return &m.SMPTETimecode }},
+	{markerILNG, func(m *Metadata) *string { return &m.Language }},
+	{markerICNT, func(m *Metadata) *string { return &m.Country }},
+	{markerIPRT, func(m *Metadata) *string { return &m.Part }},
+	{markerIBPM, func(m *Metadata) *string { return &m.BPM }},
+	{markerIRTD, func(m *Metadata) *string { return &m.Rating }},
+	{markerISTR, func(m *Metadata) *string { return &m.Starring }},
+	{markerIWRI, func(m *Metadata) *string { return &m.Writer }},
+	{markerIEDT, func(m *Metadata) *string { return &m.EditedBy }},
+	{markerIENC, func(m *Metadata) *string { return &m.EncodedBy }},
+	{markerIMUS, func(m *Metadata) *string { return &m.MusicBy }},
+	{markerIPRO, func(m *Metadata) *string { return &m.ProducedBy }},
+	{markerISGN, func(m *Metadata) *string { return &m.SecondaryGenre }},
+	{markerISTD, func(m *Metadata) *string { return &m.ProductionStudio }},
+}
+
+// infoField returns the Metadata field matching the passed INFO marker, nil
+// if the marker isn't mapped to a field.
+func infoField(m *Metadata, id [4]byte) *string {
+	if id == markerITRKBug {
+		id = markerITRK
+	}
+	for _, f := range infoFields {
+		if f.id == id {
+			return f.field(m)
+		}
+	}
+	return nil
+}
+
 // DecodeListChunk decodes a LIST chunk
 func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 	if ch == nil {
@@ -40,24 +125,31 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 		return fmt.Errorf("nil decoder")
 	}
 	if ch.ID == CIDList {
-		// read the entire chunk in memory
-		buf := make([]byte, ch.Size)
-		var err error
-		if _, err = ch.Read(buf); err != nil {
-			return fmt.Errorf("failed to read the LIST chunk - %w", err)
-		}
-		r := bytes.NewReader(buf)
-		// INFO subchunk
+		// INFO subchunk, the list type is read first to not load other lists
+		// (such as wavl) in memory.
 		scratch := make([]byte, 4)
-		if _, err = r.Read(scratch); err != nil {
+		var err error
+		if _, err = io.ReadFull(ch, scratch); err != nil {
 			return fmt.Errorf("failed to read the INFO subchunk - %w", err)
 		}
+		if bytes.Equal(scratch, CIDAdtl[:]) {
+			buf := make([]byte, ch.Size-len(scratch))
+			if _, err = io.ReadFull(ch, buf); err != nil {
+				return fmt.Errorf("failed to read the adtl LIST chunk - %w", err)
+			}
+			return decodeAssociatedData(d, buf)
+		}
 		if !bytes.Equal(scratch, CIDInfo[:]) {
 			// "expected an INFO subchunk but got %s", string(scratch)
-			// TODO: support adtl subchunks
 			ch.Drain()
 			return nil
 		}
+		// read the rest of the chunk in memory
+		buf := make([]byte, ch.Size-len(scratch))
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the LIST chunk - %w", err)
+		}
+		r := bytes.NewReader(buf)
 		if d.Metadata == nil {
 			d.Metadata = &Metadata{}
 		}
@@ -67,6 +159,12 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 			id   [4]byte
 			size uint32
 		)
+		list := infoList{pos: -1}
+		if d.r != nil {
+			if pos, err := d.r.Seek(0, io.SeekCurrent); err == nil {
+				list.pos = pos
+			}
+		}
 		readSubHeader := func() error {
 			if err := binary.Read(r, binary.BigEndian, &id); err != nil {
 				return err
@@ -101,104 +199,122 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 				return fmt.Errorf("read sub header %s data %v: %w", id, scratch, err)
 			}
 
-			switch id {
-			case markerIARL:
-				d.Metadata.Location = nullTermStr(scratch)
-			case markerIART:
-				d.Metadata.Artist = nullTermStr(scratch)
-			case markerISFT:
-				d.Metadata.Software = nullTermStr(scratch)
-			case markerICRD:
-				d.Metadata.CreationDate = nullTermStr(scratch)
-			case markerICOP:
-				d.Metadata.Copyright = nullTermStr(scratch)
-			case markerINAM:
-				d.Metadata.Title = nullTermStr(scratch)
-			case markerIENG:
-				d.Metadata.Engineer = nullTermStr(scratch)
-			case markerIGNR:
-				d.Metadata.Genre = nullTermStr(scratch)
-			case markerIPRD:
-				d.Metadata.Product = nullTermStr(scratch)
-			case markerISRC:
-				d.Metadata.Source = nullTermStr(scratch)
-			case markerISBJ:
-				d.Metadata.Subject = nullTermStr(scratch)
-			case markerICMT:
-				d.Metadata.Comments = nullTermStr(scratch)
-			case markerITRK, markerITRKBug:
-				d.Metadata.TrackNbr = nullTermStr(scratch)
-			case markerITCH:
-				d.Metadata.Technician = nullTermStr(scratch)
-			case markerIKEY:
-				d.Metadata.Keywords = nullTermStr(scratch)
-			case markerIMED:
-				d.Metadata.Medium = nullTermStr(scratch)
+			// odd sized entries should be followed by a padding byte but
+			// not all writers add it.
+			if size%2 == 1 {
+				if b, err := r.ReadByte(); err == nil {
+					if b == 0 {
+						rem--
+					} else {
+						r.UnreadByte()
+					}
+				}
 			}
+
+			raw := scratch[:clen(scratch)]
+			list.entries = append(list.entries, infoValue{id: id, raw: append([]byte(nil), raw...)})
 		}
+		d.addInfoList(list)
 	}
 	ch.Drain()
 	return nil
 }
 
+// infoList contains the raw entries of a LIST INFO chunk.
+type infoList struct {
+	// pos is the position of the chunk in the reader, -1 if unknown.
+	pos     int64
+	entries []infoValue
+}
+
+// infoValue is a raw INFO entry.
+type infoValue struct {
+	id  [4]byte
+	raw []byte
+}
+
+// addInfoList adds the entries of a LIST INFO chunk to the ones already read
+// and decodes the INFO fields of all of them. A chunk read again, as done
+// when rewinding, replaces its previous entries.
+func (d *Decoder) addInfoList(list infoList) {
+	replaced := false
+	if list.pos >= 0 {
+		for i := range d.infoLists {
+			if d.infoLists[i].pos == list.pos {
+				d.infoLists[i] = list
+				replaced = true
+				break
+			}
+		}
+	}
+	if !replaced {
+		d.infoLists = append(d.infoLists, list)
+	}
+	d.decodeInfo()
+}
+
+// decodeInfo sets the INFO fields of the metadata from the LIST INFO chunks
+// read. The values of the entries found multiple times are preserved in
+// ExtraInfo after the first one.
+func (d *Decoder) decodeInfo() {
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	d.Metadata.ExtraInfo = nil
+	seen := map[*string]bool{}
+	for _, list := range d.infoLists {
+		for _, e := range list.entries {
+			val := d.infoCharset(e.raw).decode(e.raw)
+			if field := infoField(d.Metadata, e.id); field != nil && !seen[field] {
+				*field = val
+				seen[field] = true
+				continue
+			}
+			// unknown entries and duplicates are preserved
+			if d.Metadata.ExtraInfo == nil {
+				d.Metadata.ExtraInfo = map[string][]string{}
+			}
+			d.Metadata.ExtraInfo[string(e.id[:])] = append(d.Metadata.ExtraInfo[string(e.id[:])], val)
+		}
+	}
+}
+
 func encodeInfoChunk(e *Encoder) []byte {
 	if e == nil || e.Metadata == nil {
 		return nil
 	}
 	buf := bytes.NewBuffer(nil)
+	cs := e.infoCharset()
 
 	writeSection := func(id [4]byte, val string) {
+		b := cs.encode(val)
 		buf.Write(id[:])
-		binary.Write(buf, binary.LittleEndian, uint32(len(val)+1))
-		buf.Write(append([]byte(val), 0x00))
-	}
-	if e.Metadata.Artist != "" {
-		writeSection(markerIART, e.Metadata.Artist)
-	}
-	if e.Metadata.Comments != "" {
-		writeSection(markerICMT, e.Metadata.Comments)
-	}
-	if e.Metadata.Copyright != "" {
-		writeSection(markerICOP, e.Metadata.Copyright)
-	}
-	if e.Metadata.CreationDate != "" {
-		writeSection(markerICRD, e.Metadata.CreationDate)
-	}
-	if e.Metadata.Engineer != "" {
-		writeSection(markerIENG, e.Metadata.Engineer)
-	}
-	if e.Metadata.Technician != "" {
-		writeSection(markerITCH, e.Metadata.Technician)
-	}
-	if e.Metadata.Genre != "" {
-		writeSection(markerIGNR, e.Metadata.Genre)
-	}
-	if e.Metadata.Keywords != "" {
-		writeSection(markerIKEY, e.Metadata.Keywords)
-	}
-	if e.Metadata.Medium != "" {
-		writeSection(markerIMED, e.Metadata.Medium)
-	}
-	if e.Metadata.Title != "" {
-		writeSection(markerINAM, e.Metadata.Title)
-	}
-	if e.Metadata.Product != "" {
-		writeSection(markerIPRD, e.Metadata.Product)
-	}
-	if e.Metadata.Subject != "" {
-		writeSection(markerISBJ, e.Metadata.Subject)
-	}
-	if e.Metadata.Software != "" {
-		writeSection(markerISFT, e.Metadata.Software)
+		binary.Write(buf, binary.LittleEndian, uint32(len(b)+1))
+		buf.Write(append(b, 0x00))
+		// word alignment
+		if (len(b)+1)%2 == 1 {
+			buf.WriteByte(0x00)
+		}
 	}
-	if e.Metadata.Source != "" {
-		writeSection(markerISRC, e.Metadata.Source)
+	for _, f := range infoFields {
+		if val := *f.field(e.Metadata); val != "" {
+			writeSection(f.id, val)
+		}
 	}
-	if e.Metadata.Location != "" {
-		writeSection(markerIARL, e.Metadata.Location)
+	ids := make([]string, 0, len(e.Metadata.ExtraInfo))
+	for id := range e.Metadata.ExtraInfo {
+		ids = append(ids, id)
 	}
-	if e.Metadata.TrackNbr != "" {
-		writeSection(markerITRK, e.Metadata.TrackNbr)
+	sort.Strings(ids)
+	for _, id := range ids {
+		if len(id) != 4 {
+			continue
+		}
+		var marker [4]byte
+		copy(marker[:], id)
+		for _, val := range e.Metadata.ExtraInfo[id] {
+			writeSection(marker, val)
+		}
 	}
 
 	return append(CIDInfo, buf.Bytes()...)
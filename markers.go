@@ -0,0 +1,354 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// Marker is a named position in the audio content, built from a cue point
+// and its adtl labels.
+type Marker struct {
+	// ID is the ID of the underlying cue point. The encoder assigns an unused
+	// ID when it is 0.
+	ID uint32
+	// Frame is the position of the marker in frames.
+	Frame int
+	// Time is the position of the marker. When encoding, it is only used if
+	// Frame is 0.
+	Time time.Duration
+	// Label is the name of the marker (labl entry).
+	Label string
+	// Note is a comment attached to the marker (note entry).
+	Note string
+}
+
+// Region is a section of the audio content, built from a cue point with a
+// length (ltxt entry) or a sample loop (smpl chunk), and its adtl labels.
+type Region struct {
+	// ID is the ID of the underlying cue point. The encoder assigns an unused
+	// ID when it is 0.
+	ID uint32
+	// Start is the first frame of the region and Length its number of frames.
+	Start  int
+	Length int
+	// StartTime and Duration are the time equivalents of Start and Length.
+	// When encoding, they are only used if Start and Length are 0.
+	StartTime time.Duration
+	Duration  time.Duration
+	// Label is the name of the region (labl entry).
+	Label string
+	// Note is a comment attached to the region (note entry).
+	Note string
+	// Loop is true when the region is a sample loop, LoopType and PlayCount
+	// being the settings of the loop. See SampleLoop.
+	Loop      bool
+	LoopType  uint32
+	PlayCount uint32
+}
+
+// Markers returns the cue points of the file which don't define a region.
+// See ReadMetadata for the position of the decoder afterwards.
+func (d *Decoder) Markers() ([]*Marker, error) {
+	markers, _, err := d.markersAndRegions()
+	return markers, err
+}
+
+// Regions returns the sections of the file defined by labeled texts (ltxt)
+// and sample loops.
+func (d *Decoder) Regions() ([]*Region, error) {
+	_, regions, err := d.markersAndRegions()
+	return regions, err
+}
+
+func (d *Decoder) markersAndRegions() ([]*Marker, []*Region, error) {
+	// cue points are resolved against the PCM data
+	if err := d.loadMetadata(); err != nil {
+		return nil, nil, err
+	}
+	m := d.Metadata
+	if m == nil {
+		return nil, nil, nil
+	}
+	labels := map[[4]byte]string{}
+	for _, l := range m.Labels {
+		labels[l.CueID] = l.Text
+	}
+	notes := map[[4]byte]string{}
+	for _, l := range m.Notes {
+		notes[l.CueID] = l.Text
+	}
+	texts := map[[4]byte]*LabeledText{}
+	for _, lt := range m.LabeledTexts {
+		texts[lt.CueID] = lt
+	}
+	loops := map[[4]byte]*SampleLoop{}
+	if m.SamplerInfo != nil {
+		for _, l := range m.SamplerInfo.Loops {
+			loops[l.CuePointID] = l
+		}
+	}
+
+	var (
+		markers []*Marker
+		regions []*Region
+	)
+	cues := map[[4]byte]bool{}
+	for _, c := range m.CuePoints {
+		cues[c.ID] = true
+		frame, err := d.CuePointFrame(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		lt, isText := texts[c.ID]
+		loop, isLoop := loops[c.ID]
+		if !isText && !isLoop {
+			markers = append(markers, &Marker{
+				ID:    binary.LittleEndian.Uint32(c.ID[:]),
+				Frame: frame,
+				Time:  d.framesDuration(frame),
+				Label: labels[c.ID],
+				Note:  notes[c.ID],
+			})
+			continue
+		}
+		r := &Region{
+			ID:    binary.LittleEndian.Uint32(c.ID[:]),
+			Start: frame,
+			Label: labels[c.ID],
+			Note:  notes[c.ID],
+		}
+		if isText {
+			r.Length = int(lt.Length)
+			if r.Label == "" {
+				r.Label = lt.Text
+			}
+		}
+		if isLoop {
+			setLoop(r, loop)
+		}
+		r.StartTime, r.Duration = d.framesDuration(r.Start), d.framesDuration(r.Length)
+		regions = append(regions, r)
+	}
+	// loops without cue point
+	if m.SamplerInfo != nil {
+		for _, l := range m.SamplerInfo.Loops {
+			if cues[l.CuePointID] {
+				continue
+			}
+			r := &Region{ID: binary.LittleEndian.Uint32(l.CuePointID[:])}
+			setLoop(r, l)
+			r.StartTime, r.Duration = d.framesDuration(r.Start), d.framesDuration(r.Length)
+			regions = append(regions, r)
+		}
+	}
+	sort.SliceStable(markers, func(i, j int) bool { return markers[i].Frame < markers[j].Frame })
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+	return markers, regions, nil
+}
+
+// setLoop sets the position and settings of the passed sample loop on the
+// region.
+func setLoop(r *Region, l *SampleLoop) {
+	r.Loop = true
+	r.LoopType = l.Type
+	r.PlayCount = l.PlayCount
+	r.Start = int(l.Start)
+	r.Length = 0
+	if l.End >= l.Start {
+		// the end frame is played
+		r.Length = int(l.End-l.Start) + 1
+	}
+}
+
+// framesDuration converts a number of frames into a duration.
+func (d *Decoder) framesDuration(frames int) time.Duration {
+	if d.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(frames) / float64(d.SampleRate) * float64(time.Second))
+}
+
+// SetMarkers sets the markers written in the cue chunk and the adtl list
+// when the encoder is closed.
+func (e *Encoder) SetMarkers(markers ...*Marker) {
+	e.markers = markers
+}
+
+// SetRegions sets the regions written in the cue chunk, the adtl list and,
+// for loops, the smpl chunk when the encoder is closed.
+func (e *Encoder) SetRegions(regions ...*Region) {
+	e.regions = regions
+}
+
+// durationFrames converts a duration into a number of frames.
+func (e *Encoder) durationFrames(dur time.Duration) int {
+	return int(math.Round(dur.Seconds() * float64(e.SampleRate)))
+}
+
+// hasCues returns positively if markers or regions must be written.
+func (e *Encoder) hasCues() bool {
+	return len(e.markers) > 0 || len(e.regions) > 0
+}
+
+// writeCues writes the cue chunk, the adtl list and the smpl chunk
+// describing the markers and regions, or the ones of the metadata if none
+// are set.
+func (e *Encoder) writeCues() error {
+	if !e.hasCues() {
+		return e.writeMetadataCues()
+	}
+	// assign the missing IDs
+	used := map[uint32]bool{}
+	for _, m := range e.markers {
+		used[m.ID] = true
+	}
+	for _, r := range e.regions {
+		used[r.ID] = true
+	}
+	nextID := uint32(1)
+	newID := func(id uint32) [4]byte {
+		if id == 0 {
+			for used[nextID] {
+				nextID++
+			}
+			id = nextID
+			used[id] = true
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], id)
+		return b
+	}
+
+	var (
+		cues         []*CuePoint
+		labels       []*CueLabel
+		notes        []*CueLabel
+		labeledTexts []*LabeledText
+		loops        []*SampleLoop
+	)
+	addCue := func(id [4]byte, frame int, label, note string) {
+		cues = append(cues, &CuePoint{
+			ID:           id,
+			Position:     uint32(frame),
+			DataChunkID:  riff.DataFormatID,
+			SampleOffset: uint32(frame),
+		})
+		if label != "" {
+			labels = append(labels, &CueLabel{CueID: id, Text: label})
+		}
+		if note != "" {
+			notes = append(notes, &CueLabel{CueID: id, Text: note})
+		}
+	}
+	for _, m := range e.markers {
+		frame := m.Frame
+		if frame == 0 {
+			frame = e.durationFrames(m.Time)
+		}
+		addCue(newID(m.ID), frame, m.Label, m.Note)
+	}
+	for _, r := range e.regions {
+		start, length := r.Start, r.Length
+		if start == 0 && length == 0 {
+			start, length = e.durationFrames(r.StartTime), e.durationFrames(r.Duration)
+		}
+		id := newID(r.ID)
+		addCue(id, start, r.Label, r.Note)
+		labeledTexts = append(labeledTexts, &LabeledText{CueID: id, Length: uint32(length), Purpose: purposeRegion})
+		if r.Loop {
+			end := start
+			if length > 0 {
+				end = start + length - 1
+			}
+			loops = append(loops, &SampleLoop{
+				CuePointID: id,
+				Type:       r.LoopType,
+				Start:      uint32(start),
+				End:        uint32(end),
+				PlayCount:  r.PlayCount,
+			})
+		}
+	}
+
+	if err := e.writeChunk(CIDCue, encodeCueChunk(cues)); err != nil {
+		return err
+	}
+	if data := encodeAssociatedData(e, labels, notes, labeledTexts); data != nil {
+		if err := e.writeChunk(CIDList, data); err != nil {
+			return err
+		}
+	}
+	if len(loops) > 0 {
+		info := SamplerInfo{MIDIUnityNote: 60}
+		if e.SampleRate > 0 {
+			info.SamplePeriod = uint32(time.Second / time.Duration(e.SampleRate))
+		}
+		if e.Metadata != nil && e.Metadata.SamplerInfo != nil {
+			info = *e.Metadata.SamplerInfo
+		}
+		info.NumSampleLoops = uint32(len(loops))
+		info.Loops = loops
+		if err := e.writeChunk(CIDSmpl, encodeSamplerChunk(&info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMetadataCues writes the cue points, adtl entries and sampler info of
+// the metadata as is, it is used when no markers or regions are set.
+func (e *Encoder) writeMetadataCues() error {
+	m := e.Metadata
+	if m == nil {
+		return nil
+	}
+	if len(m.CuePoints) > 0 {
+		if err := e.writeChunk(CIDCue, encodeCueChunk(m.CuePoints)); err != nil {
+			return err
+		}
+	}
+	if data := encodeAssociatedData(e, m.Labels, m.Notes, m.LabeledTexts); data != nil {
+		if err := e.writeChunk(CIDList, data); err != nil {
+			return err
+		}
+	}
+	if m.SamplerInfo != nil {
+		info := *m.SamplerInfo
+		info.NumSampleLoops = uint32(len(info.Loops))
+		if err := e.writeChunk(CIDSmpl, encodeSamplerChunk(&info)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeCueChunk returns the content of the cue chunk.
+func encodeCueChunk(cues []*CuePoint) []byte {
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, uint32(len(cues)))
+	for _, c := range cues {
+		binary.Write(buf, binary.LittleEndian, c)
+	}
+	return buf.Bytes()
+}
+
+// encodeSamplerChunk returns the content of the smpl chunk.
+func encodeSamplerChunk(info *SamplerInfo) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(info.Manufacturer[:])
+	buf.Write(info.Product[:])
+	binary.Write(buf, binary.LittleEndian, []uint32{info.SamplePeriod, info.MIDIUnityNote,
+		info.MIDIPitchFraction, info.SMPTEFormat, info.SMPTEOffset, info.NumSampleLoops,
+		// sampler data
+		0})
+	for _, l := range info.Loops {
+		buf.Write(l.CuePointID[:])
+		binary.Write(buf, binary.LittleEndian, []uint32{l.Type, l.Start, l.End, l.Fraction, l.PlayCount})
+	}
+	return buf.Bytes()
+}
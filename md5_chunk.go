@@ -0,0 +1,110 @@
+package wav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// MD5 chunk is documented here:
+// https://mediaarea.net/BWFMetaEdit/md5
+
+// ChecksumError is returned by Decoder.VerifyChecksum when the MD5 of the PCM
+// data doesn't match the MD5 chunk.
+type ChecksumError struct {
+	Expected []byte
+	Actual   []byte
+}
+
+// Error implements the error interface.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("PCM data checksum mismatch, expected %x but got %x", e.Expected, e.Actual)
+}
+
+// DecodeMD5Chunk decodes a MD5 chunk and puts the data in
+// Decoder.Metadata.AudioMD5.
+func DecodeMD5Chunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDMD5 {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the MD5 chunk - %w", err)
+		}
+		if len(buf) < md5.Size {
+			return fmt.Errorf("MD5 chunk too short: %d bytes", len(buf))
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.AudioMD5 = buf[:md5.Size]
+	}
+	ch.Drain()
+	return nil
+}
+
+// VerifyChecksum computes the MD5 of the PCM data and compares it to the
+// content of the MD5 chunk. ErrChecksumNotFound is returned if the file
+// doesn't have a MD5 chunk and a *ChecksumError if the checksums don't match.
+// For wave lists, the data chunks are hashed as they are stored, the silent
+// segments being skipped. The entire file is read and the decoder is rewound to the start
+// of the PCM data afterwards, whatever the outcome.
+func (d *Decoder) VerifyChecksum() (err error) {
+	if d == nil {
+		return errors.New("nil decoder")
+	}
+	if d.stream() != nil {
+		return fmt.Errorf("can't verify the checksum of a stream - %w", ErrNotSeekable)
+	}
+	defer func() {
+		if rerr := d.Rewind(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		return err
+	}
+	if d.Metadata == nil || d.Metadata.AudioMD5 == nil {
+		return ErrChecksumNotFound
+	}
+	expected := d.Metadata.AudioMD5
+	if err := d.Rewind(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrPCMChunkNotFound
+		}
+		return err
+	}
+	h := md5.New()
+	if d.waveList == nil {
+		if _, err := io.Copy(h, d.PCMChunk.R); err != nil {
+			return fmt.Errorf("failed to read the PCM data - %w", err)
+		}
+	} else {
+		for _, s := range d.waveList.segments {
+			if s.silent {
+				continue
+			}
+			if _, err := d.r.Seek(s.offset, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.CopyN(h, d.r, int64(s.size)); err != nil {
+				return fmt.Errorf("failed to read the PCM data - %w", err)
+			}
+		}
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return &ChecksumError{Expected: expected, Actual: actual}
+	}
+	return nil
+}
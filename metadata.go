@@ -2,6 +2,8 @@ package wav
 
 // Metadata represents optional metadata added to the wav file.
 type Metadata struct {
+	// SamplerInfo is the content of the smpl chunk, if any. The encoder
+	// writes it unless markers or regions are set, see CuePoints.
 	SamplerInfo *SamplerInfo
 	// Artist of the original subject of the file. For example, Michaelangelo.
 	Artist string
@@ -48,8 +50,114 @@ type Metadata struct {
 	Location string
 	// TrackNbr is the track number
 	TrackNbr string
-	// CuePoints is a list of cue points in the wav file.
+	// Commissioned lists the name of the person or organization that
+	// commissioned the subject of the file. For example, Pope Julian II.
+	Commissioned string
+	// Cropped describes whether an image has been cropped and, if so, how it
+	// was cropped. For example, lower right corner.
+	Cropped string
+	// Dimensions specifies the size of the original subject of the file. For
+	// example, 8.5 in h, 11 in w.
+	Dimensions string
+	// DotsPerInch stores dots per inch setting of the digitizer used to
+	// produce the file, such as 300.
+	DotsPerInch string
+	// Lightness describes the changes in lightness settings on the digitizer
+	// required to produce the file.
+	Lightness string
+	// Palette specifies the number of colors requested when digitizing an
+	// image, such as 256.
+	Palette string
+	// Sharpness identifies the changes in sharpness for the digitizer required
+	// to produce the file.
+	Sharpness string
+	// SourceForm identifies the original form of the material that was
+	// digitized, such as slide, paper, map and so forth.
+	SourceForm string
+	// DigitizationDate (IDIT) is the date and time the original material was
+	// digitized, for instance Wed Jan 02 02:03:55 1990.
+	DigitizationDate string
+	// SMPTETimecode (ISMP) is the SMPTE time code of the digitization start
+	// point expressed as a string of the form HH:MM:SS:FF.
+	SMPTETimecode string
+	// Language (ILNG) is the language of the content.
+	Language string
+	// Country (ICNT) is the country the content was produced in.
+	Country string
+	// Part (IPRT) is the part of a set the file belongs to, such as 1/3.
+	Part string
+	// BPM (IBPM) is the tempo in beats per minute.
+	BPM string
+	// Rating (IRTD) is the rating of the content.
+	Rating string
+	// Starring (ISTR) lists the performers.
+	Starring string
+	// Writer (IWRI) lists the writers of the content.
+	Writer string
+	// EditedBy (IEDT) lists the editors of the content.
+	EditedBy string
+	// EncodedBy (IENC) identifies who or what encoded the file.
+	EncodedBy string
+	// MusicBy (IMUS) lists the composers of the music.
+	MusicBy string
+	// ProducedBy (IPRO) lists the producers of the content.
+	ProducedBy string
+	// SecondaryGenre (ISGN) is an additional genre.
+	SecondaryGenre string
+	// ProductionStudio (ISTD) is the studio the content was produced in.
+	ProductionStudio string
+	// ExtraInfo contains the INFO entries that don't have a dedicated field,
+	// keyed by their 4 character ID, as well as the additional values of
+	// entries found multiple times (for instance a second IART). They are
+	// written back after the other INFO entries.
+	ExtraInfo map[string][]string
+	// CharacterSet is the content of the CSET chunk, if any. It defines the
+	// code page used by the INFO strings.
+	CharacterSet *CharacterSet
+	// PeakEnvelope is the content of the levl chunk, if any.
+	PeakEnvelope *PeakEnvelope
+	// Peak is the content of the PEAK chunk, if any.
+	Peak *Peak
+	// AudioMD5 is the MD5 of the PCM data found in the MD5 chunk, if any. See
+	// Decoder.VerifyChecksum.
+	AudioMD5 []byte
+	// CuePoints is a list of cue points in the wav file. Unless markers or
+	// regions are set, the encoder writes them in a cue chunk, Labels, Notes
+	// and LabeledTexts in an adtl list and SamplerInfo in a smpl chunk.
+	// These fields used to be ignored by the encoder: encoding the Metadata
+	// of a decoded file now copies its cue, adtl and smpl chunks, set them to
+	// nil to only write the other metadata.
 	CuePoints []*CuePoint
+	// Labels contains the labl entries of the adtl list, naming cue points.
+	Labels []*CueLabel
+	// Notes contains the note entries of the adtl list, commenting cue points.
+	Notes []*CueLabel
+	// LabeledTexts contains the ltxt entries of the adtl list, giving a length
+	// to cue points.
+	LabeledTexts []*LabeledText
+	// PlayList is the content of the plst chunk, if any. See
+	// NewPlayListReader to read the PCM data in play list order.
+	PlayList []*PlaySegment
+	// ID3 is the ID3v2 tag found in the id3 chunk, if any. Set it to write an
+	// id3 chunk.
+	ID3 *ID3Tag
+	// XMP is the XMP packet found in the _PMX chunk, if any. Set it to write a
+	// _PMX chunk.
+	XMP *XMP
+	// BroadcastExtension is the content of the bext chunk of Broadcast Wave
+	// Format files, if any. Set it to write a bext chunk.
+	BroadcastExtension *BroadcastExtension
+	// IXML is the iXML document found in the iXML chunk, if any.
+	IXML *IXML
+	// ChannelAllocation is the content of the chna chunk of object-based
+	// audio files, if any. Set it to write a chna chunk.
+	ChannelAllocation *ChannelAllocation
+	// ADM is the Audio Definition Model document found in the axml chunk, if
+	// any. Set it to write an axml chunk.
+	ADM *ADM
+	// Displays contains the DISP chunks of the file, such as a title or a
+	// cover picture. A DISP chunk is written for each entry.
+	Displays []*Display
 }
 
 // SamplerInfo is extra metadata pertinent to a sampler type usage.
@@ -122,11 +230,12 @@ type SampleLoop struct {
 	// 3 Reserved for future standard types
 	// 32 - 0xFFFFFFFF Sampler specific types (defined by manufacturer)
 	Type uint32
-	// Start - The start value specifies the byte offset into the waveform data
-	// of the first sample to be played in the loop.
+	// Start - The start value specifies the first frame to be played in the
+	// loop. The original specification mentions a byte offset but writers use
+	// sample frames.
 	Start uint32
-	// End - The end value specifies the byte offset into the waveform data of
-	// the last sample to be played in the loop.
+	// End - The end value specifies the last frame to be played in the loop
+	// (inclusive).
 	End uint32
 	// Fraction - The fractional value specifies a fraction of a sample at which
 	// to loop. This allows a loop to be fine tuned at a resolution greater than
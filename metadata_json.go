@@ -0,0 +1,320 @@
+package wav
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The JSON encoding of Metadata uses the Go field names as keys. The 4 byte
+// IDs referencing cue points are encoded as the decimal string of their
+// little endian value (like Marker.ID), chunk IDs and purposes as 4
+// character strings and the MIDI manufacturer and product codes as
+// hexadecimal strings. The positions of sample loops are expressed in frames,
+// see Decoder.MetadataJSON to also get them in bytes.
+
+func cueIDString(id [4]byte) string {
+	return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(id[:])), 10)
+}
+
+func parseCueID(s string) (id [4]byte, err error) {
+	if s == "" {
+		return id, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return id, fmt.Errorf("invalid cue point ID %q - %w", s, err)
+	}
+	binary.LittleEndian.PutUint32(id[:], uint32(v))
+	return id, nil
+}
+
+func fourCCString(id [4]byte) string {
+	return strings.TrimRight(string(id[:]), "\x00")
+}
+
+// parseFourCC parses a 4 character ID, shorter IDs being padded with spaces.
+func parseFourCC(s string) (id [4]byte, err error) {
+	if s == "" {
+		return id, nil
+	}
+	if len(s) > 4 {
+		return id, fmt.Errorf("invalid 4 character ID %q", s)
+	}
+	copy(id[:], s+"   ")
+	return id, nil
+}
+
+func hexCodeString(code [4]byte) string {
+	return fmt.Sprintf("0x%08X", binary.LittleEndian.Uint32(code[:]))
+}
+
+func parseHexCode(s string) (code [4]byte, err error) {
+	if s == "" {
+		return code, nil
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"), 16, 32)
+	if err != nil {
+		return code, fmt.Errorf("invalid code %q - %w", s, err)
+	}
+	binary.LittleEndian.PutUint32(code[:], uint32(v))
+	return code, nil
+}
+
+type jsonCuePoint struct {
+	ID           string
+	Position     uint32
+	DataChunkID  string
+	ChunkStart   uint32
+	BlockStart   uint32
+	SampleOffset uint32
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (c CuePoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonCuePoint{
+		ID:           cueIDString(c.ID),
+		Position:     c.Position,
+		DataChunkID:  fourCCString(c.DataChunkID),
+		ChunkStart:   c.ChunkStart,
+		BlockStart:   c.BlockStart,
+		SampleOffset: c.SampleOffset,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (c *CuePoint) UnmarshalJSON(b []byte) error {
+	var v jsonCuePoint
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if c.ID, err = parseCueID(v.ID); err != nil {
+		return err
+	}
+	if c.DataChunkID, err = parseFourCC(v.DataChunkID); err != nil {
+		return err
+	}
+	c.Position, c.ChunkStart, c.BlockStart, c.SampleOffset = v.Position, v.ChunkStart, v.BlockStart, v.SampleOffset
+	return nil
+}
+
+type jsonSampleLoop struct {
+	CuePointID string
+	Type       uint32
+	// Start and End are expressed in frames, StartByte and EndByte are the
+	// byte offsets of the same frames in the PCM data.
+	Start     uint32
+	End       uint32
+	StartByte *uint64 `json:",omitempty"`
+	EndByte   *uint64 `json:",omitempty"`
+	Fraction  uint32
+	PlayCount uint32
+}
+
+// newJSONSampleLoop returns the JSON representation of the loop, the byte
+// offsets being set if blockAlign isn't 0.
+func newJSONSampleLoop(l *SampleLoop, blockAlign int) *jsonSampleLoop {
+	v := &jsonSampleLoop{
+		CuePointID: cueIDString(l.CuePointID),
+		Type:       l.Type,
+		Start:      l.Start,
+		End:        l.End,
+		Fraction:   l.Fraction,
+		PlayCount:  l.PlayCount,
+	}
+	if blockAlign > 0 {
+		start, end := uint64(l.Start)*uint64(blockAlign), uint64(l.End)*uint64(blockAlign)
+		v.StartByte, v.EndByte = &start, &end
+	}
+	return v
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l SampleLoop) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONSampleLoop(&l, 0))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The byte offsets
+// are ignored, the positions in frames being used.
+func (l *SampleLoop) UnmarshalJSON(b []byte) error {
+	var v jsonSampleLoop
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if l.CuePointID, err = parseCueID(v.CuePointID); err != nil {
+		return err
+	}
+	l.Type, l.Start, l.End, l.Fraction, l.PlayCount = v.Type, v.Start, v.End, v.Fraction, v.PlayCount
+	return nil
+}
+
+type jsonSamplerInfo struct {
+	Manufacturer      string
+	Product           string
+	SamplePeriod      uint32
+	MIDIUnityNote     uint32
+	MIDIPitchFraction uint32
+	SMPTEFormat       uint32
+	SMPTEOffset       uint32
+	NumSampleLoops    uint32
+	Loops             []*jsonSampleLoop
+}
+
+// newJSONSamplerInfo returns the JSON representation of the sampler info,
+// see newJSONSampleLoop.
+func newJSONSamplerInfo(s *SamplerInfo, blockAlign int) *jsonSamplerInfo {
+	if s == nil {
+		return nil
+	}
+	v := &jsonSamplerInfo{
+		Manufacturer:      hexCodeString(s.Manufacturer),
+		Product:           hexCodeString(s.Product),
+		SamplePeriod:      s.SamplePeriod,
+		MIDIUnityNote:     s.MIDIUnityNote,
+		MIDIPitchFraction: s.MIDIPitchFraction,
+		SMPTEFormat:       s.SMPTEFormat,
+		SMPTEOffset:       s.SMPTEOffset,
+		NumSampleLoops:    s.NumSampleLoops,
+		Loops:             make([]*jsonSampleLoop, len(s.Loops)),
+	}
+	for i, l := range s.Loops {
+		v.Loops[i] = newJSONSampleLoop(l, blockAlign)
+	}
+	return v
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s SamplerInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONSamplerInfo(&s, 0))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *SamplerInfo) UnmarshalJSON(b []byte) error {
+	var v struct {
+		jsonSamplerInfo
+		Loops []*SampleLoop
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if s.Manufacturer, err = parseHexCode(v.Manufacturer); err != nil {
+		return err
+	}
+	if s.Product, err = parseHexCode(v.Product); err != nil {
+		return err
+	}
+	s.SamplePeriod, s.MIDIUnityNote, s.MIDIPitchFraction = v.SamplePeriod, v.MIDIUnityNote, v.MIDIPitchFraction
+	s.SMPTEFormat, s.SMPTEOffset = v.SMPTEFormat, v.SMPTEOffset
+	s.NumSampleLoops, s.Loops = v.NumSampleLoops, v.Loops
+	return nil
+}
+
+type jsonCueLabel struct {
+	CueID string
+	Text  string
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (l CueLabel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonCueLabel{CueID: cueIDString(l.CueID), Text: l.Text})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *CueLabel) UnmarshalJSON(b []byte) error {
+	var v jsonCueLabel
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	l.CueID, err = parseCueID(v.CueID)
+	l.Text = v.Text
+	return err
+}
+
+type jsonLabeledText struct {
+	CueID    string
+	Length   uint32
+	Purpose  string
+	Country  uint16
+	Language uint16
+	Dialect  uint16
+	CodePage uint16
+	Text     string
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (lt LabeledText) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonLabeledText{
+		CueID:    cueIDString(lt.CueID),
+		Length:   lt.Length,
+		Purpose:  fourCCString(lt.Purpose),
+		Country:  lt.Country,
+		Language: lt.Language,
+		Dialect:  lt.Dialect,
+		CodePage: lt.CodePage,
+		Text:     lt.Text,
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (lt *LabeledText) UnmarshalJSON(b []byte) error {
+	var v jsonLabeledText
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if lt.CueID, err = parseCueID(v.CueID); err != nil {
+		return err
+	}
+	if lt.Purpose, err = parseFourCC(v.Purpose); err != nil {
+		return err
+	}
+	lt.Length, lt.Country, lt.Language, lt.Dialect, lt.CodePage, lt.Text = v.Length, v.Country, v.Language, v.Dialect, v.CodePage, v.Text
+	return nil
+}
+
+type jsonPlaySegment struct {
+	CueID  string
+	Length uint32
+	Loops  uint32
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (s PlaySegment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&jsonPlaySegment{CueID: cueIDString(s.CueID), Length: s.Length, Loops: s.Loops})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *PlaySegment) UnmarshalJSON(b []byte) error {
+	var v jsonPlaySegment
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	s.CueID, err = parseCueID(v.CueID)
+	s.Length, s.Loops = v.Length, v.Loops
+	return err
+}
+
+// MetadataJSON returns the JSON encoding of the metadata of the file, the
+// positions of the sample loops being expressed in frames and in bytes. Use
+// json.Unmarshal to build a Metadata from the output, for instance to set
+// Encoder.Metadata.
+func (d *Decoder) MetadataJSON() ([]byte, error) {
+	if err := d.loadMetadata(); err != nil {
+		return nil, err
+	}
+	m := d.Metadata
+	if m == nil {
+		m = &Metadata{}
+	}
+	return json.Marshal(struct {
+		*Metadata
+		SamplerInfo *jsonSamplerInfo
+	}{m, newJSONSamplerInfo(m.SamplerInfo, d.blockAlign())})
+}
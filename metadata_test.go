@@ -1,10 +1,15 @@
 package wav
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"path"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
 )
 
 func TestDecoder_ReadMetadata(t *testing.T) {
@@ -16,6 +21,13 @@ func TestDecoder_ReadMetadata(t *testing.T) {
 			metadata: &Metadata{
 				Artist: "artist", Title: "track title", Product: "album title",
 				TrackNbr: "42", CreationDate: "2017", Genre: "genre", Comments: "my comment",
+				ID3: &ID3Tag{Version: 3,
+					Text: map[string]string{
+						"TALB": "album title", "TIT2": "track title", "TRCK": "42",
+						"TPE1": "artist", "TDRC": "2017", "TCON": "genre",
+					},
+					Comments: []*ID3Comment{{Text: "my comment"}},
+				},
 			},
 		},
 		{in: "fixtures/kick.wav"},
@@ -39,6 +51,42 @@ func TestDecoder_ReadMetadata(t *testing.T) {
 				14: {ID: [4]uint8{0xf, 0x0, 0x0, 0x0}, Position: 0x17124, DataChunkID: [4]uint8{0x64, 0x61, 0x74, 0x61}, SampleOffset: 0x17124},
 				15: {ID: [4]uint8{0x10, 0x0, 0x0, 0x0}, Position: 0x18b82, DataChunkID: [4]uint8{0x64, 0x61, 0x74, 0x61}, SampleOffset: 0x18b82},
 			},
+			Labels: []*CueLabel{
+				{CueID: [4]byte{1, 0, 0, 0}, Text: "Hat + Kick"},
+				{CueID: [4]byte{2, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{3, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{4, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{5, 0, 0, 0}, Text: "Snare + Clap + Hat"},
+				{CueID: [4]byte{6, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{7, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{8, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{9, 0, 0, 0}, Text: "Kick + Hat"},
+				{CueID: [4]byte{10, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{11, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{12, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{13, 0, 0, 0}, Text: "Clap + Snare + Hat"},
+				{CueID: [4]byte{14, 0, 0, 0}, Text: "Hat"},
+				{CueID: [4]byte{15, 0, 0, 0}, Text: "Kick + Hat"},
+				{CueID: [4]byte{16, 0, 0, 0}, Text: "Hat"},
+			},
+			LabeledTexts: []*LabeledText{
+				{CueID: [4]byte{1, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{2, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{3, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{4, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{5, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{6, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{7, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{8, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{9, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{10, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{11, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{12, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{13, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{14, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{15, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+				{CueID: [4]byte{16, 0, 0, 0}, Length: 0x1a5e, Purpose: [4]byte{'b', 'e', 'a', 't'}},
+			},
 			SamplerInfo: &SamplerInfo{SamplePeriod: 22676, MIDIUnityNote: 60, NumSampleLoops: 1,
 				Loops: []*SampleLoop{
 					{CuePointID: [4]byte{0, 0, 2, 0}, Type: 1024, Start: 0, End: 107999, Fraction: 0, PlayCount: 0},
@@ -82,3 +130,480 @@ func TestDecoder_ReadMetadata(t *testing.T) {
 		})
 	}
 }
+
+func TestParseXMP(t *testing.T) {
+	packet := []byte(`<?xpacket begin="` + "\xEF\xBB\xBF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="Adobe XMP Core 5.6-c148">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+   xmpDM:tempo="128.5"
+   xmpDM:key="Am">
+   <dc:title><rdf:Alt><rdf:li xml:lang="fr-FR">Le titre</rdf:li><rdf:li xml:lang="x-default">The title</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>Jane</rdf:li><rdf:li>John</rdf:li></rdf:Seq></dc:creator>
+   <dc:rights><rdf:Alt><rdf:li xml:lang="x-default">All rights reserved</rdf:li></rdf:Alt></dc:rights>
+   <xmpDM:Tracks>
+    <rdf:Bag>
+     <rdf:li>
+      <rdf:Description xmpDM:trackName="CuePoint Markers" xmpDM:trackType="Cue" xmpDM:frameRate="f48000">
+       <xmpDM:markers>
+        <rdf:Seq>
+         <rdf:li xmpDM:startTime="48000" xmpDM:name="Intro" xmpDM:type="Cue"/>
+         <rdf:li rdf:parseType="Resource"><xmpDM:startTime>96000</xmpDM:startTime><xmpDM:duration>24000</xmpDM:duration><xmpDM:name>Verse</xmpDM:name><xmpDM:comment>take 2</xmpDM:comment></rdf:li>
+        </rdf:Seq>
+       </xmpDM:markers>
+      </rdf:Description>
+     </rdf:li>
+    </rdf:Bag>
+   </xmpDM:Tracks>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	x, err := ParseXMP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &XMP{
+		Raw:     packet,
+		Title:   "The title",
+		Creator: []string{"Jane", "John"},
+		Rights:  "All rights reserved",
+		Tempo:   128.5,
+		Key:     "Am",
+		Markers: []*XMPMarker{
+			{Name: "Intro", Type: "Cue", Start: 48000, FrameRate: "f48000"},
+			{Name: "Verse", Comment: "take 2", Start: 96000, Duration: 24000, FrameRate: "f48000"},
+		},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", expected, x)
+	}
+	if start, err := x.Markers[1].StartTime(); err != nil || start != 2*time.Second {
+		t.Fatalf("expected the marker to start at 2s, got %s (%v)", start, err)
+	}
+	if dur, err := x.Markers[1].DurationTime(); err != nil || dur != 500*time.Millisecond {
+		t.Fatalf("expected the marker to last 500ms, got %s (%v)", dur, err)
+	}
+}
+
+func TestParseXMP_InvalidValues(t *testing.T) {
+	packet := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+   dc:title="Title" xmpDM:tempo="fast">
+   <xmpDM:markers><rdf:Seq>
+    <rdf:li xmpDM:startTime="00:01" xmpDM:duration="1.5" xmpDM:name="bad"/>
+    <rdf:li xmpDM:startTime="10" xmpDM:name="good"/>
+   </rdf:Seq></xmpDM:markers>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`)
+	x, err := ParseXMP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &XMP{
+		Raw:   packet,
+		Title: "Title",
+		Markers: []*XMPMarker{
+			{Name: "bad"},
+			{Name: "good", Start: 10},
+		},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Fatalf("expected\n%#v\ngot\n%#v", expected, x)
+	}
+}
+
+func TestDecoder_InfoCharset(t *testing.T) {
+	// "Café €" encoded using Windows-1252
+	info := append([]byte("INFO"), infoEntry("INAM", []byte{'C', 'a', 'f', 0xE9, ' ', 0x80})...)
+	testCases := []struct {
+		desc     string
+		chunks   [][]byte
+		fallback Charset
+		title    string
+	}{
+		{"default fallback", [][]byte{chunk("LIST", info)}, CharsetUnknown, "Café €"},
+		{"latin1 fallback", [][]byte{chunk("LIST", info)}, CharsetLatin1, "Café \u0080"},
+		{"CSET chunk", [][]byte{chunk("CSET", []byte{0xAF, 0x6F, 0, 0, 0, 0, 0, 0}), chunk("LIST", info)}, CharsetWindows1252, "Café \u0080"},
+		{"UTF-8", [][]byte{chunk("LIST", append([]byte("INFO"), infoEntry("INAM", []byte("Café €"))...))}, CharsetLatin1, "Café €"},
+		{"CSET chunk after the INFO list", [][]byte{chunk("LIST", info), chunk("CSET", []byte{0xAF, 0x6F, 0, 0, 0, 0, 0, 0})}, CharsetWindows1252, "Café \u0080"},
+		{"ASCII CSET chunk", [][]byte{chunk("CSET", []byte{0x9F, 0x4E, 0, 0, 0, 0, 0, 0}), chunk("LIST", info)}, CharsetWindows1252, "Caf\uFFFD \uFFFD"},
+		{"invalid UTF-8", [][]byte{chunk("CSET", []byte{0xE9, 0xFD, 0, 0, 0, 0, 0, 0}), chunk("LIST", info)}, CharsetUnknown, "Caf\uFFFD \uFFFD"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := NewDecoder(bytes.NewReader(wavWithChunks(tc.chunks...)))
+			d.CharsetFallback = tc.fallback
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata.Title != tc.title {
+				t.Fatalf("expected %q, got %q", tc.title, d.Metadata.Title)
+			}
+		})
+	}
+}
+
+func TestDisplay_Text(t *testing.T) {
+	// "Café €" encoded using Windows-1252
+	disp := chunk("DISP", append(le32(DisplayText), 'C', 'a', 'f', 0xE9, ' ', 0x80, 0))
+	latin1 := chunk("CSET", []byte{0xAF, 0x6F, 0, 0, 0, 0, 0, 0})
+	testCases := []struct {
+		desc   string
+		chunks [][]byte
+		text   string
+	}{
+		{"default fallback", [][]byte{disp}, "Café €"},
+		{"CSET chunk after the DISP chunk", [][]byte{disp, latin1}, "Café \u0080"},
+		{"UTF-8", [][]byte{chunk("DISP", append(le32(DisplayText), "Café €\x00"...))}, "Café €"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := NewDecoder(bytes.NewReader(wavWithChunks(tc.chunks...)))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if text, ok := d.Metadata.Displays[0].Text(); !ok || text != tc.text {
+				t.Fatalf("expected %q, got %q", tc.text, text)
+			}
+		})
+	}
+	if text, _ := NewDisplayText("Café").Text(); text != "Café" {
+		t.Fatalf("expected %q, got %q", "Café", text)
+	}
+}
+
+func TestDecoder_MultipleInfoLists(t *testing.T) {
+	first := append([]byte("INFO"), infoEntry("INAM", []byte("title"))...)
+	first = append(first, infoEntry("IXYZ", []byte("unknown"))...)
+	second := append([]byte("INFO"), infoEntry("INAM", []byte("other title"))...)
+	second = append(second, infoEntry("IART", []byte("artist"))...)
+	d := NewDecoder(bytes.NewReader(wavWithChunks(chunk("LIST", first), chunk("LIST", second))))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata.Title != "title" || d.Metadata.Artist != "artist" {
+		t.Fatalf("unexpected title %q and artist %q", d.Metadata.Title, d.Metadata.Artist)
+	}
+	expected := map[string][]string{"IXYZ": {"unknown"}, "INAM": {"other title"}}
+	if !reflect.DeepEqual(d.Metadata.ExtraInfo, expected) {
+		t.Fatalf("expected the extra entries %v, got %v", expected, d.Metadata.ExtraInfo)
+	}
+}
+
+// wavWithChunks returns a 16 bit mono wav file containing 2 frames followed by
+// the passed chunks.
+func wavWithChunks(chunks ...[]byte) []byte {
+	body := append([]byte("WAVE"), chunk("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1F, 0, 0, 0x80, 0x3E, 0, 0, 2, 0, 16, 0})...)
+	body = append(body, chunk("data", []byte{1, 0, 2, 0})...)
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return chunk("RIFF", body)
+}
+
+// chunk returns the passed data as a word aligned chunk.
+func chunk(id string, data []byte) []byte {
+	b := append([]byte(id), byte(len(data)), byte(len(data)>>8), byte(len(data)>>16), byte(len(data)>>24))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// infoEntry returns a null terminated INFO entry.
+func infoEntry(id string, val []byte) []byte {
+	return chunk(id, append(val, 0))
+}
+
+func TestDecoder_MarkersKeepPosition(t *testing.T) {
+	b, err := os.ReadFile("fixtures/flloop.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewDecoder(bytes.NewReader(b)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(b))
+	buf := &audio.IntBuffer{Data: make([]int, 1001)}
+	if _, err := d.PCMBuffer(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Markers(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.PCMBuffer(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf.Data[:n], expected.Data[1001:1001+n]) {
+		t.Fatal("expected the PCM data to continue where it was before reading the markers")
+	}
+}
+
+func TestDecoder_Regions(t *testing.T) {
+	f, err := os.Open("fixtures/flloop.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	markers, err := d.Markers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markers) != 0 {
+		t.Fatalf("expected no markers, got %d", len(markers))
+	}
+	regions, err := d.Regions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 16 labeled regions and a sample loop without cue point
+	if len(regions) != 17 {
+		t.Fatalf("expected 17 regions, got %d", len(regions))
+	}
+	loop := &Region{ID: 0x20000, Start: 0, Length: 108000, Duration: d.framesDuration(108000), Loop: true, LoopType: 1024}
+	if !reflect.DeepEqual(regions[1], loop) {
+		t.Fatalf("expected the loop region %+v, got %+v", loop, regions[1])
+	}
+	last := regions[16]
+	expected := &Region{ID: 16, Start: 0x18b82, Length: 0x1a5e, Label: "Hat",
+		StartTime: d.framesDuration(0x18b82), Duration: d.framesDuration(0x1a5e)}
+	if !reflect.DeepEqual(last, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, last)
+	}
+	// the decoder is ready to read the PCM data
+	buf := &audio.IntBuffer{Data: make([]int, 16)}
+	if n, err := d.PCMBuffer(buf); err != nil || n != 16 {
+		t.Fatalf("failed to read the PCM data after the regions: %d samples, %v", n, err)
+	}
+}
+
+func TestTimecode(t *testing.T) {
+	tests := []struct {
+		tc     string
+		rate   TimecodeRate
+		frames int
+	}{
+		{"00:00:01:00", TimecodeRate25, 25},
+		{"01:00:00:00", TimecodeRate24, 86400},
+		{"00:01:00:00", TimecodeRate23976, 1440},
+		{"00:00:59;29", TimecodeRate2997DF, 1799},
+		{"00:01:00;02", TimecodeRate2997DF, 1800},
+		{"00:10:00;00", TimecodeRate2997DF, 17982},
+		{"01:00:00;00", TimecodeRate2997DF, 107892},
+		{"23:59:59:29", TimecodeRate30, 2591999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tc+"@"+tt.rate.String(), func(t *testing.T) {
+			tc, err := ParseTimecode(tt.tc, tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.String() != tt.tc {
+				t.Fatalf("expected %s, got %s", tt.tc, tc)
+			}
+			if n := tc.FrameCount(); n != tt.frames {
+				t.Fatalf("expected %d frames, got %d", tt.frames, n)
+			}
+			if back := TimecodeFromFrameCount(tt.frames, tt.rate); back != tc {
+				t.Fatalf("expected %s, got %s", tc, back)
+			}
+			if back := TimecodeFromSamples(tc.Samples(48000), 48000, tt.rate); back != tc {
+				t.Fatalf("expected %s from samples, got %s", tc, back)
+			}
+		})
+	}
+
+	// drop frame timecodes skip frames 0 and 1 of each minute but every 10th
+	for n := 0; n < 2*17982; n++ {
+		tc := TimecodeFromFrameCount(n, TimecodeRate2997DF)
+		if err := tc.validate(); err != nil {
+			t.Fatalf("frame %d: %v", n, err)
+		}
+		if back := tc.FrameCount(); back != n {
+			t.Fatalf("frame %d: got %s which is frame %d", n, tc, back)
+		}
+	}
+	if _, err := ParseTimecode("00:01:00;00", TimecodeRate2997DF); err == nil {
+		t.Fatal("expected an error for a dropped frame")
+	}
+	if _, err := ParseTimecode("00:00:00:25", TimecodeRate25); err == nil {
+		t.Fatal("expected an error for an out of range frame")
+	}
+
+	// drop frame timecodes are 3.6ms late after an hour
+	tc := Timecode{Hours: 1, Rate: TimecodeRate2997DF}
+	if s := tc.Samples(48000); s != 172799827 {
+		t.Fatalf("expected 172799827 samples, got %d", s)
+	}
+
+	info := &SamplerInfo{}
+	info.SetTimecode(Timecode{Hours: 10, Minutes: 2, Seconds: 3, Frames: 4, Rate: TimecodeRate25})
+	if info.SMPTEFormat != 25 || info.SMPTEOffset != 0x0a020304 {
+		t.Fatalf("unexpected SMPTE format %d and offset %#x", info.SMPTEFormat, info.SMPTEOffset)
+	}
+	if tc, ok := info.Timecode(); !ok || tc.String() != "10:02:03:04" {
+		t.Fatalf("unexpected timecode %s", tc)
+	}
+}
+
+func TestDecoder_StartTimecode(t *testing.T) {
+	bext := make([]byte, 602)
+	copy(bext, "a description")
+	copy(bext[256:], "go-audio")
+	copy(bext[320:], "2024-01-02")
+	copy(bext[330:], "03-04-05")
+	// 01:00:00:00 at 8kHz
+	copy(bext[338:], le32(28800000, 0))
+	bext = append(bext, "A=PCM,F=8000,W=16,M=mono\r\n"...)
+
+	ixml := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<BWFXML><IXML_VERSION>2.10</IXML_VERSION><PROJECT>proj</PROJECT><SCENE>1A</SCENE><TAKE>3</TAKE>
+<SPEED><TIMECODE_RATE>30000/1001</TIMECODE_RATE><TIMECODE_FLAG>DF</TIMECODE_FLAG>
+<TIMESTAMP_SAMPLE_RATE>48000</TIMESTAMP_SAMPLE_RATE>
+<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>0</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_HI>
+<TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO>172799827</TIMESTAMP_SAMPLES_SINCE_MIDNIGHT_LO></SPEED></BWFXML>`)
+
+	smpl := make([]byte, 36)
+	info := &SamplerInfo{}
+	info.SetTimecode(Timecode{Hours: 2, Seconds: 1, Frames: 12, Rate: TimecodeRate25})
+	copy(smpl[20:], le32(info.SMPTEFormat, info.SMPTEOffset))
+
+	tests := []struct {
+		name     string
+		file     []byte
+		fallback TimecodeRate
+		samples  uint64
+		tc       string
+		err      error
+	}{
+		{"bext", wavWithChunks(chunk("bext", bext)), TimecodeRate25, 28800000, "01:00:00:00", nil},
+		{"bext with iXML rate", wavWithChunks(chunk("bext", bext), chunk("iXML", ixml)), TimecodeRate25, 28800000, "01:00:00;00", nil},
+		{"iXML", wavWithChunks(chunk("iXML", ixml)), TimecodeRateUnknown, 28799971, "01:00:00;00", nil},
+		{"smpl", wavWithChunks(chunk("smpl", smpl)), TimecodeRateUnknown, 57611840, "02:00:01:12", nil},
+		{"none", wavWithChunks(), TimecodeRate25, 0, "", ErrTimecodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(bytes.NewReader(tt.file))
+			samples, err := d.TimeReference()
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if samples != tt.samples {
+				t.Fatalf("expected %d samples, got %d", tt.samples, samples)
+			}
+			tc, err := d.StartTimecode(tt.fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.String() != tt.tc {
+				t.Fatalf("expected %s, got %s", tt.tc, tc)
+			}
+			// the decoder is ready to read the PCM data
+			buf, err := d.FullPCMBuffer()
+			if err != nil || !reflect.DeepEqual(buf.Data, []int{1, 2}) {
+				t.Fatalf("unexpected PCM data %v (%v)", buf, err)
+			}
+		})
+	}
+
+	d := NewDecoder(bytes.NewReader(wavWithChunks(chunk("bext", bext), chunk("iXML", ixml))))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	b := d.Metadata.BroadcastExtension
+	if b == nil || b.Description != "a description" || b.Originator != "go-audio" ||
+		b.OriginationDate != "2024-01-02" || b.OriginationTime != "03-04-05" ||
+		b.CodingHistory != "A=PCM,F=8000,W=16,M=mono\r\n" {
+		t.Fatalf("unexpected bext chunk %+v", b)
+	}
+	if x := d.Metadata.IXML; x == nil || x.Project != "proj" || x.Scene != "1A" || x.Take != "3" || x.Rate() != TimecodeRate2997DF {
+		t.Fatalf("unexpected iXML chunk %+v", x)
+	}
+
+	// bext chunk found before the fmt chunk
+	f, err := os.Open("fixtures/bwf.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d = NewDecoder(f)
+	if tc, err := d.StartTimecode(TimecodeRate25); err != nil || tc.String() != "00:00:00:00" {
+		t.Fatalf("unexpected start timecode %s (%v)", tc, err)
+	}
+	if b := d.Metadata.BroadcastExtension; b.Originator != "Logic Pro" || b.Version != 1 {
+		t.Fatalf("unexpected bext chunk %+v", b)
+	}
+}
+
+func TestMetadataJSON(t *testing.T) {
+	f, err := os.Open("fixtures/flloop.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	b, err := d.MetadataJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		SamplerInfo struct {
+			Manufacturer string
+			Loops        []map[string]interface{}
+		}
+		CuePoints []map[string]interface{}
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	// 16 bit stereo
+	if loop := out.SamplerInfo.Loops[0]; loop["CuePointID"] != "131072" || loop["End"] != 107999.0 || loop["EndByte"] != 431996.0 {
+		t.Fatalf("unexpected loop %v", loop)
+	}
+	if cue := out.CuePoints[0]; cue["ID"] != "1" || cue["DataChunkID"] != "data" {
+		t.Fatalf("unexpected cue point %v", cue)
+	}
+
+	var m Metadata
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&m, d.Metadata) {
+		t.Fatalf("expected %+v, got %+v", d.Metadata, &m)
+	}
+	// the metadata can be written back
+	out2 := &seekableBuffer{}
+	e := NewEncoder(out2, 44100, 16, 2, 1)
+	e.Metadata = &m
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d2 := NewDecoder(bytes.NewReader(out2.Bytes()))
+	d2.ReadMetadata()
+	if err := d2.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d2.Metadata.SamplerInfo, d.Metadata.SamplerInfo) || !reflect.DeepEqual(d2.Metadata.CuePoints, d.Metadata.CuePoints) {
+		t.Fatalf("unexpected written metadata %+v", d2.Metadata)
+	}
+}
@@ -0,0 +1,264 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// decodeInts converts the little endian PCM samples of src into dst and
+// returns the number of decoded samples, a trailing partial sample being
+// ignored. 8 bit samples are kept unsigned.
+func decodeInts(dst []int, src []byte, bitDepth int) (int, error) {
+	switch bitDepth {
+	case 8:
+		n := len(src)
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i, b := range src[:n] {
+			dst[i] = int(b)
+		}
+		return n, nil
+	case 16:
+		n := len(src) / 2
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			dst[i] = int(int16(binary.LittleEndian.Uint16(src[2*i:])))
+		}
+		return n, nil
+	case 24:
+		n := len(src) / 3
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			s := src[3*i : 3*i+3]
+			// the sign is extended by the arithmetic shift
+			dst[i] = int(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24) >> 8)
+		}
+		return n, nil
+	case 32:
+		n := len(src) / 4
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			dst[i] = int(int32(binary.LittleEndian.Uint32(src[4*i:])))
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unhandled byte depth:%d", bitDepth)
+	}
+}
+
+// decodeFloat32s converts the little endian PCM samples of src into dst and
+// returns the number of decoded samples, a trailing partial sample being
+// ignored. Integer samples are scaled to the [-1, 1] range while IEEE float
+// samples are kept as is.
+func decodeFloat32s(dst []float32, src []byte, bitDepth int, float bool) (int, error) {
+	if float {
+		switch bitDepth {
+		case 32:
+			n := len(src) / 4
+			if n > len(dst) {
+				n = len(dst)
+			}
+			for i := range dst[:n] {
+				dst[i] = math.Float32frombits(binary.LittleEndian.Uint32(src[4*i:]))
+			}
+			return n, nil
+		case 64:
+			n := len(src) / 8
+			if n > len(dst) {
+				n = len(dst)
+			}
+			for i := range dst[:n] {
+				dst[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(src[8*i:])))
+			}
+			return n, nil
+		default:
+			return 0, fmt.Errorf("unhandled float byte depth:%d", bitDepth)
+		}
+	}
+	switch bitDepth {
+	case 8:
+		n := len(src)
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i, b := range src[:n] {
+			dst[i] = float32(int(b)-128) / 0x80
+		}
+		return n, nil
+	case 16:
+		n := len(src) / 2
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			dst[i] = float32(int16(binary.LittleEndian.Uint16(src[2*i:]))) / 0x8000
+		}
+		return n, nil
+	case 24:
+		n := len(src) / 3
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			s := src[3*i : 3*i+3]
+			dst[i] = float32(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8) / 0x800000
+		}
+		return n, nil
+	case 32:
+		n := len(src) / 4
+		if n > len(dst) {
+			n = len(dst)
+		}
+		for i := range dst[:n] {
+			dst[i] = float32(float64(int32(binary.LittleEndian.Uint32(src[4*i:]))) / 0x80000000)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unhandled byte depth:%d", bitDepth)
+	}
+}
+
+// readPCM reads up to size bytes of PCM data into the buffer reused across
+// calls, the returned slice being only valid until the next call.
+func (d *Decoder) readPCM(size int) ([]byte, error) {
+	if cap(d.pcmBuf) < size {
+		d.pcmBuf = make([]byte, size)
+	}
+	buf := d.pcmBuf[:size]
+	var m int
+	for m < size {
+		n, err := d.PCMChunk.R.Read(buf[m:])
+		m += n
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return buf[:m], err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return buf[:m], nil
+}
+
+// encodeInts appends the little endian PCM encoding of the samples of src
+// to dst. 8 bit samples are expected to be unsigned.
+func encodeInts(dst []byte, src []int, bitDepth int) ([]byte, error) {
+	bPerSample := bytesPerSample(bitDepth)
+	start := len(dst)
+	dst = growBytes(dst, len(src)*bPerSample)
+	b := dst[start:]
+	switch bitDepth {
+	case 8:
+		for i, v := range src {
+			b[i] = uint8(v)
+		}
+	case 16:
+		for i, v := range src {
+			binary.LittleEndian.PutUint16(b[2*i:], uint16(v))
+		}
+	case 24:
+		for i, v := range src {
+			b[3*i] = byte(v)
+			b[3*i+1] = byte(v >> 8)
+			b[3*i+2] = byte(v >> 16)
+		}
+	case 32:
+		for i, v := range src {
+			binary.LittleEndian.PutUint32(b[4*i:], uint32(v))
+		}
+	default:
+		return dst[:start], fmt.Errorf("can't add frames of bit size %d", bitDepth)
+	}
+	return dst, nil
+}
+
+// encodeFloat64s appends the little endian encoding of the samples of src
+// to dst. IEEE float samples are written as is while the integer samples are
+// scaled from the [-1, 1] range and clipped.
+func encodeFloat64s(dst []byte, src []float64, bitDepth int, float bool) ([]byte, error) {
+	bPerSample := bytesPerSample(bitDepth)
+	start := len(dst)
+	dst = growBytes(dst, len(src)*bPerSample)
+	b := dst[start:]
+	if float {
+		switch bitDepth {
+		case 32:
+			for i, v := range src {
+				binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(float32(v)))
+			}
+		case 64:
+			for i, v := range src {
+				binary.LittleEndian.PutUint64(b[8*i:], math.Float64bits(v))
+			}
+		default:
+			return dst[:start], fmt.Errorf("can't add float frames of bit size %d", bitDepth)
+		}
+		return dst, nil
+	}
+	switch bitDepth {
+	case 8:
+		for i, v := range src {
+			b[i] = uint8(floatToInt(v, 8) + 128)
+		}
+	case 16:
+		for i, v := range src {
+			binary.LittleEndian.PutUint16(b[2*i:], uint16(floatToInt(v, 16)))
+		}
+	case 24:
+		for i, v := range src {
+			s := floatToInt(v, 24)
+			b[3*i] = byte(s)
+			b[3*i+1] = byte(s >> 8)
+			b[3*i+2] = byte(s >> 16)
+		}
+	case 32:
+		for i, v := range src {
+			binary.LittleEndian.PutUint32(b[4*i:], uint32(floatToInt(v, 32)))
+		}
+	default:
+		return dst[:start], fmt.Errorf("can't add frames of bit size %d", bitDepth)
+	}
+	return dst, nil
+}
+
+// floatToInt scales a sample of the [-1, 1] range to a signed integer of
+// the passed bit depth, clipping the values out of range.
+func floatToInt(v float64, bitDepth int) int32 {
+	max := float64(int64(1) << uint(bitDepth-1))
+	s := v * max
+	switch {
+	case s >= max-0.5:
+		return int32(max - 1)
+	case s <= -max:
+		return int32(-max)
+	case s >= 0:
+		// rounded half away from zero as math.Round
+		return int32(s + 0.5)
+	case s < 0:
+		return int32(s - 0.5)
+	}
+	// NaN
+	return 0
+}
+
+// growBytes extends b by n bytes, reusing its capacity when possible.
+func growBytes(b []byte, n int) []byte {
+	if len(b)+n <= cap(b) {
+		return b[:len(b)+n]
+	}
+	grown := make([]byte, len(b)+n, 2*len(b)+n)
+	copy(grown, b)
+	return grown
+}
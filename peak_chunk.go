@@ -0,0 +1,134 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// PEAK chunk is documented here:
+// https://web.archive.org/web/20081201144551/http://music.calarts.edu/~tre/PeakChunk.html
+
+// Peak is the content of the PEAK chunk written by Apple Logic and several
+// sample editors. It contains the maximum absolute amplitude of each channel
+// and the position of the frame containing it.
+//
+// To have the encoder generate a PEAK chunk, set Encoder.Peak to a non nil
+// value before writing any data, its fields are computed as frames are
+// written.
+type Peak struct {
+	// Version of the PEAK chunk, currently 1.
+	Version uint32
+	// Timestamp is the time the peaks were computed in seconds since
+	// 1970-01-01 (UTC).
+	Timestamp uint32
+	// Channels contains the peak of each channel.
+	Channels []ChannelPeak
+}
+
+// ChannelPeak is the peak of a channel.
+type ChannelPeak struct {
+	// Value is the absolute peak amplitude normalized between 0 and 1.
+	Value float32
+	// Position is the frame containing the peak.
+	Position uint32
+}
+
+// Time returns the timestamp of the peaks.
+func (p *Peak) Time() time.Time {
+	return time.Unix(int64(p.Timestamp), 0).UTC()
+}
+
+// DecodePeakChunk decodes a PEAK chunk and puts the data in
+// Decoder.Metadata.Peak.
+func DecodePeakChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDPeak {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the PEAK chunk - %w", err)
+		}
+		r := bytes.NewReader(buf)
+		p := &Peak{}
+		if err := binary.Read(r, binary.LittleEndian, &p.Version); err != nil {
+			return fmt.Errorf("failed to read the PEAK version - %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &p.Timestamp); err != nil {
+			return fmt.Errorf("failed to read the PEAK timestamp - %w", err)
+		}
+		// the chunk might be padded
+		for r.Len() >= 8 {
+			var cp ChannelPeak
+			if err := binary.Read(r, binary.LittleEndian, &cp); err != nil {
+				return fmt.Errorf("failed to read the channel peak - %w", err)
+			}
+			p.Channels = append(p.Channels, cp)
+		}
+		if d.NumChans > 0 && len(p.Channels) > int(d.NumChans) {
+			p.Channels = p.Channels[:d.NumChans]
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.Peak = p
+	}
+	ch.Drain()
+	return nil
+}
+
+// encodePeakChunk returns the content of the PEAK chunk.
+func encodePeakChunk(p *Peak) []byte {
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, p.Version)
+	binary.Write(buf, binary.LittleEndian, p.Timestamp)
+	binary.Write(buf, binary.LittleEndian, p.Channels)
+	return buf.Bytes()
+}
+
+// peakWriter tracks the peak of each channel from the interleaved samples
+// passed to add.
+type peakWriter struct {
+	peak  *Peak
+	ch    int
+	frame int
+}
+
+// newPeakWriter returns a writer tracking the peaks of numChans channels in
+// the passed PEAK chunk.
+func newPeakWriter(p *Peak, numChans int) (*peakWriter, error) {
+	if numChans < 1 {
+		return nil, fmt.Errorf("can't track the peaks of %d channels", numChans)
+	}
+	p.Version = 1
+	p.Channels = make([]ChannelPeak, numChans)
+	return &peakWriter{peak: p}, nil
+}
+
+// add adds a sample normalized between -1 and 1.
+func (w *peakWriter) add(v float64) {
+	if v := float32(math.Abs(v)); v > w.peak.Channels[w.ch].Value {
+		w.peak.Channels[w.ch] = ChannelPeak{Value: v, Position: uint32(w.frame)}
+	}
+	w.ch++
+	if w.ch == len(w.peak.Channels) {
+		w.ch = 0
+		w.frame++
+	}
+}
+
+// close timestamps the peaks.
+func (w *peakWriter) close(now time.Time) {
+	w.peak.Timestamp = uint32(now.Unix())
+}
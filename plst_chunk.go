@@ -0,0 +1,208 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/riff"
+)
+
+// PlaySegment is an entry of the play list (plst) chunk. The play list
+// defines the order in which the segments of the file, identified by their
+// cue point, are played.
+type PlaySegment struct {
+	// CueID is the ID of the cue point marking the start of the segment.
+	CueID [4]byte
+	// Length is the number of frames of the segment.
+	Length uint32
+	// Loops is the number of times the segment is played.
+	Loops uint32
+}
+
+// DecodePlayListChunk decodes a plst chunk and puts the segments in
+// Decoder.Metadata.PlayList.
+func DecodePlayListChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDPlst {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the plst chunk - %w", err)
+		}
+		r := bytes.NewReader(buf)
+		var nbrSegments uint32
+		if err := binary.Read(r, binary.LittleEndian, &nbrSegments); err != nil {
+			return fmt.Errorf("failed to read the number of play segments - %w", err)
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.PlayList = nil
+		for i := uint32(0); i < nbrSegments; i++ {
+			s := &PlaySegment{}
+			if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+				return fmt.Errorf("failed to read the play segment %d - %w", i, err)
+			}
+			d.Metadata.PlayList = append(d.Metadata.PlayList, s)
+		}
+	}
+	ch.Drain()
+	return nil
+}
+
+// PlayListReader reads the PCM data of a file in play list order, silence
+// being inserted for the segments pointing to a slnt chunk. Segments with a
+// loop count of 0 aren't played. Files without play list are read as is.
+type PlayListReader struct {
+	d        *Decoder
+	segments []*PlaySegment
+	cues     map[[4]byte]*CuePoint
+	// seg is the index of the current segment, loop the current iteration
+	// of the segment.
+	seg, loop int
+	// remaining is the number of frames left in the current iteration.
+	remaining int
+	silent    bool
+}
+
+// NewPlayListReader returns a reader rendering the PCM data of the decoder
+// using its play list. The metadata of the decoder is read if needed.
+func NewPlayListReader(d *Decoder) (*PlayListReader, error) {
+	if d == nil {
+		return nil, errors.New("nil decoder")
+	}
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+	// the metadata was read past the PCM data
+	if err := d.Rewind(); err != nil {
+		return nil, err
+	}
+	r := &PlayListReader{d: d, seg: -1, cues: map[[4]byte]*CuePoint{}}
+	if d.Metadata != nil {
+		r.segments = d.Metadata.PlayList
+		for _, c := range d.Metadata.CuePoints {
+			r.cues[c.ID] = c
+		}
+	}
+	if len(r.segments) == 0 {
+		numFrames, err := d.NumFrames()
+		if err != nil {
+			return nil, err
+		}
+		r.segments = []*PlaySegment{{Length: uint32(numFrames), Loops: 1}}
+		r.cues = nil
+	}
+	return r, nil
+}
+
+// Format returns the audio format of the rendered content.
+func (r *PlayListReader) Format() *audio.Format {
+	return r.d.Format()
+}
+
+// PCMBuffer populates the passed buffer with the next frames of the play list
+// and returns the number of samples written, 0 once the play list is over.
+func (r *PlayListReader) PCMBuffer(buf *audio.IntBuffer) (n int, err error) {
+	if buf == nil {
+		return 0, nil
+	}
+	numChans := r.d.outChans()
+	if numChans == 0 {
+		return 0, errors.New("unknown number of channels")
+	}
+	buf.Format = r.Format()
+	buf.SourceBitDepth = int(r.d.BitDepth)
+	for n+numChans <= len(buf.Data) {
+		if r.remaining == 0 {
+			if err = r.next(); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				return n, err
+			}
+			continue
+		}
+		frames := (len(buf.Data) - n) / numChans
+		if frames > r.remaining {
+			frames = r.remaining
+		}
+		data := buf.Data[n : n+frames*numChans]
+		if r.silent {
+			var silence int
+			if r.d.BitDepth == 8 {
+				// 8 bit samples are unsigned
+				silence = 128
+			}
+			for i := range data {
+				data[i] = silence
+			}
+		} else {
+			m, err := r.d.PCMBuffer(&audio.IntBuffer{Data: data})
+			if err != nil {
+				return n, err
+			}
+			if m < numChans {
+				// the segment goes past the PCM data
+				r.remaining = 0
+				continue
+			}
+			frames = m / numChans
+		}
+		n += frames * numChans
+		r.remaining -= frames
+	}
+	return n, nil
+}
+
+// next moves to the next iteration of the play list, io.EOF is returned once
+// all the segments were played.
+func (r *PlayListReader) next() error {
+	if r.seg >= len(r.segments) {
+		return io.EOF
+	}
+	if r.seg >= 0 && r.loop+1 < int(r.segments[r.seg].Loops) {
+		r.loop++
+	} else {
+		r.seg++
+		r.loop = 0
+		for r.seg < len(r.segments) && r.segments[r.seg].Loops == 0 {
+			r.seg++
+		}
+	}
+	if r.seg >= len(r.segments) {
+		return io.EOF
+	}
+	s := r.segments[r.seg]
+	r.remaining = int(s.Length)
+	r.silent = false
+	if r.cues == nil {
+		// no play list, read all the PCM data
+		return r.d.seekFrame(0)
+	}
+	c, ok := r.cues[s.CueID]
+	if !ok {
+		return fmt.Errorf("cue point %q of the play list not found", s.CueID[:])
+	}
+	if c.DataChunkID == CIDSlnt && r.d.waveList == nil {
+		// the slnt chunks of wave lists are part of the PCM stream
+		r.silent = true
+		return nil
+	}
+	frame, err := r.d.CuePointFrame(c)
+	if err != nil {
+		return err
+	}
+	return r.d.seekFrame(frame)
+}
@@ -0,0 +1,424 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// ResampleQuality selects the length and window of the windowed-sinc filter
+// used to convert sample rates, higher qualities being slower.
+type ResampleQuality int
+
+const (
+	// ResampleDefault is ResampleMedium.
+	ResampleDefault ResampleQuality = iota
+	// ResampleLow uses 8 zero crossings, enough for previews.
+	ResampleLow
+	// ResampleMedium uses 16 zero crossings.
+	ResampleMedium
+	// ResampleHigh uses 32 zero crossings with a narrow transition band.
+	ResampleHigh
+)
+
+// params returns the number of zero crossings on each side of the filter,
+// the Kaiser window beta and the cutoff frequency relative to the Nyquist
+// frequency.
+func (q ResampleQuality) params() (zeroCrossings int, beta, rolloff float64) {
+	switch q {
+	case ResampleLow:
+		return 8, 6, 0.9
+	case ResampleHigh:
+		return 32, 10, 0.97
+	default:
+		return 16, 8.5, 0.945
+	}
+}
+
+// String implements the Stringer interface.
+func (q ResampleQuality) String() string {
+	switch q {
+	case ResampleDefault:
+		return "default"
+	case ResampleLow:
+		return "low"
+	case ResampleMedium:
+		return "medium"
+	case ResampleHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// resampleTableRes is the number of filter values computed per zero
+// crossing, the values in between being interpolated.
+const resampleTableRes = 512
+
+// resampler converts the sample rate of interleaved float samples using a
+// windowed-sinc interpolation.
+type resampler struct {
+	inRate, outRate int64
+	numChans        int
+	// cutoff is the cutoff frequency relative to the input Nyquist frequency
+	// and halfWidth the number of input frames used on each side of an
+	// output frame.
+	cutoff    float64
+	halfWidth int64
+	table     []float64
+	weights   []float64
+	// in contains the buffered input frames, base being the index of the
+	// first one in the input stream, and next is the index of the next
+	// output frame.
+	in   []float64
+	base int64
+	next int64
+	// inFrames is the number of frames written and end the number of output
+	// frames once flushed, -1 before.
+	inFrames int64
+	end      int64
+}
+
+func newResampler(inRate, outRate, numChans int, quality ResampleQuality) *resampler {
+	zeroCrossings, beta, rolloff := quality.params()
+	cutoff := rolloff
+	switch {
+	case outRate == inRate:
+		// the filter only keeps the input samples
+		cutoff = 1
+	case outRate < inRate:
+		// the input is filtered under the output Nyquist frequency
+		cutoff *= float64(outRate) / float64(inRate)
+	}
+	r := &resampler{
+		inRate:    int64(inRate),
+		outRate:   int64(outRate),
+		numChans:  numChans,
+		cutoff:    cutoff,
+		halfWidth: int64(math.Ceil(float64(zeroCrossings) / cutoff)),
+		table:     make([]float64, zeroCrossings*resampleTableRes+2),
+		end:       -1,
+	}
+	i0Beta := besselI0(beta)
+	for i := range r.table {
+		x := float64(i) / resampleTableRes
+		u := x / float64(zeroCrossings)
+		if u >= 1 {
+			continue
+		}
+		r.table[i] = sinc(x) * besselI0(beta*math.Sqrt(1-u*u)) / i0Beta
+	}
+	r.weights = make([]float64, 2*r.halfWidth)
+	// the stream is preceded by silence so the first frames can be
+	// interpolated
+	r.in = make([]float64, int(r.halfWidth)*numChans)
+	r.base = -r.halfWidth
+	return r
+}
+
+// sinc is the normalized sinc function.
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+// kernel returns the filter value at the passed distance in zero crossings.
+func (r *resampler) kernel(d float64) float64 {
+	p := d * resampleTableRes
+	i := int(p)
+	if i >= len(r.table)-1 {
+		return 0
+	}
+	f := p - float64(i)
+	return r.table[i] + f*(r.table[i+1]-r.table[i])
+}
+
+// write buffers interleaved input samples.
+func (r *resampler) write(src []float64) {
+	r.in = append(r.in, src...)
+	r.inFrames += int64(len(src) / r.numChans)
+}
+
+// flush marks the end of the input, the remaining frames being interpolated
+// against silence.
+func (r *resampler) flush() {
+	if r.end >= 0 {
+		return
+	}
+	r.end = (r.inFrames*r.outRate + r.inRate - 1) / r.inRate
+	r.in = append(r.in, make([]float64, int(r.halfWidth+1)*r.numChans)...)
+}
+
+// read fills dst with the interleaved output frames that can be computed from
+// the buffered input and returns the number of samples written.
+func (r *resampler) read(dst []float64) int {
+	nc := r.numChans
+	buffered := r.base + int64(len(r.in)/nc)
+	var n int
+	for n+nc <= len(dst) {
+		if r.end >= 0 && r.next >= r.end {
+			break
+		}
+		// position of the output frame in the input stream
+		num := r.next * r.inRate
+		ti := num / r.outRate
+		frac := float64(num%r.outRate) / float64(r.outRate)
+		first := ti - r.halfWidth + 1
+		if ti+r.halfWidth >= buffered {
+			break
+		}
+		for k := range r.weights {
+			d := math.Abs(float64(int64(k)-r.halfWidth+1)-frac) * r.cutoff
+			r.weights[k] = r.kernel(d) * r.cutoff
+		}
+		in := r.in[int(first-r.base)*nc:]
+		for ch := 0; ch < nc; ch++ {
+			var sum float64
+			for k, w := range r.weights {
+				sum += in[k*nc+ch] * w
+			}
+			dst[n+ch] = sum
+		}
+		n += nc
+		r.next++
+	}
+	// the frames which won't be used anymore are dropped
+	keep := r.next*r.inRate/r.outRate - r.halfWidth + 1
+	if drop := int(keep - r.base); drop > 0 && drop*nc*2 > len(r.in) {
+		r.in = r.in[:copy(r.in, r.in[drop*nc:])]
+		r.base = keep
+	}
+	return n
+}
+
+// ResampleReader renders the PCM data of a decoder at another sample rate.
+type ResampleReader struct {
+	d          *Decoder
+	sampleRate int
+	r          *resampler
+	// in and floats are reused to read the decoder and convert the output,
+	// inScratch and outScratch to feed and read the resampler.
+	in         *audio.Float32Buffer
+	floats     *audio.Float32Buffer
+	inScratch  []float64
+	outScratch []float64
+	eof        bool
+}
+
+// NewResampleReader returns a reader converting the PCM data of the decoder
+// to the passed sample rate.
+func NewResampleReader(d *Decoder, sampleRate int, quality ResampleQuality) (*ResampleReader, error) {
+	if d == nil {
+		return nil, errors.New("nil decoder")
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	if !d.WasPCMAccessed() {
+		if err := d.FwdToPCM(); err != nil {
+			return nil, err
+		}
+	}
+	if d.PCMChunk == nil {
+		return nil, ErrPCMChunkNotFound
+	}
+	numChans := d.outChans()
+	if numChans == 0 || d.SampleRate == 0 {
+		return nil, fmt.Errorf("can't resample %d channels at %d Hz", numChans, d.SampleRate)
+	}
+	return &ResampleReader{
+		d:          d,
+		sampleRate: sampleRate,
+		r:          newResampler(int(d.SampleRate), sampleRate, numChans, quality),
+		in:         &audio.Float32Buffer{Data: make([]float32, 4096/numChans*numChans)},
+	}, nil
+}
+
+// Format returns the audio format of the rendered content.
+func (r *ResampleReader) Format() *audio.Format {
+	return &audio.Format{NumChannels: r.d.outChans(), SampleRate: r.sampleRate}
+}
+
+// PCMFloat32Buffer populates the passed buffer with the next resampled
+// frames and returns the number of samples written, 0 once all the frames
+// were read. See Decoder.PCMFloat32Buffer for the scaling of the samples.
+func (r *ResampleReader) PCMFloat32Buffer(buf *audio.Float32Buffer) (n int, err error) {
+	if buf == nil {
+		return 0, nil
+	}
+	if f := buf.Format; f == nil || f.NumChannels != r.d.outChans() || f.SampleRate != r.sampleRate {
+		buf.Format = r.Format()
+	}
+	buf.SourceBitDepth = int(r.d.BitDepth)
+	nc := r.r.numChans
+	for n+nc <= len(buf.Data) {
+		want := (len(buf.Data) - n) / nc * nc
+		if cap(r.outScratch) < want {
+			r.outScratch = make([]float64, want)
+		}
+		m := r.r.read(r.outScratch[:want])
+		for i, v := range r.outScratch[:m] {
+			buf.Data[n+i] = float32(v)
+		}
+		n += m
+		if m > 0 {
+			continue
+		}
+		if r.eof {
+			break
+		}
+		if err := r.fill(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// PCMBuffer populates the passed buffer with the next resampled frames using
+// the integer representation of Decoder.PCMBuffer, and returns the number of
+// samples written. IEEE float files must be read with PCMFloat32Buffer.
+func (r *ResampleReader) PCMBuffer(buf *audio.IntBuffer) (n int, err error) {
+	if buf == nil {
+		return 0, nil
+	}
+	bitDepth := int(r.d.BitDepth)
+	if r.d.WavAudioFormat == wavFormatIEEEFloat || bitDepth < 8 || bitDepth > 32 {
+		return 0, fmt.Errorf("can't resample %d bit samples of format %d to integers", bitDepth, r.d.WavAudioFormat)
+	}
+	if r.floats == nil {
+		r.floats = &audio.Float32Buffer{}
+	}
+	floats := r.floats
+	if cap(floats.Data) < len(buf.Data) {
+		floats.Data = make([]float32, len(buf.Data))
+	}
+	floats.Data = floats.Data[:len(buf.Data)]
+	floats.Format = buf.Format
+	n, err = r.PCMFloat32Buffer(floats)
+	buf.Format = floats.Format
+	buf.SourceBitDepth = bitDepth
+	for i, v := range floats.Data[:n] {
+		s := int(floatToInt(float64(v), bitDepth))
+		if bitDepth == 8 {
+			// 8 bit samples are unsigned
+			s += 128
+		}
+		buf.Data[i] = s
+	}
+	return n, err
+}
+
+// fill passes the next frames of the decoder to the resampler.
+func (r *ResampleReader) fill() error {
+	m, err := r.d.PCMFloat32Buffer(r.in)
+	if err != nil {
+		return err
+	}
+	m = m / r.r.numChans * r.r.numChans
+	if m == 0 {
+		r.eof = true
+		r.r.flush()
+		return nil
+	}
+	if cap(r.inScratch) < m {
+		r.inScratch = make([]float64, m)
+	}
+	src := r.inScratch[:m]
+	for i, v := range r.in.Data[:m] {
+		src[i] = float64(v)
+	}
+	r.r.write(src)
+	return nil
+}
+
+// resampling returns positively if the buffers of the passed format must be
+// resampled.
+func (e *Encoder) resampling(format *audio.Format) bool {
+	return e.Resample && format != nil && format.SampleRate > 0 && format.SampleRate != e.SampleRate
+}
+
+// floatScratch returns a float slice of the passed size reused across calls.
+func (e *Encoder) floatScratch(size int) []float64 {
+	if cap(e.floatBuf) < size {
+		e.floatBuf = make([]float64, size)
+	}
+	return e.floatBuf[:size]
+}
+
+// addResampledBuffer scales the samples of the buffer to floats and resamples
+// them.
+func (e *Encoder) addResampledBuffer(buf *audio.IntBuffer) error {
+	bitDepth := buf.SourceBitDepth
+	if bitDepth == 0 {
+		bitDepth = e.BitDepth
+	}
+	if bitDepth < 8 || bitDepth > 32 {
+		return fmt.Errorf("can't resample %d bit samples", bitDepth)
+	}
+	scale := float64(int64(1) << uint(bitDepth-1))
+	src := e.floatScratch(len(buf.Data))
+	for i, v := range buf.Data {
+		// 8 bit samples are unsigned
+		if bitDepth == 8 {
+			v -= 128
+		}
+		src[i] = float64(v) / scale
+	}
+	return e.resample(src, buf.Format.NumChannels, buf.Format.SampleRate)
+}
+
+// resample passes the samples to the resampler and writes the frames it
+// returns.
+func (e *Encoder) resample(src []float64, numChans, sampleRate int) error {
+	if numChans < 1 {
+		return fmt.Errorf("can't resample %d channels", numChans)
+	}
+	if e.resampler == nil {
+		e.resampler = newResampler(sampleRate, e.SampleRate, numChans, e.ResampleQuality)
+		e.resampleRate = sampleRate
+	} else if sampleRate != e.resampleRate || numChans != e.resampler.numChans {
+		return fmt.Errorf("can't resample a buffer of %d channels at %d Hz after buffers of %d channels at %d Hz",
+			numChans, sampleRate, e.resampler.numChans, e.resampleRate)
+	}
+	e.resampler.write(src[:len(src)/numChans*numChans])
+	return e.drainResampler()
+}
+
+// drainResampler writes the frames available from the resampler.
+func (e *Encoder) drainResampler() error {
+	nc := e.resampler.numChans
+	size := blockSizeFor(nc)
+	if cap(e.resampleOut) < size {
+		e.resampleOut = make([]float64, size)
+	}
+	for {
+		n := e.resampler.read(e.resampleOut[:size])
+		if n == 0 {
+			return nil
+		}
+		if e.stream && e.streamFrames >= 0 && e.frames+n/nc > e.streamFrames {
+			return fmt.Errorf("can't write more than the %d frames announced to the stream", e.streamFrames)
+		}
+		if err := e.encodeFloats(e.resampleOut[:n], nc); err != nil {
+			return err
+		}
+		if err := e.writePCM(e.pcmBuf); err != nil {
+			return err
+		}
+		e.frames += n / nc
+	}
+}
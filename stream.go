@@ -0,0 +1,254 @@
+package wav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// unknownSize is the chunk size written by streaming writers which don't
+// know the size of the content up front.
+const unknownSize = 0xFFFFFFFF
+
+// streamLookback is the number of bytes kept to allow small backward seeks
+// once the headers were read.
+const streamLookback = 64
+
+// ErrNotSeekable is returned when a streaming decoder would need to move
+// backward in its reader, for instance to rewind.
+var ErrNotSeekable = errors.New("can't seek backward in a stream")
+
+// streamReader gives a forward only io.Reader the io.ReadSeeker interface
+// needed by the decoder. Forward seeks discard data and backward seeks are
+// served from the bytes kept in memory.
+type streamReader struct {
+	r io.Reader
+	// pos is the position in the stream.
+	pos int64
+	// buf contains the bytes kept in memory, starting at the bufStart
+	// position.
+	buf      []byte
+	bufStart int64
+	// keep is true when all the bytes read must be kept in memory, otherwise
+	// only the last streamLookback bytes are kept.
+	keep bool
+}
+
+// NewStreamDecoder creates a decoder reading a wav stream from a reader which
+// can't seek, such as stdin, a pipe or a socket. The chunks found before the
+// fmt chunk are buffered in memory and the PCM data is read sequentially.
+// Data chunks with an unknown size (0 or 0xFFFFFFFF) are read until the end
+// of the stream.
+// Operations moving backward in the file, such as Rewind or VerifyChecksum,
+// return ErrNotSeekable and ReadMetadata skips the rest of the PCM data.
+func NewStreamDecoder(r io.Reader) *Decoder {
+	sr := &streamReader{r: r}
+	return &Decoder{
+		r:      sr,
+		parser: riff.New(sr),
+	}
+}
+
+// Read implements the io.Reader interface.
+func (s *streamReader) Read(p []byte) (int, error) {
+	if end := s.bufStart + int64(len(s.buf)); s.pos < end {
+		n := copy(p, s.buf[s.pos-s.bufStart:])
+		s.pos += int64(n)
+		return n, nil
+	}
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	s.buf = append(s.buf, p[:n]...)
+	if !s.keep && len(s.buf) > streamLookback {
+		drop := len(s.buf) - streamLookback
+		s.buf = append(s.buf[:0], s.buf[drop:]...)
+		s.bufStart += int64(drop)
+	}
+	return n, err
+}
+
+// Seek implements the io.Seeker interface, seeking relatively to the end of
+// the stream isn't supported.
+func (s *streamReader) Seek(offset int64, whence int) (int64, error) {
+	target := offset
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		target += s.pos
+	default:
+		return s.pos, ErrNotSeekable
+	}
+	if target < s.bufStart {
+		return s.pos, ErrNotSeekable
+	}
+	if end := s.bufStart + int64(len(s.buf)); target <= end {
+		s.pos = target
+		return s.pos, nil
+	}
+	s.pos = s.bufStart + int64(len(s.buf))
+	if _, err := io.CopyN(io.Discard, s, target-s.pos); err != nil {
+		return s.pos, fmt.Errorf("failed to skip %d bytes - %w", target-s.pos, err)
+	}
+	return s.pos, nil
+}
+
+// stream returns the reader of streaming decoders, nil for other decoders.
+func (d *Decoder) stream() *streamReader {
+	s, _ := d.r.(*streamReader)
+	return s
+}
+
+// isUnknownSize returns positively if the passed data chunk size is a
+// placeholder written by a streaming writer.
+func (d *Decoder) isUnknownSize(size uint32) bool {
+	return size == unknownSize || (size == 0 && d.stream() != nil)
+}
+
+// unknownSizeDataChunk returns the data chunk of a file whose data size
+// wasn't set by the writer, the data going until the end of the file. The
+// size of the data of streams is unknown and PCMSize is left to 0.
+func (d *Decoder) unknownSizeDataChunk() (*riff.Chunk, error) {
+	if d.stream() != nil {
+		return &riff.Chunk{ID: riff.DataFormatID, R: d.r}, nil
+	}
+	cur, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := d.r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = d.r.Seek(cur, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &riff.Chunk{
+		ID:   riff.DataFormatID,
+		Size: int(end - cur),
+		R:    io.LimitReader(d.r, end-cur),
+	}, nil
+}
+
+// UnknownFrames is passed to NewStreamEncoder when the number of frames to
+// write isn't known up front.
+const UnknownFrames = -1
+
+// streamWriter gives an io.Writer the io.WriteSeeker interface used by the
+// encoder, seeking isn't supported.
+type streamWriter struct {
+	io.Writer
+}
+
+// Seek implements the io.Seeker interface.
+func (streamWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, ErrNotSeekable
+}
+
+// NewStreamEncoder creates an encoder writing a wav file to a writer which
+// can't seek, such as stdout, a pipe or a HTTP response.
+//
+// When numFrames is known, the final sizes are written in the headers and
+// Close returns an error if a different number of frames was written. The
+// metadata, markers and regions must then be set before writing any data.
+// They are written after the PCM data as usual, along with the PEAK, levl
+// and MD5 chunks.
+//
+// When numFrames is UnknownFrames, the sizes are left to the 0xFFFFFFFF
+// placeholder and the PCM data goes until the end of the stream: the
+// encoder refuses to write any metadata, as well as non PCM formats which
+// need a fact chunk.
+func NewStreamEncoder(w io.Writer, sampleRate, bitDepth, numChans, audioFormat, numFrames int) *Encoder {
+	e := NewEncoder(streamWriter{w}, sampleRate, bitDepth, numChans, audioFormat)
+	e.stream = true
+	e.streamFrames = numFrames
+	return e
+}
+
+// streamDataSize returns the size of the announced PCM data, without the
+// padding byte.
+func (e *Encoder) streamDataSize() int {
+	return (e.BitDepth / 8) * e.NumChans * e.streamFrames
+}
+
+// streamRIFFSize renders the metadata of a stream and returns the size of
+// the RIFF chunk.
+func (e *Encoder) streamRIFFSize() (uint32, error) {
+	if e.streamFrames < 0 {
+		if e.WavAudioFormat != wavFormatPCM {
+			return 0, errors.New("the number of frames is needed to stream non PCM formats")
+		}
+		if e.Metadata != nil || e.hasCues() || e.Peak != nil || e.PeakEnvelope != nil || e.WriteMD5 {
+			return 0, errors.New("the number of frames is needed to stream metadata")
+		}
+		return unknownSize, nil
+	}
+
+	// the metadata is rendered now to know its size
+	if e.Metadata != nil || e.hasCues() {
+		w, written := e.w, e.WrittenBytes
+		buf := bytes.NewBuffer(nil)
+		e.w = streamWriter{buf}
+		err := e.writeMetadata()
+		e.w, e.WrittenBytes = w, written
+		if err != nil {
+			return 0, fmt.Errorf("failed to write metadata - %w", err)
+		}
+		e.streamMetadata = buf.Bytes()
+	}
+
+	// WAVE, fmt and data chunks
+	size := 4 + 8 + 16 + 8 + e.streamDataSize()
+	if e.WavAudioFormat != wavFormatPCM {
+		// cbSize and fact chunk
+		size += 2 + 12
+	}
+	size += e.streamDataSize() % 2
+	if e.WriteMD5 {
+		size += 8 + md5.Size
+	}
+	if e.Peak != nil {
+		// version, timestamp and a value and position per channel
+		size += 8 + 8 + 8*e.NumChans
+	}
+	if e.PeakEnvelope != nil {
+		w, err := newPeakEnvelopeWriter(e.PeakEnvelope, e.NumChans)
+		if err != nil {
+			return 0, err
+		}
+		env := w.env
+		blocks := (e.streamFrames + int(env.BlockSize) - 1) / int(env.BlockSize)
+		values := blocks * e.NumChans * int(env.PointsPerValue)
+		if env.Format != PeakEnvelopeFormat8 {
+			values *= 2
+		}
+		size += 8 + levlHeaderSize + values + values%2
+	}
+	size += len(e.streamMetadata)
+	if int64(size) > unknownSize {
+		return 0, fmt.Errorf("can't stream %d bytes in a RIFF file", size)
+	}
+	e.streamSize = size
+	return uint32(size), nil
+}
+
+// closeStream writes the metadata of a stream and verifies that the file
+// matches the announced sizes.
+func (e *Encoder) closeStream() error {
+	if err := e.AddBE(e.streamMetadata); err != nil {
+		return fmt.Errorf("failed to write metadata - %w", err)
+	}
+	if e.streamFrames < 0 {
+		return nil
+	}
+	if e.frames != e.streamFrames {
+		return fmt.Errorf("wrote %d frames to a stream announcing %d frames", e.frames, e.streamFrames)
+	}
+	if e.WrittenBytes-8 != e.streamSize {
+		return fmt.Errorf("wrote %d bytes to a stream announcing %d bytes", e.WrittenBytes-8, e.streamSize)
+	}
+	return nil
+}
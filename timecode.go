@@ -0,0 +1,309 @@
+package wav
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TimecodeRate is a SMPTE timecode frame rate.
+type TimecodeRate int
+
+const (
+	// TimecodeRateUnknown is used when the rate isn't known.
+	TimecodeRateUnknown TimecodeRate = iota
+	// TimecodeRate23976 is the 24000/1001 non drop frame rate used for film
+	// transferred to NTSC video.
+	TimecodeRate23976
+	// TimecodeRate24 is the 24 fps film rate.
+	TimecodeRate24
+	// TimecodeRate25 is the 25 fps PAL rate.
+	TimecodeRate25
+	// TimecodeRate2997DF is the 30000/1001 NTSC drop frame rate.
+	TimecodeRate2997DF
+	// TimecodeRate30 is the 30 fps non drop frame rate.
+	TimecodeRate30
+)
+
+// ratio returns the exact frame rate as a fraction.
+func (r TimecodeRate) ratio() (num, den int64) {
+	switch r {
+	case TimecodeRate23976:
+		return 24000, 1001
+	case TimecodeRate24:
+		return 24, 1
+	case TimecodeRate25:
+		return 25, 1
+	case TimecodeRate2997DF:
+		return 30000, 1001
+	case TimecodeRate30:
+		return 30, 1
+	default:
+		return 0, 1
+	}
+}
+
+// FPS returns the number of frames per second.
+func (r TimecodeRate) FPS() float64 {
+	num, den := r.ratio()
+	return float64(num) / float64(den)
+}
+
+// Nominal returns the number of timecode frames per second, 30 for 29.97 and
+// 24 for 23.976.
+func (r TimecodeRate) Nominal() int {
+	num, den := r.ratio()
+	return int(math.Round(float64(num) / float64(den)))
+}
+
+// DropFrame returns positively if the rate uses drop frame counting.
+func (r TimecodeRate) DropFrame() bool {
+	return r == TimecodeRate2997DF
+}
+
+// String implements the Stringer interface.
+func (r TimecodeRate) String() string {
+	switch r {
+	case TimecodeRate23976:
+		return "23.976"
+	case TimecodeRate24:
+		return "24"
+	case TimecodeRate25:
+		return "25"
+	case TimecodeRate2997DF:
+		return "29.97DF"
+	case TimecodeRate30:
+		return "30"
+	default:
+		return "unknown"
+	}
+}
+
+// Timecode is a SMPTE timecode.
+type Timecode struct {
+	Hours   int
+	Minutes int
+	Seconds int
+	Frames  int
+	Rate    TimecodeRate
+}
+
+// ParseTimecode parses a timecode formatted as hh:mm:ss:ff, a semicolon
+// being accepted before the frames of drop frame timecodes.
+func ParseTimecode(s string, rate TimecodeRate) (Timecode, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == ';' || r == '.' })
+	if len(fields) != 4 {
+		return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+	}
+	var v [4]int
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return Timecode{}, fmt.Errorf("invalid timecode %q", s)
+		}
+		v[i] = n
+	}
+	tc := Timecode{Hours: v[0], Minutes: v[1], Seconds: v[2], Frames: v[3], Rate: rate}
+	if err := tc.validate(); err != nil {
+		return Timecode{}, err
+	}
+	return tc, nil
+}
+
+func (tc Timecode) validate() error {
+	if tc.Rate == TimecodeRateUnknown {
+		return fmt.Errorf("unknown timecode rate")
+	}
+	if tc.Hours < 0 || tc.Hours > 23 || tc.Minutes < 0 || tc.Minutes > 59 ||
+		tc.Seconds < 0 || tc.Seconds > 59 || tc.Frames < 0 || tc.Frames >= tc.Rate.Nominal() {
+		return fmt.Errorf("invalid %s timecode %s", tc.Rate, tc)
+	}
+	if tc.Rate.DropFrame() && tc.Seconds == 0 && tc.Frames < 2 && tc.Minutes%10 != 0 {
+		return fmt.Errorf("dropped frame %s", tc)
+	}
+	return nil
+}
+
+// String implements the Stringer interface. Drop frame timecodes use a
+// semicolon before the frames.
+func (tc Timecode) String() string {
+	sep := ":"
+	if tc.Rate.DropFrame() {
+		sep = ";"
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d", tc.Hours, tc.Minutes, tc.Seconds, sep, tc.Frames)
+}
+
+// FrameCount returns the number of timecode frames since midnight.
+func (tc Timecode) FrameCount() int {
+	fps := tc.Rate.Nominal()
+	n := ((tc.Hours*60+tc.Minutes)*60+tc.Seconds)*fps + tc.Frames
+	if tc.Rate.DropFrame() {
+		// 2 frame numbers are dropped every minute, except every 10 minutes
+		totalMinutes := tc.Hours*60 + tc.Minutes
+		n -= 2 * (totalMinutes - totalMinutes/10)
+	}
+	return n
+}
+
+// TimecodeFromFrameCount returns the timecode of the passed number of frames
+// since midnight. Timecodes wrap around after 24 hours.
+func TimecodeFromFrameCount(n int, rate TimecodeRate) Timecode {
+	fps := rate.Nominal()
+	if fps == 0 {
+		return Timecode{Rate: rate}
+	}
+	if rate.DropFrame() {
+		// restore the dropped frame numbers
+		const framesPer10Minutes = 17982
+		const framesPerMinute = 1798
+		tens, rem := n/framesPer10Minutes, n%framesPer10Minutes
+		n += 18 * tens
+		if rem > 2 {
+			n += 2 * ((rem - 2) / framesPerMinute)
+		}
+	}
+	return Timecode{
+		Hours:   (n / (fps * 3600)) % 24,
+		Minutes: (n / (fps * 60)) % 60,
+		Seconds: (n / fps) % 60,
+		Frames:  n % fps,
+		Rate:    rate,
+	}
+}
+
+// Samples returns the number of samples since midnight at the passed sample
+// rate, rounded to the closest sample.
+func (tc Timecode) Samples(sampleRate int) uint64 {
+	num, den := tc.Rate.ratio()
+	if num == 0 {
+		return 0
+	}
+	return uint64(math.Round(float64(tc.FrameCount()) * float64(sampleRate) * float64(den) / float64(num)))
+}
+
+// TimecodeFromSamples returns the timecode of the frame containing the
+// passed sample, counted since midnight at the passed sample rate.
+func TimecodeFromSamples(samples uint64, sampleRate int, rate TimecodeRate) Timecode {
+	num, den := rate.ratio()
+	if num == 0 || sampleRate <= 0 {
+		return Timecode{Rate: rate}
+	}
+	// half a sample is added to compensate the rounding of Samples
+	frames := math.Floor((float64(samples) + 0.5) * float64(num) / (float64(sampleRate) * float64(den)))
+	return TimecodeFromFrameCount(int(frames), rate)
+}
+
+// timecodeRateFromSMPTEFormat returns the rate matching the SMPTE format of a
+// smpl chunk.
+func timecodeRateFromSMPTEFormat(format uint32) TimecodeRate {
+	switch format {
+	case 24:
+		return TimecodeRate24
+	case 25:
+		return TimecodeRate25
+	case 29:
+		return TimecodeRate2997DF
+	case 30:
+		return TimecodeRate30
+	default:
+		return TimecodeRateUnknown
+	}
+}
+
+// smpteFormat returns the SMPTE format of the smpl chunk matching the rate.
+func (r TimecodeRate) smpteFormat() uint32 {
+	switch r {
+	case TimecodeRate23976, TimecodeRate24:
+		return 24
+	case TimecodeRate25:
+		return 25
+	case TimecodeRate2997DF:
+		return 29
+	case TimecodeRate30:
+		return 30
+	default:
+		return 0
+	}
+}
+
+// Timecode returns the SMPTE offset of the sampler info as a timecode, ok
+// is false if no SMPTE format is set.
+func (s *SamplerInfo) Timecode() (tc Timecode, ok bool) {
+	if s == nil {
+		return tc, false
+	}
+	rate := timecodeRateFromSMPTEFormat(s.SMPTEFormat)
+	if rate == TimecodeRateUnknown {
+		return tc, false
+	}
+	return Timecode{
+		// the hours are signed
+		Hours:   int(int8(s.SMPTEOffset >> 24)),
+		Minutes: int(s.SMPTEOffset >> 16 & 0xFF),
+		Seconds: int(s.SMPTEOffset >> 8 & 0xFF),
+		Frames:  int(s.SMPTEOffset & 0xFF),
+		Rate:    rate,
+	}, true
+}
+
+// SetTimecode sets the SMPTE format and offset of the sampler info.
+func (s *SamplerInfo) SetTimecode(tc Timecode) {
+	s.SMPTEFormat = tc.Rate.smpteFormat()
+	s.SMPTEOffset = uint32(uint8(int8(tc.Hours)))<<24 | uint32(tc.Minutes&0xFF)<<16 |
+		uint32(tc.Seconds&0xFF)<<8 | uint32(tc.Frames&0xFF)
+}
+
+// TimeReference returns the position of the first sample of the file in
+// samples since midnight, using the file's sample rate. The position comes
+// from, by order of preference, the bext time reference, the iXML timestamp
+// and the smpl SMPTE offset. ErrTimecodeNotFound is returned if the file
+// doesn't define a position.
+func (d *Decoder) TimeReference() (uint64, error) {
+	if err := d.loadMetadata(); err != nil {
+		return 0, err
+	}
+	m := d.Metadata
+	if m == nil {
+		return 0, ErrTimecodeNotFound
+	}
+	if m.BroadcastExtension != nil {
+		return m.BroadcastExtension.TimeReference, nil
+	}
+	if x := m.IXML; x != nil && x.hasTimestamp {
+		samples := x.TimestampSamplesSinceMidnight
+		if x.TimestampSampleRate > 0 && x.TimestampSampleRate != d.SampleRate {
+			samples = uint64(math.Round(float64(samples) * float64(d.SampleRate) / float64(x.TimestampSampleRate)))
+		}
+		return samples, nil
+	}
+	if tc, ok := m.SamplerInfo.Timecode(); ok {
+		return tc.Samples(int(d.SampleRate)), nil
+	}
+	return 0, ErrTimecodeNotFound
+}
+
+// StartTimecode returns the timecode of the first sample of the file, see
+// TimeReference. The timecode rate is the one defined in the iXML or smpl
+// chunk, fallback being used if the file doesn't define one.
+func (d *Decoder) StartTimecode(fallback TimecodeRate) (Timecode, error) {
+	samples, err := d.TimeReference()
+	if err != nil {
+		return Timecode{}, err
+	}
+	rate := TimecodeRateUnknown
+	if d.Metadata.IXML != nil {
+		rate = d.Metadata.IXML.Rate()
+	}
+	if rate == TimecodeRateUnknown && d.Metadata.SamplerInfo != nil {
+		rate = timecodeRateFromSMPTEFormat(d.Metadata.SamplerInfo.SMPTEFormat)
+	}
+	if rate == TimecodeRateUnknown {
+		rate = fallback
+	}
+	if rate == TimecodeRateUnknown {
+		return Timecode{}, fmt.Errorf("unknown timecode rate")
+	}
+	return TimecodeFromSamples(samples, int(d.SampleRate), rate), nil
+}
@@ -0,0 +1,185 @@
+package wav
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UMIDs are documented in SMPTE ST 330 and their use in BWF files in EBU
+// Tech 3285 s1.
+
+// Material types of the UMID label.
+const (
+	// UMIDSingleAudio identifies a single audio component.
+	UMIDSingleAudio byte = 0x08
+	// UMIDMultipleAudio identifies two or more audio components.
+	UMIDMultipleAudio byte = 0x09
+	// UMIDMixed identifies a mixed group of components.
+	UMIDMixed byte = 0x0D
+	// UMIDNotIdentified is used when the material type isn't identified.
+	UMIDNotIdentified byte = 0x0F
+)
+
+const (
+	umidBasicSize    = 32
+	umidExtendedSize = 64
+	// umidBasicLength and umidExtendedLength are the lengths stored in the
+	// UMID, in bytes following the length field.
+	umidBasicLength    = 0x13
+	umidExtendedLength = 0x33
+	// umidMethodUUID is the UUID material number generation method (upper
+	// nibble) with the instance number generation method 0 (lower nibble),
+	// meaning no defined method as the instance number of new material is 0.
+	umidMethodUUID = 0x20
+)
+
+// umidLabelPrefix is the start of the universal label of all UMIDs.
+var umidLabelPrefix = []byte{0x06, 0x0A, 0x2B, 0x34, 0x01, 0x01, 0x01, 0x05, 0x01, 0x01}
+
+// UMID is a SMPTE unique material identifier, a basic UMID being 32 bytes
+// long and an extended one 64 bytes long.
+type UMID struct {
+	// Label is the universal label, its 11th byte being the material type
+	// and its 12th byte the generation methods of the material and instance
+	// numbers.
+	Label [12]byte
+	// Instance distinguishes the instances of the material, it is 0 for
+	// the original material.
+	Instance [3]byte
+	// Material is the globally unique number of the material.
+	Material [16]byte
+	// Extended is true when the UMID has a source pack.
+	Extended bool
+	// SourcePack describes when (8 bytes), where (12 bytes) and by whom (3
+	// times 4 bytes for the country, organisation and user codes) the
+	// material was created.
+	SourcePack [32]byte
+}
+
+// NewUMID returns a basic UMID of the passed material type, for instance
+// UMIDSingleAudio, its material number being a random version 4 UUID.
+func NewUMID(materialType byte) (*UMID, error) {
+	u := &UMID{}
+	copy(u.Label[:], umidLabelPrefix)
+	u.Label[10] = materialType
+	u.Label[11] = umidMethodUUID
+	if _, err := rand.Read(u.Material[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate the UMID material number - %w", err)
+	}
+	u.Material[6] = u.Material[6]&0x0F | 0x40
+	u.Material[8] = u.Material[8]&0x3F | 0x80
+	return u, nil
+}
+
+// ParseUMID parses a 32 or 64 byte UMID. A 64 byte UMID with an empty source
+// pack, such as a basic UMID stored in the bext chunk, is parsed as a basic
+// UMID. nil is returned for an all zero UMID.
+func ParseUMID(b []byte) (*UMID, error) {
+	if len(b) != umidBasicSize && len(b) != umidExtendedSize {
+		return nil, fmt.Errorf("invalid UMID size: %d bytes", len(b))
+	}
+	if isZero(b) {
+		return nil, nil
+	}
+	if !bytes.HasPrefix(b, umidLabelPrefix) {
+		return nil, errors.New("invalid UMID label")
+	}
+	u := &UMID{}
+	copy(u.Label[:], b)
+	length := b[12]
+	copy(u.Instance[:], b[13:16])
+	copy(u.Material[:], b[16:32])
+	switch length {
+	case umidBasicLength:
+		if len(b) == umidExtendedSize && !isZero(b[umidBasicSize:]) {
+			return nil, errors.New("basic UMID followed by a source pack")
+		}
+	case umidExtendedLength:
+		if len(b) != umidExtendedSize {
+			return nil, errors.New("truncated extended UMID")
+		}
+		u.Extended = true
+		copy(u.SourcePack[:], b[umidBasicSize:])
+	default:
+		return nil, fmt.Errorf("invalid UMID length %#x", length)
+	}
+	return u, nil
+}
+
+// ParseUMIDString parses the hexadecimal representation of a UMID, see
+// String. Spaces, dashes and a 0x prefix are ignored.
+func ParseUMIDString(s string) (*UMID, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	s = strings.NewReplacer(" ", "", "-", "").Replace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UMID %q - %w", s, err)
+	}
+	return ParseUMID(b)
+}
+
+// MaterialType returns the material type of the label, for instance
+// UMIDSingleAudio.
+func (u *UMID) MaterialType() byte {
+	return u.Label[10]
+}
+
+// Country returns the country code of the source pack of extended UMIDs.
+func (u *UMID) Country() string {
+	return string(bytes.TrimRight(u.SourcePack[20:24], "\x00 "))
+}
+
+// Organization returns the organisation code of the source pack of
+// extended UMIDs.
+func (u *UMID) Organization() string {
+	return string(bytes.TrimRight(u.SourcePack[24:28], "\x00 "))
+}
+
+// User returns the user code of the source pack of extended UMIDs.
+func (u *UMID) User() string {
+	return string(bytes.TrimRight(u.SourcePack[28:32], "\x00 "))
+}
+
+// Bytes returns the 32 or 64 byte representation of the UMID.
+func (u *UMID) Bytes() []byte {
+	b := make([]byte, 0, umidExtendedSize)
+	b = append(b, u.Label[:]...)
+	if u.Extended {
+		b = append(b, umidExtendedLength)
+	} else {
+		b = append(b, umidBasicLength)
+	}
+	b = append(b, u.Instance[:]...)
+	b = append(b, u.Material[:]...)
+	if u.Extended {
+		b = append(b, u.SourcePack[:]...)
+	}
+	return b
+}
+
+// String returns the hexadecimal representation of the UMID.
+func (u *UMID) String() string {
+	return strings.ToUpper(hex.EncodeToString(u.Bytes()))
+}
+
+// SetUMID sets the UMID field of the bext chunk, a basic UMID being padded
+// with zeros. A nil UMID clears the field.
+func (b *BroadcastExtension) SetUMID(u *UMID) {
+	b.UMID = [64]byte{}
+	if u != nil {
+		copy(b.UMID[:], u.Bytes())
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -13,12 +13,17 @@ import (
 var (
 	// ErrPCMChunkNotFound indicates a bad audio file without data
 	ErrPCMChunkNotFound = errors.New("PCM Chunk not found in audio file")
+	// ErrChecksumNotFound indicates that the audio file doesn't have a MD5
+	// chunk to verify the PCM data against
+	ErrChecksumNotFound = errors.New("MD5 chunk not found in audio file")
+	// ErrTimecodeNotFound indicates that the audio file doesn't define the
+	// position of its first sample in a bext, iXML or smpl chunk
+	ErrTimecodeNotFound = errors.New("start timecode not found in audio file")
+	// ErrClipped indicates that a sample written to an encoder with
+	// FailOnClip set was out of range
+	ErrClipped = errors.New("clipped sample")
 )
 
-func nullTermStr(b []byte) string {
-	return string(b[:clen(b)])
-}
-
 func clen(n []byte) int {
 	for i := 0; i < len(n); i++ {
 		if n[i] == 0 {
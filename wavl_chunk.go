@@ -0,0 +1,237 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// waveListSegment is a data or slnt chunk of a wave list.
+type waveListSegment struct {
+	// chunkStart is the offset of the chunk in the wave list, as referenced
+	// by CuePoint.ChunkStart.
+	chunkStart uint32
+	silent     bool
+	// offset is the position of the chunk data in the file, unused for
+	// silent segments.
+	offset int64
+	// start is the position of the segment in the PCM stream and size its
+	// length, both in bytes.
+	start, size int
+}
+
+// waveList presents the segments of a LIST wavl chunk as a continuous PCM
+// stream, silent segments being read as silence.
+type waveList struct {
+	r        io.ReadSeeker
+	segments []*waveListSegment
+	silence  byte
+	// seg is the index of the current segment and pos the position in that
+	// segment.
+	seg, pos int
+	// seeked is true when the reader is positioned in the current segment.
+	seeked bool
+}
+
+// isWaveList returns positively if the LIST chunk being read is a wave list.
+// The reader is moved back to the start of the chunk data.
+func (d *Decoder) isWaveList() (bool, error) {
+	listType := make([]byte, 4)
+	if _, err := io.ReadFull(d.r, listType); err != nil {
+		return false, fmt.Errorf("failed to read the LIST type - %w", err)
+	}
+	if _, err := d.r.Seek(-4, io.SeekCurrent); err != nil {
+		return false, err
+	}
+	return bytes.Equal(listType, CIDWavl[:]), nil
+}
+
+// decodeWaveList reads the segments of the passed wave list and uses them as
+// the PCM data of the decoder.
+func (d *Decoder) decodeWaveList(ch *riff.Chunk) error {
+	blockAlign := d.blockAlign()
+	if blockAlign == 0 {
+		return fmt.Errorf("can't read a wave list of %d channels of %d bits", d.NumChans, d.BitDepth)
+	}
+	if d.stream() != nil {
+		// the segments are read in any order
+		return fmt.Errorf("can't read a wave list from a stream - %w", ErrNotSeekable)
+	}
+	w := &waveList{r: d.r}
+	if d.BitDepth == 8 {
+		// 8 bit samples are unsigned
+		w.silence = 0x80
+	}
+	var (
+		listType [4]byte
+		id       [4]byte
+		size     uint32
+	)
+	if err := binary.Read(ch, binary.BigEndian, &listType); err != nil {
+		return fmt.Errorf("failed to read the wave list type - %w", err)
+	}
+	var chunkStart uint32
+	for rem := ch.Size - 4; rem >= 8; {
+		if err := binary.Read(ch, binary.BigEndian, &id); err != nil {
+			return fmt.Errorf("failed to read the wave list chunk ID - %w", err)
+		}
+		if err := binary.Read(ch, binary.LittleEndian, &size); err != nil {
+			return fmt.Errorf("failed to read the wave list chunk size - %w", err)
+		}
+		paddedSize := int(size) + int(size%2)
+		if paddedSize > rem-8 {
+			paddedSize = rem - 8
+		}
+		s := &waveListSegment{chunkStart: chunkStart}
+		switch id {
+		case riff.DataFormatID:
+			offset, err := d.r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+			s.offset = offset
+			s.size = int(size)
+			if _, err := io.CopyN(io.Discard, ch, int64(paddedSize)); err != nil {
+				return fmt.Errorf("failed to skip the wave list data chunk - %w", err)
+			}
+		case CIDSlnt:
+			var frames uint32
+			if err := binary.Read(ch, binary.LittleEndian, &frames); err != nil {
+				return fmt.Errorf("failed to read the wave list slnt chunk - %w", err)
+			}
+			s.silent = true
+			s.size = int(frames) * blockAlign
+			if _, err := io.CopyN(io.Discard, ch, int64(paddedSize-4)); err != nil {
+				return fmt.Errorf("failed to skip the wave list slnt chunk - %w", err)
+			}
+		default:
+			s = nil
+			if _, err := io.CopyN(io.Discard, ch, int64(paddedSize)); err != nil {
+				return fmt.Errorf("failed to skip the wave list %s chunk - %w", id[:], err)
+			}
+		}
+		if s != nil {
+			if n := len(w.segments); n > 0 {
+				s.start = w.segments[n-1].start + w.segments[n-1].size
+			}
+			w.segments = append(w.segments, s)
+		}
+		chunkStart += uint32(paddedSize) + 8
+		rem -= paddedSize + 8
+	}
+	ch.Drain()
+
+	var pcmSize int
+	if n := len(w.segments); n > 0 {
+		pcmSize = w.segments[n-1].start + w.segments[n-1].size
+	}
+	d.waveList = w
+	d.PCMSize = pcmSize
+	d.PCMChunk = &riff.Chunk{ID: riff.DataFormatID, Size: pcmSize, R: w}
+	return nil
+}
+
+// Read implements the io.Reader interface.
+func (w *waveList) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if w.seg >= len(w.segments) {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+		s := w.segments[w.seg]
+		if w.pos >= s.size {
+			w.seg++
+			w.pos = 0
+			w.seeked = false
+			continue
+		}
+		b := p[n:]
+		if len(b) > s.size-w.pos {
+			b = b[:s.size-w.pos]
+		}
+		var m int
+		if s.silent {
+			for i := range b {
+				b[i] = w.silence
+			}
+			m = len(b)
+		} else {
+			if !w.seeked {
+				if _, err := w.r.Seek(s.offset+int64(w.pos), io.SeekStart); err != nil {
+					return n, err
+				}
+				w.seeked = true
+			}
+			m, err = w.r.Read(b)
+			if err != nil && !(errors.Is(err, io.EOF) && m > 0) {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return n, err
+			}
+		}
+		n += m
+		w.pos += m
+	}
+	return n, nil
+}
+
+// offset returns the position of the stream in bytes.
+func (w *waveList) offset() int {
+	if w.seg >= len(w.segments) {
+		if n := len(w.segments); n > 0 {
+			return w.segments[n-1].start + w.segments[n-1].size
+		}
+		return 0
+	}
+	return w.segments[w.seg].start + w.pos
+}
+
+// seek moves the stream to the passed offset in bytes.
+func (w *waveList) seek(offset int) {
+	w.seg, w.pos, w.seeked = len(w.segments), 0, false
+	for i, s := range w.segments {
+		if offset < s.start+s.size {
+			w.seg, w.pos = i, offset-s.start
+			return
+		}
+	}
+}
+
+// CuePointFrame returns the frame of the PCM stream the passed cue point
+// refers to. The cue points of files using a wave list are resolved against
+// the data and slnt chunks of the list.
+func (d *Decoder) CuePointFrame(c *CuePoint) (int, error) {
+	if c == nil {
+		return 0, errors.New("nil cue point")
+	}
+	if !d.WasPCMAccessed() {
+		if err := d.FwdToPCM(); err != nil {
+			return 0, err
+		}
+	}
+	blockAlign := d.blockAlign()
+	if blockAlign == 0 {
+		return 0, fmt.Errorf("can't resolve cue points of %d channels of %d bits", d.NumChans, d.BitDepth)
+	}
+	frame := int(c.BlockStart)/blockAlign + int(c.SampleOffset)
+	if d.waveList == nil {
+		// some writers only set the play position
+		if frame == 0 && c.Position > 0 && (d.Metadata == nil || len(d.Metadata.PlayList) == 0) {
+			frame = int(c.Position)
+		}
+		return frame, nil
+	}
+	for _, s := range d.waveList.segments {
+		if s.chunkStart == c.ChunkStart {
+			return s.start/blockAlign + frame, nil
+		}
+	}
+	return 0, fmt.Errorf("wave list chunk at offset %d not found", c.ChunkStart)
+}
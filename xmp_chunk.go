@@ -0,0 +1,1186 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// XMP is documented here:
+// https://www.adobe.com/devnet/xmp.html
+// The Dynamic Media (xmpDM) schema is described in the part 2 of the XMP
+// specification.
+
+const (
+	nsRDF   = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC    = "http://purl.org/dc/elements/1.1/"
+	nsXMPDM = "http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+	nsXML   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// XMP represents the XMP packet stored in the _PMX chunk by Adobe Audition,
+// Premiere and other tools.
+type XMP struct {
+	// Raw is the XMP packet as found in the file. When Raw is set, the encoder
+	// only writes the typed values below which differ from the ones found in
+	// it, the rest of the packet being kept as is. For language alternatives
+	// only the x-default entry is replaced, the markers are rewritten from
+	// Markers and a property set to an empty value is removed. Set it to nil
+	// to only write the typed values.
+	Raw []byte
+	// Title is the dc:title property.
+	Title string
+	// Creator contains the entries of the dc:creator property.
+	Creator []string
+	// Rights is the dc:rights property, an informal rights statement.
+	Rights string
+	// Tempo is the xmpDM:tempo property in beats per minute.
+	Tempo float64
+	// Key is the xmpDM:key property, the audio's musical key such as C#m.
+	Key string
+	// Markers contains the markers of all the xmpDM:Tracks.
+	Markers []*XMPMarker
+}
+
+// XMPMarker is a xmpDM marker such as a cue point, an index or a beat marker.
+type XMPMarker struct {
+	Name    string
+	Comment string
+	// Type is the xmpDM:type of the marker, for instance Cue, Index, Beat or
+	// Track.
+	Type string
+	// Start and Duration are expressed in frames of the marker's FrameRate.
+	Start    int64
+	Duration int64
+	// FrameRate is the xmpDM:frameRate of the track containing the marker
+	// using the XMP notation, for instance f48000 for 48kHz or f30000s1001.
+	// When empty, the encoder uses the sample rate of the file.
+	FrameRate string
+}
+
+// StartTime returns the start position of the marker as a duration.
+func (m *XMPMarker) StartTime() (time.Duration, error) {
+	return xmpFramesToDuration(m.Start, m.FrameRate)
+}
+
+// DurationTime returns the duration of the marker.
+func (m *XMPMarker) DurationTime() (time.Duration, error) {
+	return xmpFramesToDuration(m.Duration, m.FrameRate)
+}
+
+func xmpFramesToDuration(frames int64, frameRate string) (time.Duration, error) {
+	num, den, err := parseXMPFrameRate(frameRate)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(float64(frames) * float64(den) / float64(num) * float64(time.Second)), nil
+}
+
+// parseXMPFrameRate parses a frame rate expressed as f<num>[s<den>].
+func parseXMPFrameRate(s string) (num, den int64, err error) {
+	if !strings.HasPrefix(s, "f") {
+		return 0, 0, fmt.Errorf("invalid XMP frame rate %q", s)
+	}
+	s = s[1:]
+	den = 1
+	if i := strings.IndexByte(s, 's'); i >= 0 {
+		if den, err = strconv.ParseInt(s[i+1:], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid XMP frame rate %q - %w", s, err)
+		}
+		s = s[:i]
+	}
+	if num, err = strconv.ParseInt(s, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid XMP frame rate %q - %w", s, err)
+	}
+	if num <= 0 || den <= 0 {
+		return 0, 0, fmt.Errorf("invalid XMP frame rate f%s", s)
+	}
+	return num, den, nil
+}
+
+// DecodeXMPChunk decodes a _PMX chunk and puts the data in Decoder.Metadata.XMP
+func DecodeXMPChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID == CIDXMP {
+		// read the entire chunk in memory
+		buf := make([]byte, ch.Size)
+		var err error
+		if _, err = io.ReadFull(ch, buf); err != nil {
+			return fmt.Errorf("failed to read the _PMX chunk - %w", err)
+		}
+		x, err := ParseXMP(bytes.TrimRight(buf, "\x00"))
+		if err != nil {
+			return err
+		}
+		if d.Metadata == nil {
+			d.Metadata = &Metadata{}
+		}
+		d.Metadata.XMP = x
+	}
+	ch.Drain()
+	return nil
+}
+
+// ParseXMP parses the passed XMP packet, the invalid tempo and marker
+// positions written by some tools being left to 0.
+func ParseXMP(packet []byte) (*XMP, error) {
+	root, err := parseXMLTree(packet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the XMP packet - %w", err)
+	}
+	return decodeXMPTree(root, packet), nil
+}
+
+// decodeXMPTree returns the typed values of the parsed packet.
+func decodeXMPTree(root *xmlNode, packet []byte) *XMP {
+	x := &XMP{Raw: packet}
+	if p := root.findProperty(nsDC, "title"); p != nil {
+		x.Title = p.value()
+	}
+	if p := root.findProperty(nsDC, "creator"); p != nil {
+		x.Creator = p.values()
+	}
+	if p := root.findProperty(nsDC, "rights"); p != nil {
+		x.Rights = p.value()
+	}
+	if p := root.findProperty(nsXMPDM, "tempo"); p != nil {
+		// invalid values written by other tools are ignored
+		if tempo, err := strconv.ParseFloat(strings.TrimSpace(p.value()), 64); err == nil {
+			x.Tempo = tempo
+		}
+	}
+	if p := root.findProperty(nsXMPDM, "key"); p != nil {
+		x.Key = p.value()
+	}
+
+	for _, markers := range root.findAll(nsXMPDM, "markers") {
+		var frameRate string
+		// the frame rate is defined by the track containing the markers.
+		for n := markers.parent; n != nil && frameRate == ""; n = n.parent {
+			frameRate = n.field(nsXMPDM, "frameRate")
+		}
+		for _, li := range markers.items() {
+			m := &XMPMarker{
+				Name:      li.field(nsXMPDM, "name"),
+				Comment:   li.field(nsXMPDM, "comment"),
+				Type:      li.field(nsXMPDM, "type"),
+				FrameRate: frameRate,
+			}
+			m.Start = parseXMPFrames(li.field(nsXMPDM, "startTime"))
+			m.Duration = parseXMPFrames(li.field(nsXMPDM, "duration"))
+			x.Markers = append(x.Markers, m)
+		}
+	}
+
+	return x
+}
+
+// parseXMPFrames parses a number of frames, 0 being returned for empty or
+// invalid values.
+func parseXMPFrames(s string) int64 {
+	frames, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return frames
+}
+
+// Marshal returns a new XMP packet containing the typed values.
+func (x *XMP) Marshal() []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"" + nsRDF + "\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	buf.WriteString("    xmlns:dc=\"" + nsDC + "\"\n")
+	buf.WriteString("    xmlns:xmpDM=\"" + nsXMPDM + "\"")
+	if x.Tempo != 0 {
+		buf.WriteString("\n    xmpDM:tempo=\"" + formatXMPTempo(x.Tempo) + "\"")
+	}
+	if x.Key != "" {
+		buf.WriteString("\n    xmpDM:key=\"" + xmlEscape(x.Key) + "\"")
+	}
+	buf.WriteString(">\n")
+	if x.Title != "" {
+		buf.WriteString("   " + xmpAlt("dc:title", x.Title) + "\n")
+	}
+	if len(x.Creator) > 0 {
+		buf.WriteString("   " + xmpSeq("dc:creator", x.Creator) + "\n")
+	}
+	if x.Rights != "" {
+		buf.WriteString("   " + xmpAlt("dc:rights", x.Rights) + "\n")
+	}
+	if len(x.Markers) > 0 {
+		buf.WriteString("   <xmpDM:Tracks><rdf:Bag>\n")
+		for _, track := range xmpMarkerTracks(x.Markers) {
+			buf.WriteString("    " + track + "\n")
+		}
+		buf.WriteString("   </rdf:Bag></xmpDM:Tracks>\n")
+	}
+	buf.WriteString("  </rdf:Description>\n")
+	buf.WriteString(" </rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>")
+	return buf.Bytes()
+}
+
+func formatXMPTempo(tempo float64) string {
+	return strconv.FormatFloat(tempo, 'f', -1, 64)
+}
+
+// xmpAlt returns a language alternative property only containing the
+// x-default entry.
+func xmpAlt(name, val string) string {
+	return "<" + name + "><rdf:Alt><rdf:li xml:lang=\"x-default\">" + xmlEscape(val) + "</rdf:li></rdf:Alt></" + name + ">"
+}
+
+// xmpSeq returns an ordered array property.
+func xmpSeq(name string, values []string) string {
+	s := "<" + name + "><rdf:Seq>"
+	for _, v := range values {
+		s += "<rdf:li>" + xmlEscape(v) + "</rdf:li>"
+	}
+	return s + "</rdf:Seq></" + name + ">"
+}
+
+// xmpMarkerTracks returns the rdf:li entries of the xmpDM:Tracks property
+// containing the passed markers, the markers being grouped in tracks sharing
+// the same frame rate.
+func xmpMarkerTracks(markers []*XMPMarker) []string {
+	var rates []string
+	byRate := map[string][]*XMPMarker{}
+	for _, m := range markers {
+		if _, ok := byRate[m.FrameRate]; !ok {
+			rates = append(rates, m.FrameRate)
+		}
+		byRate[m.FrameRate] = append(byRate[m.FrameRate], m)
+	}
+	tracks := make([]string, len(rates))
+	for i, rate := range rates {
+		buf := bytes.NewBuffer(nil)
+		buf.WriteString("<rdf:li rdf:parseType=\"Resource\">\n")
+		buf.WriteString("     <xmpDM:trackName>Markers</xmpDM:trackName>\n")
+		if rate != "" {
+			buf.WriteString("     <xmpDM:frameRate>" + xmlEscape(rate) + "</xmpDM:frameRate>\n")
+		}
+		buf.WriteString("     <xmpDM:markers><rdf:Seq>\n")
+		for _, m := range byRate[rate] {
+			buf.WriteString("      <rdf:li rdf:parseType=\"Resource\">")
+			buf.WriteString("<xmpDM:startTime>" + strconv.FormatInt(m.Start, 10) + "</xmpDM:startTime>")
+			if m.Duration != 0 {
+				buf.WriteString("<xmpDM:duration>" + strconv.FormatInt(m.Duration, 10) + "</xmpDM:duration>")
+			}
+			if m.Name != "" {
+				buf.WriteString("<xmpDM:name>" + xmlEscape(m.Name) + "</xmpDM:name>")
+			}
+			if m.Comment != "" {
+				buf.WriteString("<xmpDM:comment>" + xmlEscape(m.Comment) + "</xmpDM:comment>")
+			}
+			if m.Type != "" {
+				buf.WriteString("<xmpDM:type>" + xmlEscape(m.Type) + "</xmpDM:type>")
+			}
+			buf.WriteString("</rdf:li>\n")
+		}
+		buf.WriteString("     </rdf:Seq></xmpDM:markers>\n")
+		buf.WriteString("    </rdf:li>")
+		tracks[i] = buf.String()
+	}
+	return tracks
+}
+
+// encodeXMPChunk returns the content of the _PMX chunk, nil if no packet
+// should be written.
+func encodeXMPChunk(e *Encoder) []byte {
+	if e == nil || e.Metadata == nil || e.Metadata.XMP == nil {
+		return nil
+	}
+	x := e.Metadata.XMP
+	frameRate := "f" + strconv.Itoa(e.SampleRate)
+	if len(x.Raw) > 0 {
+		return x.merge(frameRate)
+	}
+	cpy := *x
+	cpy.Markers = xmpMarkersWithRate(x.Markers, frameRate)
+	return cpy.Marshal()
+}
+
+// xmpMarkersWithRate returns copies of the markers, the passed frame rate
+// being used by the markers without one.
+func xmpMarkersWithRate(markers []*XMPMarker, frameRate string) []*XMPMarker {
+	cpy := make([]*XMPMarker, len(markers))
+	for i, m := range markers {
+		mCpy := *m
+		if mCpy.FrameRate == "" {
+			mCpy.FrameRate = frameRate
+		}
+		cpy[i] = &mCpy
+	}
+	return cpy
+}
+
+// merge returns the raw packet updated with the typed values differing from
+// the ones found in it. Only the modified properties are rewritten, the rest
+// of the packet being kept byte for byte. frameRate is used by the markers
+// without frame rate. The raw packet is returned as is if it can't be parsed.
+func (x *XMP) merge(frameRate string) []byte {
+	root, err := parseXMLTree(x.Raw)
+	if err != nil {
+		return x.Raw
+	}
+	descs := root.descriptions()
+	if len(descs) == 0 {
+		return x.Raw
+	}
+	decoded := decodeXMPTree(root, x.Raw)
+	ed := newXMLEditor(x.Raw)
+	if x.Title != decoded.Title {
+		ed.setXMPValue(descs, nsDC, "title", x.Title, true)
+	}
+	if !equalStrings(x.Creator, decoded.Creator) {
+		ed.setXMPArray(descs, nsDC, "creator", x.Creator)
+	}
+	if x.Rights != decoded.Rights {
+		ed.setXMPValue(descs, nsDC, "rights", x.Rights, true)
+	}
+	if x.Tempo != decoded.Tempo {
+		var tempo string
+		if x.Tempo != 0 {
+			tempo = formatXMPTempo(x.Tempo)
+		}
+		ed.setXMPValue(descs, nsXMPDM, "tempo", tempo, false)
+	}
+	if x.Key != decoded.Key {
+		ed.setXMPValue(descs, nsXMPDM, "key", x.Key, false)
+	}
+	markers := xmpMarkersWithRate(x.Markers, frameRate)
+	if !equalXMPMarkers(markers, xmpMarkersWithRate(decoded.Markers, frameRate)) {
+		ed.setXMPMarkers(root, descs, markers)
+	}
+	return ed.apply()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalXMPMarkers(a, b []*XMPMarker) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setXMPValue sets the simple or, if alt is set, language alternative
+// property of the descriptions. Only the x-default entry of the language
+// alternatives is replaced. The property is removed if val is empty.
+func (ed *xmlEditor) setXMPValue(descs []*xmlNode, space, local, val string, alt bool) {
+	if val == "" {
+		ed.removeProperty(descs, space, local)
+		return
+	}
+	name := xmlPrefixes[space] + ":" + local
+	frag := "<" + name + ">" + xmlEscape(val) + "</" + name + ">"
+	if alt {
+		frag = xmpAlt(name, val)
+	}
+	_, attr, elem := ed.findProperty(descs, space, local)
+	switch {
+	case attr != nil:
+		ed.replace(attr.valueStart, attr.valueEnd, xmlEscape(val))
+	case elem == nil:
+		ed.appendChild(descs[0], frag)
+	case alt && len(elem.items()) > 0:
+		if li := elem.defaultItem(); len(li.children) == 0 {
+			ed.setText(li, val)
+		} else {
+			ed.replaceNode(elem, frag)
+		}
+	case len(elem.children) == 0:
+		ed.setText(elem, val)
+	default:
+		ed.replaceNode(elem, frag)
+	}
+}
+
+// setXMPArray sets the ordered array property of the descriptions, it is
+// removed if values is empty.
+func (ed *xmlEditor) setXMPArray(descs []*xmlNode, space, local string, values []string) {
+	if len(values) == 0 {
+		ed.removeProperty(descs, space, local)
+		return
+	}
+	frag := xmpSeq(xmlPrefixes[space]+":"+local, values)
+	desc, attr, elem := ed.findProperty(descs, space, local)
+	switch {
+	case elem != nil:
+		ed.replaceNode(elem, frag)
+	case attr != nil:
+		ed.replace(attr.start, attr.end, "")
+		ed.appendChild(desc, frag)
+	default:
+		ed.appendChild(descs[0], frag)
+	}
+}
+
+// setXMPMarkers replaces the markers of the packet. The tracks only made of
+// markers are removed and the new ones added to the remaining tracks.
+func (ed *xmlEditor) setXMPMarkers(root *xmlNode, descs []*xmlNode, markers []*XMPMarker) {
+	for _, m := range root.findAll(nsXMPDM, "markers") {
+		track := m.parent
+		if track.is(nsRDF, "Description") && track.parent != nil && track.parent.is(nsRDF, "li") && len(track.parent.children) == 1 {
+			track = track.parent
+		}
+		if track.is(nsRDF, "li") && isXMPMarkerTrack(track) {
+			ed.removeNode(track)
+		} else {
+			ed.removeNode(m)
+		}
+	}
+	var bag *xmlNode
+	for _, desc := range descs {
+		for _, c := range desc.children {
+			if !c.is(nsXMPDM, "Tracks") {
+				continue
+			}
+			items := c.items()
+			remaining := 0
+			for _, li := range items {
+				if !ed.removed[li] {
+					remaining++
+				}
+			}
+			if len(items) > 0 && remaining == 0 {
+				ed.removeNode(c)
+				continue
+			}
+			for _, array := range c.children {
+				if bag == nil && (array.is(nsRDF, "Bag") || array.is(nsRDF, "Seq")) {
+					bag = array
+				}
+			}
+		}
+	}
+	if len(markers) == 0 {
+		return
+	}
+	tracks := xmpMarkerTracks(markers)
+	if bag != nil {
+		for _, track := range tracks {
+			ed.appendChild(bag, track)
+		}
+		return
+	}
+	ed.appendChild(descs[0], "<xmpDM:Tracks><rdf:Bag>\n    "+strings.Join(tracks, "\n    ")+"\n   </rdf:Bag></xmpDM:Tracks>")
+}
+
+// isXMPMarkerTrack returns positively if the passed track only contains its
+// markers and the fields describing them.
+func isXMPMarkerTrack(track *xmlNode) bool {
+	fields := func(n *xmlNode) bool {
+		for _, a := range n.attrs {
+			if a.Name.Space == "xmlns" || a.Name.Space == nsRDF || a.Name.Space == "" && a.Name.Local == "xmlns" {
+				continue
+			}
+			if a.Name.Space != nsXMPDM || (a.Name.Local != "trackName" && a.Name.Local != "trackType" && a.Name.Local != "frameRate") {
+				return false
+			}
+		}
+		for _, c := range n.children {
+			if c.is(nsRDF, "Description") || c.is(nsXMPDM, "markers") {
+				continue
+			}
+			if c.name.Space != nsXMPDM || (c.name.Local != "trackName" && c.name.Local != "trackType" && c.name.Local != "frameRate") {
+				return false
+			}
+		}
+		return true
+	}
+	if !fields(track) {
+		return false
+	}
+	for _, c := range track.children {
+		if c.is(nsRDF, "Description") && !fields(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlNode is a minimal DOM used to walk and update RDF/XML documents.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	children []*xmlNode
+	parent   *xmlNode
+	text     string
+	// inst is set for the processing instructions found at the top level of
+	// the document, such as the xpacket wrapper.
+	inst *xml.ProcInst
+	// start, content, close and end are the offsets in the parsed document of
+	// the start tag, of the content, of the end tag and of the end of the
+	// element. close and content are equal for empty elements.
+	start, content, close, end int64
+}
+
+func parseXMLTree(b []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	root := &xmlNode{}
+	cur := root
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name, attrs: t.Copy().Attr, parent: cur, start: offset, content: dec.InputOffset()}
+			cur.children = append(cur.children, n)
+			cur = n
+		case xml.EndElement:
+			cur.close, cur.end = offset, dec.InputOffset()
+			if cur.parent != nil {
+				cur = cur.parent
+			}
+		case xml.CharData:
+			cur.text += string(t)
+		case xml.ProcInst:
+			if cur == root {
+				root.children = append(root.children, &xmlNode{parent: root, inst: &xml.ProcInst{Target: t.Target, Inst: t.Copy().Inst}})
+			}
+		}
+	}
+	return root, nil
+}
+
+// xmlPrefixes are the prefixes used to declare the well known namespaces
+// missing from a document.
+var xmlPrefixes = map[string]string{
+	nsRDF:     "rdf",
+	nsDC:      "dc",
+	nsXMPDM:   "xmpDM",
+	nsEBUCore: "ebu",
+}
+
+// xmlScope contains the namespaces declared by an element and its ancestors.
+type xmlScope struct {
+	// namespaces maps the prefixes declared by the element to their
+	// namespace, the empty prefix being the default namespace.
+	namespaces map[string]string
+	parent     *xmlScope
+}
+
+// resolve returns the namespace bound to the passed prefix.
+func (s *xmlScope) resolve(prefix string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if ns, ok := s.namespaces[prefix]; ok {
+			return ns, true
+		}
+	}
+	return "", false
+}
+
+// prefix returns a prefix bound to the passed namespace.
+func (s *xmlScope) prefix(space string) (string, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		for p, ns := range sc.namespaces {
+			// the prefix can be bound to another namespace by a descendant
+			if ns == space {
+				if resolved, _ := s.resolve(p); resolved == space {
+					return p, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// marshal serializes the document, the namespaces used by the elements added
+// to the tree being declared where needed. The whitespace of the elements
+// containing other elements isn't preserved.
+func (n *xmlNode) marshal() []byte {
+	buf := bytes.NewBuffer(nil)
+	for i, c := range n.children {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		c.writeTo(buf, 0, nil)
+	}
+	return buf.Bytes()
+}
+
+func (n *xmlNode) writeTo(buf *bytes.Buffer, depth int, parent *xmlScope) {
+	esc := func(s string) string {
+		b := bytes.NewBuffer(nil)
+		xml.EscapeText(b, []byte(s))
+		return b.String()
+	}
+	if n.inst != nil {
+		buf.WriteString("<?" + n.inst.Target + " " + string(n.inst.Inst) + "?>")
+		return
+	}
+	scope := &xmlScope{namespaces: map[string]string{}, parent: parent}
+	for _, a := range n.attrs {
+		switch {
+		case a.Name.Space == "xmlns":
+			scope.namespaces[a.Name.Local] = a.Value
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			scope.namespaces[""] = a.Value
+		}
+	}
+	var decls []string
+	qname := func(name xml.Name, attr bool) string {
+		switch {
+		case name.Space == "" || name.Space == "xmlns":
+			return name.Local
+		case name.Space == nsXML:
+			return "xml:" + name.Local
+		}
+		// the attributes without prefix don't belong to the default namespace
+		if p, ok := scope.prefix(name.Space); ok && (p != "" || !attr) {
+			if p == "" {
+				return name.Local
+			}
+			return p + ":" + name.Local
+		}
+		if !strings.Contains(name.Space, ":") {
+			// undeclared prefix left as is by the decoder
+			return name.Space + ":" + name.Local
+		}
+		p := xmlPrefixes[name.Space]
+		if p == "" {
+			p = "ns"
+		}
+		for i := 1; ; i++ {
+			if _, bound := scope.resolve(p); !bound {
+				break
+			}
+			p = xmlPrefixes[name.Space] + "ns" + strconv.Itoa(i)
+		}
+		scope.namespaces[p] = name.Space
+		decls = append(decls, " xmlns:"+p+"=\""+esc(name.Space)+"\"")
+		return p + ":" + name.Local
+	}
+
+	tag := qname(n.name, false)
+	var attrs []string
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" {
+			attrs = append(attrs, " xmlns:"+a.Name.Local+"=\""+esc(a.Value)+"\"")
+			continue
+		}
+		attrs = append(attrs, " "+qname(a.Name, true)+"=\""+esc(a.Value)+"\"")
+	}
+	buf.WriteString("<" + tag)
+	for _, a := range attrs {
+		buf.WriteString(a)
+	}
+	for _, decl := range decls {
+		buf.WriteString(decl)
+	}
+	if len(n.children) == 0 {
+		if n.text == "" {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteString(">" + esc(n.text) + "</" + tag + ">")
+		return
+	}
+	buf.WriteString(">")
+	if text := strings.TrimSpace(n.text); text != "" {
+		buf.WriteString(esc(text))
+	}
+	indent := strings.Repeat(" ", depth)
+	for _, c := range n.children {
+		buf.WriteString("\n" + indent + " ")
+		c.writeTo(buf, depth+1, scope)
+	}
+	buf.WriteString("\n" + indent + "</" + tag + ">")
+}
+
+// remove removes the passed child.
+func (n *xmlNode) remove(child *xmlNode) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// insert inserts the passed child at the index i.
+func (n *xmlNode) insert(i int, child *xmlNode) {
+	child.parent = n
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
+}
+
+// setAttr sets or, for an empty value, removes the attribute with the passed
+// local name, whatever its namespace.
+func (n *xmlNode) setAttr(local, val string) {
+	for i, a := range n.attrs {
+		if a.Name.Local == local && a.Name.Space != "xmlns" {
+			if val == "" {
+				n.attrs = append(n.attrs[:i], n.attrs[i+1:]...)
+			} else {
+				n.attrs[i].Value = val
+			}
+			return
+		}
+	}
+	if val != "" {
+		n.attrs = append(n.attrs, xml.Attr{Name: xml.Name{Local: local}, Value: val})
+	}
+}
+
+// setSpace moves the node and its descendants to the passed namespace.
+func (n *xmlNode) setSpace(space string) {
+	n.name.Space = space
+	for _, c := range n.children {
+		c.setSpace(space)
+	}
+}
+
+func (n *xmlNode) is(space, local string) bool {
+	return n.name.Space == space && n.name.Local == local
+}
+
+func (n *xmlNode) attr(space, local string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// findAll returns all the elements with the passed name.
+func (n *xmlNode) findAll(space, local string) []*xmlNode {
+	var found []*xmlNode
+	for _, c := range n.children {
+		if c.is(space, local) {
+			found = append(found, c)
+		}
+		found = append(found, c.findAll(space, local)...)
+	}
+	return found
+}
+
+// findAllLocal returns all the elements with the passed local name,
+// whatever their namespace.
+func (n *xmlNode) findAllLocal(local string) []*xmlNode {
+	var found []*xmlNode
+	for _, c := range n.children {
+		if c.name.Local == local {
+			found = append(found, c)
+		}
+		found = append(found, c.findAllLocal(local)...)
+	}
+	return found
+}
+
+// attrLocal returns the value of the attribute with the passed local name,
+// whatever its namespace.
+func (n *xmlNode) attrLocal(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// descriptions returns the top level rdf:Description elements.
+func (n *xmlNode) descriptions() []*xmlNode {
+	var descs []*xmlNode
+	for _, desc := range n.findAll(nsRDF, "Description") {
+		if desc.parent != nil && desc.parent.is(nsRDF, "RDF") {
+			descs = append(descs, desc)
+		}
+	}
+	return descs
+}
+
+// findProperty returns the first top level property with the passed name
+// defined on a rdf:Description, either as an attribute or as an element.
+func (n *xmlNode) findProperty(space, local string) *xmlNode {
+	for _, desc := range n.descriptions() {
+		if v, ok := desc.attr(space, local); ok {
+			return &xmlNode{name: xml.Name{Space: space, Local: local}, text: v, parent: desc}
+		}
+		for _, c := range desc.children {
+			if c.is(space, local) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// items returns the rdf:li entries of an array property.
+func (n *xmlNode) items() []*xmlNode {
+	var items []*xmlNode
+	for _, c := range n.children {
+		if c.is(nsRDF, "Alt") || c.is(nsRDF, "Seq") || c.is(nsRDF, "Bag") {
+			for _, li := range c.children {
+				if li.is(nsRDF, "li") {
+					items = append(items, li)
+				}
+			}
+		}
+	}
+	return items
+}
+
+// value returns the simple value of a property, for language alternatives
+// the default entry is used.
+func (n *xmlNode) value() string {
+	if li := n.defaultItem(); li != nil {
+		return strings.TrimSpace(li.text)
+	}
+	return strings.TrimSpace(n.text)
+}
+
+// defaultItem returns the x-default entry (or the first one) of a language
+// alternative, nil if the property doesn't have entries.
+func (n *xmlNode) defaultItem() *xmlNode {
+	items := n.items()
+	if len(items) == 0 {
+		return nil
+	}
+	for _, li := range items {
+		if lang, _ := li.attr(nsXML, "lang"); lang == "x-default" {
+			return li
+		}
+	}
+	return items[0]
+}
+
+// values returns the values of an array property.
+func (n *xmlNode) values() []string {
+	items := n.items()
+	if len(items) == 0 {
+		if v := strings.TrimSpace(n.text); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+	values := make([]string, len(items))
+	for i, li := range items {
+		values[i] = strings.TrimSpace(li.text)
+	}
+	return values
+}
+
+// field returns the value of a field of a struct property, the struct being
+// expressed using attributes, child elements or a nested rdf:Description.
+func (n *xmlNode) field(space, local string) string {
+	if v, ok := n.attr(space, local); ok {
+		return v
+	}
+	for _, c := range n.children {
+		if c.is(space, local) {
+			return c.value()
+		}
+		if c.is(nsRDF, "Description") {
+			if v := c.field(space, local); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func xmlEscape(s string) string {
+	b := bytes.NewBuffer(nil)
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+// xmlEditor collects the edits of a parsed document, the bytes which aren't
+// edited being kept as they are.
+type xmlEditor struct {
+	raw   []byte
+	edits []xmlEdit
+	// removed contains the removed elements and appended the fragments added
+	// after the last child of the elements.
+	removed  map[*xmlNode]bool
+	appended map[*xmlNode][]string
+}
+
+// xmlEdit replaces the bytes from start to end by text.
+type xmlEdit struct {
+	start, end int64
+	text       string
+}
+
+// xmlRawAttr is an attribute of a start tag, start including the whitespace
+// preceding it.
+type xmlRawAttr struct {
+	name                             xml.Name
+	start, valueStart, valueEnd, end int64
+}
+
+func newXMLEditor(raw []byte) *xmlEditor {
+	return &xmlEditor{raw: raw, removed: map[*xmlNode]bool{}, appended: map[*xmlNode][]string{}}
+}
+
+// apply returns the edited document.
+func (ed *xmlEditor) apply() []byte {
+	for n, frags := range ed.appended {
+		ed.flushAppended(n, frags)
+	}
+	sort.SliceStable(ed.edits, func(i, j int) bool {
+		if ed.edits[i].start != ed.edits[j].start {
+			return ed.edits[i].start < ed.edits[j].start
+		}
+		return ed.edits[i].end < ed.edits[j].end
+	})
+	buf := bytes.NewBuffer(nil)
+	var pos int64
+	for _, e := range ed.edits {
+		// the edits of the removed elements are skipped
+		if e.start < pos {
+			continue
+		}
+		buf.Write(ed.raw[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.Write(ed.raw[pos:])
+	return buf.Bytes()
+}
+
+func (ed *xmlEditor) replace(start, end int64, text string) {
+	ed.edits = append(ed.edits, xmlEdit{start: start, end: end, text: text})
+}
+
+// removeNode removes the element and the whitespace preceding it.
+func (ed *xmlEditor) removeNode(n *xmlNode) {
+	ed.replace(n.start-int64(len(ed.leading(n))), n.end, "")
+	ed.removed[n] = true
+}
+
+// replaceNode replaces the element by the passed fragment.
+func (ed *xmlEditor) replaceNode(n *xmlNode, frag string) {
+	ed.replace(n.start, n.end, xmlDeclare(n.parent, frag))
+}
+
+// setText replaces the content of an element without children.
+func (ed *xmlEditor) setText(n *xmlNode, val string) {
+	if ed.selfClosing(n) {
+		ed.replace(n.content-2, n.content, ">"+xmlEscape(val)+"</"+ed.rawName(n)+">")
+		return
+	}
+	ed.replace(n.content, n.close, xmlEscape(val))
+}
+
+// appendChild adds the passed fragment after the last child of the element
+// which isn't removed.
+func (ed *xmlEditor) appendChild(n *xmlNode, frag string) {
+	ed.appended[n] = append(ed.appended[n], xmlDeclare(n, frag))
+}
+
+func (ed *xmlEditor) flushAppended(n *xmlNode, frags []string) {
+	indent := "\n" + ed.indent(n) + " "
+	var last *xmlNode
+	for _, c := range n.children {
+		if ed.removed[c] {
+			continue
+		}
+		if last == nil && strings.Contains(ed.leading(c), "\n") {
+			indent = "\n" + ed.indent(c)
+		}
+		last = c
+	}
+	text := indent + strings.Join(frags, indent)
+	switch {
+	case last != nil:
+		ed.replace(last.end, last.end, text)
+	case ed.selfClosing(n):
+		ed.replace(n.content-2, n.content, ">"+text+"\n"+ed.indent(n)+"</"+ed.rawName(n)+">")
+	default:
+		ed.replace(n.content, n.content, text)
+	}
+}
+
+// removeProperty removes all the occurrences of the property from the
+// descriptions.
+func (ed *xmlEditor) removeProperty(descs []*xmlNode, space, local string) {
+	for _, desc := range descs {
+		for _, a := range ed.attrs(desc) {
+			if a.name.Space == space && a.name.Local == local {
+				ed.replace(a.start, a.end, "")
+			}
+		}
+		for _, c := range desc.children {
+			if c.is(space, local) {
+				ed.removeNode(c)
+			}
+		}
+	}
+}
+
+// findProperty returns the first occurrence of the property, defined on desc
+// either as an attribute or as an element.
+func (ed *xmlEditor) findProperty(descs []*xmlNode, space, local string) (desc *xmlNode, attr *xmlRawAttr, elem *xmlNode) {
+	for _, desc := range descs {
+		for _, a := range ed.attrs(desc) {
+			if a.name.Space == space && a.name.Local == local {
+				a := a
+				return desc, &a, nil
+			}
+		}
+		for _, c := range desc.children {
+			if c.is(space, local) {
+				return desc, nil, c
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// attrs lexes the attributes of the start tag of the element.
+func (ed *xmlEditor) attrs(n *xmlNode) []xmlRawAttr {
+	tag := ed.raw[:n.content]
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\r' || c == '\n' }
+	i := n.start + 1 + int64(len(ed.rawName(n)))
+	var attrs []xmlRawAttr
+	for {
+		start := i
+		for i < int64(len(tag)) && isSpace(tag[i]) {
+			i++
+		}
+		if i >= int64(len(tag)) || tag[i] == '/' || tag[i] == '>' {
+			return attrs
+		}
+		nameStart := i
+		for i < int64(len(tag)) && tag[i] != '=' && !isSpace(tag[i]) {
+			i++
+		}
+		rawName := string(tag[nameStart:i])
+		for i < int64(len(tag)) && tag[i] != '\'' && tag[i] != '"' {
+			i++
+		}
+		if i >= int64(len(tag)) {
+			return attrs
+		}
+		quote := tag[i]
+		valueStart := i + 1
+		end := bytes.IndexByte(tag[valueStart:], quote)
+		if end < 0 {
+			return attrs
+		}
+		i = valueStart + int64(end) + 1
+		a := xmlRawAttr{start: start, valueStart: valueStart, valueEnd: i - 1, end: i}
+		a.name.Local = rawName
+		if p := strings.IndexByte(rawName, ':'); p >= 0 {
+			a.name.Local = rawName[p+1:]
+			switch prefix := rawName[:p]; prefix {
+			case "xml":
+				a.name.Space = nsXML
+			case "xmlns":
+				a.name.Space = prefix
+			default:
+				a.name.Space = n.namespace(prefix)
+			}
+		}
+		attrs = append(attrs, a)
+	}
+}
+
+// rawName returns the qualified name of the element as written in the
+// document.
+func (ed *xmlEditor) rawName(n *xmlNode) string {
+	tag := ed.raw[n.start+1 : n.content]
+	if i := bytes.IndexAny(tag, " \t\r\n/>"); i >= 0 {
+		tag = tag[:i]
+	}
+	return string(tag)
+}
+
+func (ed *xmlEditor) selfClosing(n *xmlNode) bool {
+	return bytes.HasSuffix(ed.raw[n.start:n.content], []byte("/>"))
+}
+
+// leading returns the whitespace preceding the element.
+func (ed *xmlEditor) leading(n *xmlNode) string {
+	i := n.start
+	for i > 0 && strings.IndexByte(" \t\r\n", ed.raw[i-1]) >= 0 {
+		i--
+	}
+	return string(ed.raw[i:n.start])
+}
+
+// indent returns the indentation of the line of the element, empty if other
+// content precedes it on the line.
+func (ed *xmlEditor) indent(n *xmlNode) string {
+	leading := ed.leading(n)
+	i := strings.LastIndexByte(leading, '\n')
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimLeft(leading[i+1:], "\r")
+}
+
+// xmlDeclare declares on the root element of the fragment the well known
+// namespaces it uses which aren't bound to their usual prefix at n.
+func xmlDeclare(n *xmlNode, frag string) string {
+	var decls string
+	for _, space := range []string{nsRDF, nsDC, nsXMPDM} {
+		p := xmlPrefixes[space]
+		if !strings.Contains(frag, "<"+p+":") && !strings.Contains(frag, " "+p+":") {
+			continue
+		}
+		if n.namespace(p) != space {
+			decls += " xmlns:" + p + "=\"" + space + "\""
+		}
+	}
+	i := strings.IndexAny(frag, " />")
+	if decls == "" || i < 0 {
+		return frag
+	}
+	return frag[:i] + decls + frag[i:]
+}
+
+// namespace returns the namespace bound to the passed prefix in the scope of
+// the element.
+func (n *xmlNode) namespace(prefix string) string {
+	for ; n != nil; n = n.parent {
+		for _, a := range n.attrs {
+			if a.Name.Space == "xmlns" && a.Name.Local == prefix {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}